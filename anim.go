@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Animation is a named sequence of sprite IDs played at a fixed rate
+type Animation struct {
+	Name   string
+	Frames []int
+	FPS    int
+}
+
+// runAnim implements the "anim" subcommand
+func runAnim(args []string) {
+	fs := flag.NewFlagSet("anim", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	var specs stringList
+	fs.Var(&specs, "anim", "Animation as name=frames@fps, e.g. walk=1-4@8fps (repeatable)")
+	detect := fs.Bool("detect-anims", false, "Auto-detect runs of adjacent similar sprites")
+	similarity := fs.Float64("similarity", 0.6, "Minimum pixel similarity (0..1) between frames for --detect-anims")
+	minFrames := fs.Int("min-frames", 2, "Minimum run length for --detect-anims")
+	fps := fs.Int("fps", 8, "Frame rate for detected animations")
+	transparent := fs.Int("transparent", 0, "Palette index drawn as transparent (-1 for none)")
+	scale := fs.Int("scale", 8, "Integer scale factor for the output GIFs")
+	outDir := fs.String("out", "animations", "Output directory for the GIFs")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	if len(specs) == 0 && !*detect {
+		fmt.Fprintln(os.Stderr, "Error: give at least one --anim or use --detect-anims")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *scale < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --scale must be at least 1")
+		os.Exit(1)
+	}
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	if len(gfxData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	sheet, err := generateSpriteSheetJSON(gfxData, parseFlagSection(cartPath), opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating spritesheet JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	var anims []Animation
+	for _, spec := range specs {
+		anim, err := parseAnimationSpec(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing --anim %q: %v\n", spec, err)
+			os.Exit(1)
+		}
+		anims = append(anims, anim)
+	}
+	if *detect {
+		detected := detectAnimations(sheet, *similarity, *minFrames, *fps, *transparent)
+		fmt.Printf("Detected %d animations.\n", len(detected))
+		anims = append(anims, detected...)
+	}
+
+	for _, anim := range anims {
+		path := filepath.Join(*outDir, anim.Name+".gif")
+		if err := saveAnimationGIF(sheet, anim, *transparent, *scale, path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Successfully generated %s (%d frames @ %dfps)\n", path, len(anim.Frames), anim.FPS)
+	}
+}
+
+// parseAnimationSpec parses "name=1-4,6@8fps"; the @fps part is optional
+func parseAnimationSpec(spec string) (Animation, error) {
+	name, rest, ok := strings.Cut(spec, "=")
+	if !ok || name == "" {
+		return Animation{}, fmt.Errorf("expected name=frames[@fps]")
+	}
+	anim := Animation{Name: name, FPS: 8}
+
+	frames, rate, hasRate := strings.Cut(rest, "@")
+	if hasRate {
+		fps, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(rate), "fps"))
+		if err != nil || fps <= 0 {
+			return Animation{}, fmt.Errorf("invalid frame rate %q", rate)
+		}
+		anim.FPS = fps
+	}
+
+	ids, err := parseSpriteList(frames)
+	if err != nil {
+		return Animation{}, err
+	}
+	if len(ids) == 0 {
+		return Animation{}, fmt.Errorf("no frames given")
+	}
+	anim.Frames = ids
+	return anim, nil
+}
+
+// spritePixels returns the 8x8 color indices of a sprite, blank if it was not exported
+func spritePixels(sheet *SpriteSheet, spriteID int) [][]int {
+	for i := range sheet.Sprites {
+		if sheet.Sprites[i].ID == spriteID {
+			return sheet.Sprites[i].Pixels
+		}
+	}
+	pixels := make([][]int, 8)
+	for i := range pixels {
+		pixels[i] = make([]int, 8)
+	}
+	return pixels
+}
+
+// spriteAvailable reports whether a sprite ID holds graphics rather than shared map data
+func spriteAvailable(spriteID int, useSection3, useSection4 bool) bool {
+	if spriteID >= 128 && spriteID < 192 && useSection3 {
+		return false
+	}
+	if spriteID >= 192 && useSection4 {
+		return false
+	}
+	return spriteID >= 0 && spriteID < 256
+}
+
+// pixelSimilarity compares two sprites over the pixels that are opaque in either one.
+// Two blank sprites are not considered similar.
+func pixelSimilarity(a, b [][]int, transparent int) float64 {
+	var same, total int
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if a[y][x] == transparent && b[y][x] == transparent {
+				continue
+			}
+			total++
+			if a[y][x] == b[y][x] {
+				same++
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(same) / float64(total)
+}
+
+// detectAnimations finds runs of horizontally adjacent sprites that look alike
+func detectAnimations(sheet *SpriteSheet, threshold float64, minFrames, fps, transparent int) []Animation {
+	useSection3 := sheet.Metadata.AvailableSprites.Sections.Section3
+	useSection4 := sheet.Metadata.AvailableSprites.Sections.Section4
+
+	var anims []Animation
+	for row := 0; row < 16; row++ {
+		var run []int
+		flush := func() {
+			if len(run) >= minFrames {
+				anims = append(anims, Animation{
+					Name:   fmt.Sprintf("auto_%03d_%03d", run[0], run[len(run)-1]),
+					Frames: run,
+					FPS:    fps,
+				})
+			}
+			run = nil
+		}
+
+		for col := 0; col < 16; col++ {
+			id := row*16 + col
+			if !spriteAvailable(id, useSection3, useSection4) {
+				flush()
+				continue
+			}
+			if len(run) > 0 {
+				prev := spritePixels(sheet, run[len(run)-1])
+				if pixelSimilarity(prev, spritePixels(sheet, id), transparent) < threshold {
+					flush()
+				}
+			}
+			run = append(run, id)
+		}
+		flush()
+	}
+	return anims
+}
+
+// animationPalette is the PICO-8 palette with the transparent index made fully transparent
+func animationPalette(transparent int) color.Palette {
+	palette := make(color.Palette, len(pico8Palette))
+	for i, col := range pico8Palette {
+		palette[i] = col
+	}
+	if transparent >= 0 && transparent < len(palette) {
+		palette[transparent] = color.RGBA{0, 0, 0, 0}
+	}
+	return palette
+}
+
+// saveAnimationGIF renders each frame of the animation and writes a looping GIF
+func saveAnimationGIF(sheet *SpriteSheet, anim Animation, transparent, scale int, path string) error {
+	useSection3 := sheet.Metadata.AvailableSprites.Sections.Section3
+	useSection4 := sheet.Metadata.AvailableSprites.Sections.Section4
+
+	palette := animationPalette(transparent)
+	delay := 100 / anim.FPS
+	if delay < 1 {
+		delay = 1
+	}
+
+	out := &gif.GIF{}
+	for _, id := range anim.Frames {
+		if !spriteAvailable(id, useSection3, useSection4) {
+			return fmt.Errorf("sprite %d is used as map data with the current --3/--4 flags", id)
+		}
+		pixels := spritePixels(sheet, id)
+		frame := image.NewPaletted(image.Rect(0, 0, 8*scale, 8*scale), palette)
+		for y := 0; y < 8*scale; y++ {
+			for x := 0; x < 8*scale; x++ {
+				colorIndex := pixels[y/scale][x/scale]
+				if colorIndex < 0 || colorIndex >= len(palette) {
+					colorIndex = 0
+				}
+				frame.SetColorIndex(x, y, uint8(colorIndex))
+			}
+		}
+		out.Image = append(out.Image, frame)
+		out.Delay = append(out.Delay, delay)
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	return gif.EncodeAll(f, out)
+}
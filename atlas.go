@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AtlasJSON is a TexturePacker "JSON Hash" atlas, also read by Phaser, PixiJS and Aseprite
+type AtlasJSON struct {
+	Frames map[string]AtlasFrame `json:"frames"`
+	Meta   AtlasMeta             `json:"meta"`
+}
+
+// AtlasFrame describes one named region of the atlas image
+type AtlasFrame struct {
+	Frame            AtlasRect `json:"frame"`
+	Rotated          bool      `json:"rotated"`
+	Trimmed          bool      `json:"trimmed"`
+	SpriteSourceSize AtlasRect `json:"spriteSourceSize"`
+	SourceSize       AtlasSize `json:"sourceSize"`
+	Flags            int       `json:"flags"` // PICO-8 flag bitfield of the (top-left) sprite
+}
+
+// AtlasRect is a rectangle in atlas pixel coordinates
+type AtlasRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// AtlasSize is a width/height pair
+type AtlasSize struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// AtlasMeta carries the atlas image information
+type AtlasMeta struct {
+	App     string    `json:"app"`
+	Version string    `json:"version"`
+	Image   string    `json:"image"`
+	Format  string    `json:"format"`
+	Size    AtlasSize `json:"size"`
+	Scale   string    `json:"scale"`
+}
+
+// MetaspriteConfig lists multi-tile frames, e.g. 16x16 characters drawn with spr(n,x,y,2,2)
+type MetaspriteConfig struct {
+	Metasprites []MetaspriteDef `json:"metasprites"`
+}
+
+// MetaspriteDef is a block of WxH tiles whose top-left tile is Sprite
+type MetaspriteDef struct {
+	Name   string `json:"name"`
+	Sprite int    `json:"sprite"`
+	W      int    `json:"w"`
+	H      int    `json:"h"`
+}
+
+// runAtlas implements the "atlas" subcommand
+func runAtlas(args []string) {
+	fs := flag.NewFlagSet("atlas", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	configPath := fs.String("config", "", "Optional JSON file defining multi-tile frames")
+	imagePath := fs.String("image", "spritesheet.png", "Atlas image referenced by the JSON")
+	outPath := fs.String("out", "atlas.json", "Output path for the atlas JSON")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	if len(gfxData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	sheet, err := generateSpriteSheetJSON(gfxData, parseFlagSection(cartPath), opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating spritesheet JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	var metasprites []MetaspriteDef
+	if *configPath != "" {
+		metasprites, err = loadMetaspriteConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", *configPath, err)
+			os.Exit(1)
+		}
+	}
+
+	atlas, err := generateAtlasJSON(sheet, metasprites, *imagePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating atlas: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(atlas, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling atlas JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*outPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully generated %s with %d frames\n", *outPath, len(atlas.Frames))
+}
+
+// loadMetaspriteConfig reads a metasprite definition file
+func loadMetaspriteConfig(path string) ([]MetaspriteDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config MetaspriteConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+	return config.Metasprites, nil
+}
+
+// generateAtlasJSON builds a frame for every used sprite plus the configured metasprites
+func generateAtlasJSON(sheet *SpriteSheet, metasprites []MetaspriteDef, imagePath string) (*AtlasJSON, error) {
+	const tileSize = 8
+	atlas := &AtlasJSON{
+		Frames: make(map[string]AtlasFrame),
+		Meta: AtlasMeta{
+			App:     "parsepico8",
+			Version: "1.0",
+			Image:   imagePath,
+			Format:  "RGBA8888",
+			Size:    AtlasSize{W: sheet.Metadata.GridWidth * tileSize, H: sheet.Metadata.GridHeight * tileSize},
+			Scale:   "1",
+		},
+	}
+
+	for _, sprite := range sheet.Sprites {
+		name := strings.TrimSuffix(sprite.Filename, ".png")
+		atlas.Frames[name] = newAtlasFrame(sprite.X*tileSize, sprite.Y*tileSize, sprite.Width, sprite.Height, sprite.Flags.Bitfield)
+	}
+
+	useSection3 := sheet.Metadata.AvailableSprites.Sections.Section3
+	useSection4 := sheet.Metadata.AvailableSprites.Sections.Section4
+	flagsByID := make(map[int]int)
+	for _, sprite := range sheet.Sprites {
+		flagsByID[sprite.ID] = sprite.Flags.Bitfield
+	}
+
+	for _, meta := range metasprites {
+		if meta.Name == "" {
+			return nil, fmt.Errorf("metasprite at sprite %d has no name", meta.Sprite)
+		}
+		if _, exists := atlas.Frames[meta.Name]; exists {
+			return nil, fmt.Errorf("metasprite %q clashes with an existing frame name", meta.Name)
+		}
+		if meta.W < 1 || meta.H < 1 {
+			return nil, fmt.Errorf("metasprite %q needs a positive w and h", meta.Name)
+		}
+		col, row := meta.Sprite%16, meta.Sprite/16
+		if meta.Sprite < 0 || col+meta.W > 16 || row+meta.H > 16 {
+			return nil, fmt.Errorf("metasprite %q does not fit in the sprite sheet", meta.Name)
+		}
+		lastID := (row+meta.H-1)*16 + col + meta.W - 1
+		if !spriteAvailable(lastID, useSection3, useSection4) {
+			return nil, fmt.Errorf("metasprite %q reaches into a dual-purpose section", meta.Name)
+		}
+		atlas.Frames[meta.Name] = newAtlasFrame(col*tileSize, row*tileSize, meta.W*tileSize, meta.H*tileSize, flagsByID[meta.Sprite])
+	}
+
+	return atlas, nil
+}
+
+// newAtlasFrame creates an untrimmed, unrotated frame
+func newAtlasFrame(x, y, w, h, flags int) AtlasFrame {
+	return AtlasFrame{
+		Frame:            AtlasRect{X: x, Y: y, W: w, H: h},
+		SpriteSourceSize: AtlasRect{X: 0, Y: 0, W: w, H: h},
+		SourceSize:       AtlasSize{W: w, H: h},
+		Flags:            flags,
+	}
+}
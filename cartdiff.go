@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runTextconv implements the "textconv" subcommand, meant for use as a git diff driver:
+//
+//	git config diff.pico8.textconv "parsepico8 textconv"
+//	echo "*.p8 diff=pico8" >> .gitattributes
+func runTextconv(args []string) {
+	fs := flag.NewFlagSet("textconv", flag.ExitOnError)
+	useSection3 := fs.Bool("3", false, "Include dual-purpose section 3 (sprites 128..191)")
+	useSection4 := fs.Bool("4", false, "Include dual-purpose section 4 (sprites 192..255)")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 textconv [--3] [--4] cart.p8")
+		os.Exit(1)
+	}
+	cartPath, err := resolveCartPath(fs.Arg(0))
+	if err == nil {
+		_, err = os.Stat(cartPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading cart: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(cartText(cartPath, *useSection3, *useSection4))
+}
+
+// runCartDiff prints a section by section diff of two carts
+func runCartDiff(oldPath, newPath string, useSection3, useSection4 bool) {
+	for _, path := range []string{oldPath, newPath} {
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	fmt.Print(semanticCartDiff(oldPath, newPath, useSection3, useSection4))
+}
+
+// semanticCartDiff compares each section in its own terms: Lua as a unified text
+// diff, gfx per sprite, gff per flag bit, map per cell and sfx/music per note
+func semanticCartDiff(oldPath, newPath string, useSection3, useSection4 bool) string {
+	var out strings.Builder
+	section := func(name, body string) {
+		if body != "" {
+			fmt.Fprintf(&out, "=== %s ===\n%s", name, body)
+		}
+	}
+
+	section("lua", unifiedDiff(parseSection(oldPath, "__lua__"), parseSection(newPath, "__lua__"), 3))
+
+	gfx := diffSpriteSheets(
+		sheetPixels(parseSection(oldPath, "__gfx__")), sheetPixels(parseSection(newPath, "__gfx__")),
+		parseFlagSection(oldPath), parseFlagSection(newPath), useSection3, useSection4)
+	var gfxText, gffText strings.Builder
+	for _, change := range gfx.Sprites {
+		fmt.Fprintf(&gfxText, "sprite %d: %d pixels changed\n", change.ID, change.ChangedPixels)
+	}
+	for _, change := range gfx.Flags {
+		fmt.Fprintf(&gffText, "sprite %d: flags 0x%02x -> 0x%02x", change.ID, change.Old, change.New)
+		for _, bit := range change.Set {
+			fmt.Fprintf(&gffText, " +%d", bit)
+		}
+		for _, bit := range change.Cleared {
+			fmt.Fprintf(&gffText, " -%d", bit)
+		}
+		gffText.WriteString("\n")
+	}
+	section("gfx", gfxText.String())
+	section("gff", gffText.String())
+
+	oldGrid, errOld := loadMapGrid(oldPath, useSection3, useSection4)
+	newGrid, errNew := loadMapGrid(newPath, useSection3, useSection4)
+	if errOld == nil && errNew == nil {
+		var mapText strings.Builder
+		for _, change := range diffMapGrids(oldGrid, newGrid).Changes {
+			fmt.Fprintf(&mapText, "(%d,%d): %d -> %d\n", change.X, change.Y, change.Old, change.New)
+		}
+		section("map", mapText.String())
+	}
+
+	section("sfx", diffSfx(parseSfxSection(parseSection(oldPath, "__sfx__")), parseSfxSection(parseSection(newPath, "__sfx__"))))
+	section("music", diffMusic(parseMusicSection(parseSection(oldPath, "__music__")), parseMusicSection(parseSection(newPath, "__music__"))))
+	return out.String()
+}
+
+// diffSfx lists changed sfx header fields and notes
+func diffSfx(oldSfx, newSfx []Sfx) string {
+	var out strings.Builder
+	for i := 0; i < max(len(oldSfx), len(newSfx)); i++ {
+		var before, after Sfx
+		if i < len(oldSfx) {
+			before = oldSfx[i]
+		}
+		if i < len(newSfx) {
+			after = newSfx[i]
+		}
+		if before.header() != after.header() {
+			fmt.Fprintf(&out, "sfx %d: %s -> %s\n", i, before.header(), after.header())
+		}
+		for n := range after.Notes {
+			if before.Notes[n] != after.Notes[n] {
+				fmt.Fprintf(&out, "sfx %d note %d: %s -> %s\n", i, n, before.Notes[n], after.Notes[n])
+			}
+		}
+	}
+	return out.String()
+}
+
+// diffMusic lists changed music patterns
+func diffMusic(oldMusic, newMusic []MusicPattern) string {
+	var out strings.Builder
+	for i := 0; i < max(len(oldMusic), len(newMusic)); i++ {
+		before, after := "(none)", "(none)"
+		if i < len(oldMusic) {
+			before = oldMusic[i].String()
+		}
+		if i < len(newMusic) {
+			after = newMusic[i].String()
+		}
+		if before != after {
+			fmt.Fprintf(&out, "pattern %d: %s -> %s\n", i, before, after)
+		}
+	}
+	return out.String()
+}
+
+// header formats the sfx settings that are not notes
+func (s Sfx) header() string {
+	return fmt.Sprintf("mode %d speed %d loop %d-%d", s.Mode, s.Speed, s.LoopStart, s.LoopEnd)
+}
+
+// cartText renders a cart as stable, line-oriented text so that ordinary line
+// diffs of it read like the semantic diff: one sprite row, flag byte, map row,
+// note or pattern per line, with empty data left out
+func cartText(cartPath string, useSection3, useSection4 bool) string {
+	var out strings.Builder
+
+	out.WriteString("=== lua ===\n")
+	for _, line := range parseSection(cartPath, "__lua__") {
+		out.WriteString(line + "\n")
+	}
+
+	out.WriteString("=== gfx ===\n")
+	pixels := sheetPixels(parseSection(cartPath, "__gfx__"))
+	for id := 0; id < 256; id++ {
+		if !spriteAvailable(id, useSection3, useSection4) {
+			continue
+		}
+		rows := make([]string, 8)
+		blank := true
+		for y := 0; y < 8; y++ {
+			var row strings.Builder
+			for x := 0; x < 8; x++ {
+				c := pixels[(id/16)*8+y][(id%16)*8+x]
+				blank = blank && c == 0
+				row.WriteByte("0123456789abcdef"[c])
+			}
+			rows[y] = row.String()
+		}
+		if blank {
+			continue
+		}
+		for y, row := range rows {
+			fmt.Fprintf(&out, "sprite %d row %d: %s\n", id, y, row)
+		}
+	}
+
+	out.WriteString("=== gff ===\n")
+	for id, flags := range parseFlagSection(cartPath) {
+		if flags != 0 {
+			fmt.Fprintf(&out, "sprite %d: flags 0x%02x %v\n", id, flags, setBits(flags))
+		}
+	}
+
+	out.WriteString("=== map ===\n")
+	if grid, err := loadMapGrid(cartPath, useSection3, useSection4); err == nil {
+		for y, row := range grid {
+			var cells []string
+			for x, id := range row {
+				if id != 0 {
+					cells = append(cells, fmt.Sprintf("%d:%d", x, id))
+				}
+			}
+			if len(cells) > 0 {
+				fmt.Fprintf(&out, "row %d: %s\n", y, strings.Join(cells, " "))
+			}
+		}
+	}
+
+	out.WriteString("=== sfx ===\n")
+	for i, sfx := range parseSfxSection(parseSection(cartPath, "__sfx__")) {
+		if sfx == (Sfx{Speed: sfx.Speed}) {
+			continue
+		}
+		fmt.Fprintf(&out, "sfx %d: %s\n", i, sfx.header())
+		for n, note := range sfx.Notes {
+			if note != (Note{}) {
+				fmt.Fprintf(&out, "sfx %d note %d: %s\n", i, n, note)
+			}
+		}
+	}
+
+	out.WriteString("=== music ===\n")
+	for i, pattern := range parseMusicSection(parseSection(cartPath, "__music__")) {
+		fmt.Fprintf(&out, "pattern %d: %s\n", i, pattern)
+	}
+	return out.String()
+}
+
+// setBits lists the set bits of a flag byte
+func setBits(flags int) []int {
+	bits := make([]int, 0, 8)
+	for bit := 0; bit < 8; bit++ {
+		if flags&(1<<bit) != 0 {
+			bits = append(bits, bit)
+		}
+	}
+	return bits
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// cartFile is a .p8 file split into its header and raw sections, in file order
+type cartFile struct {
+	Header   []string // "pico-8 cartridge ..." and "version N"
+	Sections []cartSection
+}
+
+// cartSection is one __name__ block and its lines
+type cartSection struct {
+	Name  string
+	Lines []string
+}
+
+// readCartFile splits a .p8 file into header and sections
+func readCartFile(path string) (*cartFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	cart := &cartFile{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isSectionMarker(line) {
+			cart.Sections = append(cart.Sections, cartSection{Name: line})
+			continue
+		}
+		if len(cart.Sections) == 0 {
+			cart.Header = append(cart.Header, line)
+		} else {
+			last := &cart.Sections[len(cart.Sections)-1]
+			last.Lines = append(last.Lines, line)
+		}
+	}
+	return cart, scanner.Err()
+}
+
+// isSectionMarker reports whether a line starts a section, like __gfx__
+func isSectionMarker(line string) bool {
+	return len(line) > 4 && strings.HasPrefix(line, "__") && strings.HasSuffix(line, "__") && !strings.Contains(line, " ")
+}
+
+// section returns the lines of a section and whether it exists
+func (c *cartFile) section(name string) ([]string, bool) {
+	for _, s := range c.Sections {
+		if s.Name == name {
+			return s.Lines, true
+		}
+	}
+	return nil, false
+}
+
+// String writes the cart back in .p8 format
+func (c *cartFile) String() string {
+	var out strings.Builder
+	for _, line := range c.Header {
+		out.WriteString(line + "\n")
+	}
+	for _, s := range c.Sections {
+		out.WriteString(s.Name + "\n")
+		for _, line := range s.Lines {
+			out.WriteString(line + "\n")
+		}
+	}
+	return out.String()
+}
+
+// setSection replaces a section's lines, adding the section after the header
+// when the cart doesn't have it
+func (c *cartFile) setSection(name string, lines []string) {
+	for i := range c.Sections {
+		if c.Sections[i].Name == name {
+			c.Sections[i].Lines = lines
+			return
+		}
+	}
+	c.Sections = append([]cartSection{{Name: name, Lines: lines}}, c.Sections...)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cartOptions holds the flags shared by every subcommand that reads a cart
+type cartOptions struct {
+	path        string
+	useSection3 bool
+	useSection4 bool
+	auto        bool
+}
+
+// addCartFlags registers --cart, --3 and --4 on a subcommand flag set
+func addCartFlags(fs *flag.FlagSet) *cartOptions {
+	opts := &cartOptions{}
+	fs.StringVar(&opts.path, "cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	fs.BoolVar(&opts.useSection3, "3", false, "Include dual-purpose section 3 (sprites 128..191)")
+	fs.BoolVar(&opts.useSection4, "4", false, "Include dual-purpose section 4 (sprites 192..255)")
+	fs.BoolVar(&opts.auto, "auto", false, "Guess --3/--4 from the cart contents and report why")
+	return opts
+}
+
+// requireCart checks that --cart was given and resolves it, exiting on error.
+// With --auto it also sets the dual-purpose flags from detectDualPurpose.
+func requireCart(fs *flag.FlagSet, opts *cartOptions) string {
+	if opts.path == "" {
+		fmt.Fprintln(os.Stderr, "Error: --cart flag is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+	cartPath, err := resolveCartPath(opts.path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving cart path: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.auto {
+		guess := detectCartDualPurpose(cartPath)
+		opts.useSection3, opts.useSection4 = guess.UseSection3, guess.UseSection4
+		printGuess(os.Stderr, guess) // stdout may carry the command's output
+	}
+	return cartPath
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseSpriteList parses "1-4,7,9" style lists of sprite IDs
+func parseSpriteList(spec string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			start, err := strconv.Atoi(lo)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sprite range %q", part)
+			}
+			end, err := strconv.Atoi(hi)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sprite range %q", part)
+			}
+			step := 1
+			if end < start {
+				step = -1
+			}
+			for id := start; id != end+step; id += step {
+				ids = append(ids, id)
+			}
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sprite id %q", part)
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		if id < 0 || id > 255 {
+			return nil, fmt.Errorf("sprite id %d out of range 0..255", id)
+		}
+	}
+	return ids, nil
+}
+
+// parseSize parses a "WxH" size such as 16x16
+func parseSize(spec string) (w, h int, err error) {
+	ws, hs, ok := strings.Cut(strings.ToLower(spec), "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected WxH, got %q", spec)
+	}
+	w, errW := strconv.Atoi(ws)
+	h, errH := strconv.Atoi(hs)
+	if errW != nil || errH != nil || w < 1 || h < 1 {
+		return 0, 0, fmt.Errorf("invalid size %q", spec)
+	}
+	return w, h, nil
+}
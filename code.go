@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// PICO-8's code limits
+const (
+	tokenLimit = 8192
+	charLimit  = 65535
+)
+
+// SourceMapSegment maps a run of flattened lines to consecutive lines of one file:
+// output line Start+i came from Line+i of File, for i < Count
+type SourceMapSegment struct {
+	Start int    `json:"start"`
+	Count int    `json:"count"`
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+}
+
+// SourceMap relates a flattened program to the files it was built from
+type SourceMap struct {
+	Version  int                `json:"version"`
+	Segments []SourceMapSegment `json:"segments"`
+}
+
+// buildSourceMap compresses the per-line origins into segments
+func buildSourceMap(program *resolvedProgram) *SourceMap {
+	sm := &SourceMap{Version: 1, Segments: make([]SourceMapSegment, 0)}
+	for i, origin := range program.Origins {
+		if n := len(sm.Segments); n > 0 {
+			last := &sm.Segments[n-1]
+			if last.File == origin.File && last.Line+last.Count == origin.Line {
+				last.Count++
+				continue
+			}
+		}
+		sm.Segments = append(sm.Segments, SourceMapSegment{Start: i + 1, Count: 1, File: origin.File, Line: origin.Line})
+	}
+	return sm
+}
+
+// locateError rewrites a Lua error's flattened line as file:line
+func locateError(program *resolvedProgram, err error) error {
+	var luaErr *lua.Error
+	if !errors.As(err, &luaErr) || luaErr.Line == 0 {
+		return err
+	}
+	origin := program.origin(luaErr.Line)
+	return fmt.Errorf("%s:%d: %s", origin.File, origin.Line, luaErr.Msg)
+}
+
+// loadProgram resolves a cart's includes, exiting on error
+func loadProgram(cartPath string) *resolvedProgram {
+	program, err := resolveProgram(cartPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving includes: %v\n", err)
+		os.Exit(1)
+	}
+	return program
+}
+
+// runFlatten implements the "flatten" subcommand: the cart's code with all
+// includes expanded, plus an optional source map
+func runFlatten(args []string) {
+	fs := flag.NewFlagSet("flatten", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	outPath := fs.String("out", "", "Write the flattened Lua here instead of stdout")
+	mapPath := fs.String("sourcemap", "", "Write a JSON source map back to the original files and lines")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 flatten --cart <file.p8> [--out <file.lua>] [--sourcemap <file.json>]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Expands #include directives into a single Lua program.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	program := loadProgram(requireCart(fs, &cartOptions{path: *cartPath}))
+
+	source := program.Source() + "\n"
+	if *outPath == "" {
+		fmt.Print(source)
+	} else if err := os.WriteFile(*outPath, []byte(source), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+
+	if *mapPath != "" {
+		data, err := json.MarshalIndent(buildSourceMap(program), "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding source map: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*mapPath, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *mapPath, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// TokenReport is the token and character count of a program
+type TokenReport struct {
+	Tokens     int            `json:"tokens"`
+	TokenLimit int            `json:"tokenLimit"`
+	Chars      int            `json:"chars"`
+	CharLimit  int            `json:"charLimit"`
+	Files      map[string]int `json:"files"` // tokens per source file
+}
+
+// countProgramTokens counts the tokens of a resolved program, attributing each
+// one to the file it came from
+func countProgramTokens(program *resolvedProgram) (*TokenReport, error) {
+	source := program.Source()
+	tokens, err := lua.Lex(source)
+	if err != nil {
+		return nil, locateError(program, err)
+	}
+	report := &TokenReport{TokenLimit: tokenLimit, Chars: codeChars(source), CharLimit: charLimit, Files: make(map[string]int)}
+	for i, tok := range tokens {
+		if cost := lua.TokenCost(tokens, i); cost > 0 {
+			report.Tokens += cost
+			report.Files[program.origin(tok.Line).File] += cost
+		}
+	}
+	return report, nil
+}
+
+// runTokens implements the "tokens" subcommand
+func runTokens(args []string) {
+	fs := flag.NewFlagSet("tokens", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	asJSON := fs.Bool("json", false, "Print the counts as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 tokens --cart <file.p8> [--json]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Counts tokens and characters of the code, #includes resolved, against PICO-8's limits.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	program := loadProgram(requireCart(fs, &cartOptions{path: *cartPath}))
+
+	report, err := countProgramTokens(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("tokens:     %5d / %d (%.0f%%)\n", report.Tokens, report.TokenLimit, 100*float64(report.Tokens)/float64(report.TokenLimit))
+	fmt.Printf("characters: %5d / %d (%.0f%%)\n", report.Chars, report.CharLimit, 100*float64(report.Chars)/float64(report.CharLimit))
+	if len(report.Files) > 1 {
+		files := make([]string, 0, len(report.Files))
+		for file := range report.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			fmt.Printf("  %-20s %5d\n", file, report.Files[file])
+		}
+	}
+}
+
+// runAST implements the "ast" subcommand: the parsed program as JSON, with
+// every node's position given as its original file and line
+func runAST(args []string) {
+	fs := flag.NewFlagSet("ast", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	outPath := fs.String("out", "", "Write the JSON here instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 ast --cart <file.p8> [--out <file.json>]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Parses the code, #includes resolved, and prints the syntax tree as JSON.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	program := loadProgram(requireCart(fs, &cartOptions{path: *cartPath}))
+
+	block, err := lua.Parse(program.Source())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", locateError(program, err))
+		os.Exit(1)
+	}
+	tree := lua.DumpAST(block, func(line int) map[string]any {
+		origin := program.origin(line)
+		return map[string]any{"file": origin.File, "line": origin.Line}
+	})
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding AST: %v\n", err)
+		os.Exit(1)
+	}
+	if *outPath == "" {
+		fmt.Println(string(data))
+		return
+	}
+	if err := os.WriteFile(*outPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTabs is how many code tabs the PICO-8 editor has
+const maxTabs = 16
+
+// tabFilePattern matches split tab files: tab_3.lua or tab_3_player.lua
+var tabFilePattern = regexp.MustCompile(`^tab_(\d+)(_[a-z0-9_]+)?\.lua$`)
+
+// splitTabs cuts __lua__ lines at the -->8 separators
+func splitTabs(lines []string) [][]string {
+	tabs := [][]string{nil}
+	for _, line := range lines {
+		if line == tabSeparator {
+			tabs = append(tabs, nil)
+			continue
+		}
+		tabs[len(tabs)-1] = append(tabs[len(tabs)-1], line)
+	}
+	return tabs
+}
+
+// joinTabs is the inverse of splitTabs
+func joinTabs(tabs [][]string) []string {
+	var lines []string
+	for i, tab := range tabs {
+		if i > 0 {
+			lines = append(lines, tabSeparator)
+		}
+		lines = append(lines, tab...)
+	}
+	return lines
+}
+
+// tabFileName names a tab's file, adding the words of a leading "-- comment"
+// as a hint: "-- player movement" in tab 1 gives tab_1_player_movement.lua
+func tabFileName(n int, tab []string) string {
+	name := "tab_" + strconv.Itoa(n)
+	if len(tab) == 0 {
+		return name + ".lua"
+	}
+	comment, ok := strings.CutPrefix(strings.TrimSpace(tab[0]), "--")
+	if !ok || strings.HasPrefix(comment, "[[") {
+		return name + ".lua"
+	}
+	var hint strings.Builder
+	for _, word := range strings.FieldsFunc(strings.ToLower(comment), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if hint.Len()+len(word) > 32 {
+			break
+		}
+		hint.WriteString("_" + word)
+	}
+	return name + hint.String() + ".lua"
+}
+
+// tabFileContent is a tab as file content. Every line ends in a newline, so an
+// empty tab is an empty file and a tab holding one blank line is "\n".
+func tabFileContent(tab []string) string {
+	if len(tab) == 0 {
+		return ""
+	}
+	return strings.Join(tab, "\n") + "\n"
+}
+
+// parseTabFile is the inverse of tabFileContent. It also drops a byte order
+// mark and Windows line endings an external editor may have added.
+func parseTabFile(data string) []string {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	if data == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+}
+
+// listTabFiles finds the tab files in dir, indexed by tab number
+func listTabFiles(dir string) (map[int]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[int]string)
+	for _, e := range entries {
+		m := tabFilePattern.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if other, ok := files[n]; ok {
+			return nil, fmt.Errorf("both %s and %s are tab %d", other, e.Name(), n)
+		}
+		files[n] = e.Name()
+	}
+	return files, nil
+}
+
+// runSplitCode implements the "split-code" subcommand
+func runSplitCode(args []string) {
+	fs := flag.NewFlagSet("split-code", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	outDir := fs.String("out", "code", "Directory for the tab files")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 split-code --cart <file.p8> [--out <dir>]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Writes each code tab of __lua__ to its own tab_N.lua file.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	path := requireCart(fs, &cartOptions{path: *cartPath})
+
+	cart, err := readCartFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	code, _ := cart.section("__lua__")
+	tabs := splitTabs(code)
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", *outDir, err)
+		os.Exit(1)
+	}
+	// Tab files left from an earlier split would be joined back in, possibly
+	// under an old name
+	old, err := filepath.Glob(filepath.Join(*outDir, "tab_*.lua"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *outDir, err)
+		os.Exit(1)
+	}
+	for _, name := range old {
+		if !tabFilePattern.MatchString(filepath.Base(name)) {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing %s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+
+	for i, tab := range tabs {
+		name := tabFileName(i, tab)
+		if err := os.WriteFile(filepath.Join(*outDir, name), []byte(tabFileContent(tab)), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %d lines\n", filepath.Join(*outDir, name), len(tab))
+	}
+}
+
+// runJoinCode implements the "join-code" subcommand
+func runJoinCode(args []string) {
+	fs := flag.NewFlagSet("join-code", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	dir := fs.String("dir", "code", "Directory holding the tab files")
+	outPath := fs.String("out", "", "Write the cart here instead of over --cart")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 join-code --cart <file.p8> [--dir <dir>] [--out <file.p8>]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Puts tab_N.lua files back into the cart's __lua__ section, -->8 between tabs.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	path := requireCart(fs, &cartOptions{path: *cartPath})
+
+	cart, err := readCartFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	tabs, err := readTabFiles(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cart.setSection("__lua__", joinTabs(tabs))
+
+	target := *outPath
+	if target == "" {
+		target = path
+	}
+	err = writeFileAtomic(target, func(w io.Writer) error {
+		_, err := io.WriteString(w, cart.String())
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", target, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Joined %d tabs into %s\n", len(tabs), target)
+}
+
+// readTabFiles loads tab_0.lua, tab_1.lua, ... from dir. The numbers must run
+// from 0 without gaps, and no line may be one the cart format would read as
+// a tab separator or a section marker.
+func readTabFiles(dir string) ([][]string, error) {
+	files, err := listTabFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no tab_N.lua files in %s", dir)
+	}
+	numbers := make([]int, 0, len(files))
+	for n := range files {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	if last := numbers[len(numbers)-1]; last >= maxTabs {
+		return nil, fmt.Errorf("%s: PICO-8 has only %d tabs", files[last], maxTabs)
+	}
+
+	tabs := make([][]string, len(numbers))
+	for i, n := range numbers {
+		if n != i {
+			return nil, fmt.Errorf("tab %d is missing from %s", i, dir)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, files[n]))
+		if err != nil {
+			return nil, err
+		}
+		tabs[i] = parseTabFile(string(data))
+		for j, line := range tabs[i] {
+			if line == tabSeparator || isSectionMarker(line) {
+				return nil, fmt.Errorf("%s:%d: %q can't appear inside a tab", files[n], j+1, line)
+			}
+		}
+	}
+	return tabs, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitJoinTabs(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		tabs  int
+	}{
+		{"empty", nil, 1},
+		{"one tab", []string{"x = 1", "", "y = 2"}, 1},
+		{"three tabs", []string{"a()", tabSeparator, "-- b", "b()", tabSeparator, "c()"}, 3},
+		{"empty tabs", []string{tabSeparator, tabSeparator}, 3},
+		{"trailing separator", []string{"a()", tabSeparator}, 2},
+	}
+	for _, tt := range tests {
+		tabs := splitTabs(tt.lines)
+		if len(tabs) != tt.tabs {
+			t.Errorf("%s: %d tabs; want %d", tt.name, len(tabs), tt.tabs)
+		}
+		if got := joinTabs(tabs); !slices.Equal(got, tt.lines) {
+			t.Errorf("%s: joinTabs(splitTabs(%q)) = %q", tt.name, tt.lines, got)
+		}
+		for i, tab := range tabs {
+			if got := parseTabFile(tabFileContent(tab)); !slices.Equal(got, tab) {
+				t.Errorf("%s: tab %d %q came back from its file as %q", tt.name, i, tab, got)
+			}
+		}
+	}
+}
+
+func TestTabFileName(t *testing.T) {
+	tests := []struct {
+		n    int
+		tab  []string
+		want string
+	}{
+		{0, nil, "tab_0.lua"},
+		{1, []string{"-- player movement", "x = 1"}, "tab_1_player_movement.lua"},
+		{2, []string{"  --Enemies & AI!"}, "tab_2_enemies_ai.lua"},
+		{3, []string{"--[[ block comment ]]"}, "tab_3.lua"},
+		{4, []string{"x = 1 -- not a title"}, "tab_4.lua"},
+		{5, []string{"--"}, "tab_5.lua"},
+		{6, []string{"-- aaaaaaaaaa bbbbbbbbbb cccccccccc dddddddddd"}, "tab_6_aaaaaaaaaa_bbbbbbbbbb_cccccccccc.lua"},
+	}
+	for _, tt := range tests {
+		if got := tabFileName(tt.n, tt.tab); got != tt.want {
+			t.Errorf("tabFileName(%d, %q) = %s; want %s", tt.n, tt.tab, got, tt.want)
+		}
+	}
+}
+
+func TestParseTabFile(t *testing.T) {
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"", nil},
+		{"\n", []string{""}},
+		{"a\nb\n", []string{"a", "b"}},
+		{"a\nb", []string{"a", "b"}},
+		{"a\n\n", []string{"a", ""}},
+		{"\ufeffa\n", []string{"a"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"\ufeffa\r\n\r\nb", []string{"a", "", "b"}},
+	}
+	for _, tt := range tests {
+		if got := parseTabFile(tt.data); !slices.Equal(got, tt.want) {
+			t.Errorf("parseTabFile(%q) = %q; want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestReadTabFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    [][]string
+		wantErr string
+	}{
+		{
+			"hinted names and other files",
+			map[string]string{"tab_0.lua": "a()\n", "tab_1_player.lua": "-- player\nb()\n", "notes.txt": "x", "tab_x.lua": "y"},
+			[][]string{{"a()"}, {"-- player", "b()"}},
+			"",
+		},
+		{"empty directory", nil, nil, "no tab_N.lua files"},
+		{"gap", map[string]string{"tab_0.lua": "", "tab_2.lua": ""}, nil, "tab 1 is missing"},
+		{"not starting at 0", map[string]string{"tab_1.lua": ""}, nil, "tab 0 is missing"},
+		{"too many tabs", map[string]string{"tab_0.lua": "", "tab_16.lua": ""}, nil, "tab_16.lua: PICO-8 has only 16 tabs"},
+		{"two files for one tab", map[string]string{"tab_0.lua": "", "tab_0_main.lua": ""}, nil, "are tab 0"},
+		{"separator inside a tab", map[string]string{"tab_0.lua": "a()\n-->8\nb()\n"}, nil, "tab_0.lua:2: \"-->8\" can't appear inside a tab"},
+		{"section marker inside a tab", map[string]string{"tab_0.lua": "__gfx__\n"}, nil, "tab_0.lua:1:"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, data := range tt.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := readTabFiles(dir)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v; want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("%s: readTabFiles = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
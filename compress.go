@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// compressedLimit is how many bytes of compressed code fit in a .p8.png cart
+const compressedLimit = 15616
+
+// codeChars counts characters the way PICO-8 does: each P8SCII glyph is one
+// character, even when it is written as an emoji with a variation selector
+func codeChars(code string) int {
+	n := 0
+	for _, r := range code {
+		if r != '\ufe0f' {
+			n++
+		}
+	}
+	return n
+}
+
+// p8sciiBytes turns code into one byte per character. ASCII stays as it is;
+// other characters get the bytes from 0x80 up in order of appearance, which
+// is not PICO-8's table but compresses the same way.
+func p8sciiBytes(code string) []byte {
+	out := make([]byte, 0, len(code))
+	glyphs := make(map[rune]byte)
+	for _, r := range code {
+		switch {
+		case r == '\ufe0f':
+		case r < utf8.RuneSelf:
+			out = append(out, byte(r))
+		default:
+			b, ok := glyphs[r]
+			if !ok {
+				b = byte(0x80 + len(glyphs)%0x80)
+				glyphs[r] = b
+			}
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// pxaCompress compresses code with the "pxa" scheme PICO-8 uses for the code
+// of .p8.png carts: a bit stream of literals, coded by their position in a
+// move-to-front list, and back references of at least 3 bytes. Matches are
+// chosen greedily, so PICO-8's own compressor may do a little better or
+// worse.
+func pxaCompress(src []byte) []byte {
+	const (
+		minMatch  = 3
+		maxOffset = 1 << 15
+		maxChain  = 512
+	)
+	w := &bitWriter{}
+	var mtf [256]byte
+	for i := range mtf {
+		mtf[i] = byte(i)
+	}
+
+	// Hash chains of earlier positions starting with the same 3 bytes
+	head := make(map[[3]byte]int)
+	prev := make([]int, len(src))
+	insert := func(i int) {
+		if i+minMatch > len(src) {
+			return
+		}
+		key := [3]byte{src[i], src[i+1], src[i+2]}
+		if j, ok := head[key]; ok {
+			prev[i] = j
+		} else {
+			prev[i] = -1
+		}
+		head[key] = i
+	}
+
+	for pos := 0; pos < len(src); {
+		bestLen, bestOff := 0, 0
+		if pos+minMatch <= len(src) {
+			j, ok := head[[3]byte{src[pos], src[pos+1], src[pos+2]}]
+			for n := 0; ok && j >= 0 && pos-j <= maxOffset && n < maxChain; n++ {
+				length := 0
+				for pos+length < len(src) && src[j+length] == src[pos+length] {
+					length++
+				}
+				if length > bestLen {
+					bestLen, bestOff = length, pos-j
+				}
+				j = prev[j]
+			}
+		}
+
+		if bestLen >= minMatch && matchBits(bestOff, bestLen) <= literalBits(mtf, src[pos:pos+bestLen]) {
+			w.bit(0)
+			switch {
+			case bestOff <= 32:
+				w.bits(3, 2) // 1, 1: 5 bit offset
+				w.bits(uint32(bestOff-1), 5)
+			case bestOff <= 1024:
+				w.bits(1, 2) // 1, 0: 10 bit offset
+				w.bits(uint32(bestOff-1), 10)
+			default:
+				w.bit(0) // 15 bit offset
+				w.bits(uint32(bestOff-1), 15)
+			}
+			for n := bestLen - minMatch; ; n -= 7 {
+				if n < 7 {
+					w.bits(uint32(n), 3)
+					break
+				}
+				w.bits(7, 3)
+			}
+			for i := 0; i < bestLen; i++ {
+				insert(pos + i)
+			}
+			pos += bestLen
+			continue
+		}
+
+		i := moveToFront(&mtf, src[pos])
+		w.bit(1)
+		n := 4
+		for i >= 1<<(n+1)-16 {
+			w.bit(1)
+			n++
+		}
+		w.bit(0)
+		w.bits(uint32(i-(1<<n-16)), n)
+		insert(pos)
+		pos++
+	}
+
+	out := make([]byte, 8, 8+len(w.data))
+	copy(out, "\x00pxa")
+	binary.BigEndian.PutUint16(out[4:], uint16(len(src)))
+	binary.BigEndian.PutUint16(out[6:], uint16(8+len(w.data)))
+	return append(out, w.data...)
+}
+
+// literalBits is what coding b as literals would cost, without changing mtf
+func literalBits(mtf [256]byte, b []byte) int {
+	total := 0
+	for _, c := range b {
+		i := moveToFront(&mtf, c)
+		n := 4
+		for i >= 1<<(n+1)-16 {
+			n++
+		}
+		total += 1 + (n - 3) + n
+	}
+	return total
+}
+
+// matchBits is the cost of a back reference
+func matchBits(offset, length int) int {
+	bits := 1 + 3*((length-3)/7+1)
+	switch {
+	case offset <= 32:
+		return bits + 2 + 5
+	case offset <= 1024:
+		return bits + 2 + 10
+	}
+	return bits + 1 + 15
+}
+
+// moveToFront returns the position of c in mtf and moves it to the front
+func moveToFront(mtf *[256]byte, c byte) int {
+	i := 0
+	for mtf[i] != c {
+		i++
+	}
+	copy(mtf[1:i+1], mtf[:i])
+	mtf[0] = c
+	return i
+}
+
+// bitWriter packs bits least significant first
+type bitWriter struct {
+	data []byte
+	n    int // bits written
+}
+
+func (w *bitWriter) bit(b uint32) {
+	if w.n%8 == 0 {
+		w.data = append(w.data, 0)
+	}
+	w.data[len(w.data)-1] |= byte(b&1) << (w.n % 8)
+	w.n++
+}
+
+// bits writes the low count bits of v, lowest first
+func (w *bitWriter) bits(v uint32, count int) {
+	for i := 0; i < count; i++ {
+		w.bit(v >> i)
+	}
+}
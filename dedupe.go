@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DuplicateReport is the duplicates.json output
+type DuplicateReport struct {
+	Version     string           `json:"version"`
+	Description string           `json:"description"`
+	Groups      []DuplicateGroup `json:"groups"`
+	Summary     DuplicateSummary `json:"summary"`
+}
+
+// DuplicateGroup is a canonical sprite together with every copy of it
+type DuplicateGroup struct {
+	Canonical  int               `json:"canonical"`
+	Duplicates []SpriteDuplicate `json:"duplicates"`
+}
+
+// SpriteDuplicate is a sprite equal to its group's canonical sprite after Transform.
+// MapCells lists every map cell that places the duplicate.
+type SpriteDuplicate struct {
+	Sprite    int       `json:"sprite"`
+	Transform string    `json:"transform"` // identity, flipx, flipy, rot90, rot180 or rot270
+	MapCells  []MapCell `json:"mapCells"`
+}
+
+// DuplicateSummary counts what could be reclaimed
+type DuplicateSummary struct {
+	SpritesScanned int `json:"spritesScanned"`
+	Exact          int `json:"exact"`
+	Transformed    int `json:"transformed"`
+}
+
+// spriteTransform maps a pixel grid to a transformed copy
+type spriteTransform struct {
+	name    string
+	inverse string
+	apply   func(p [][]int) [][]int
+}
+
+var spriteTransforms = []spriteTransform{
+	{"identity", "identity", func(p [][]int) [][]int { return p }},
+	{"flipx", "flipx", func(p [][]int) [][]int { return remapPixels(p, func(x, y int) (int, int) { return 7 - x, y }) }},
+	{"flipy", "flipy", func(p [][]int) [][]int { return remapPixels(p, func(x, y int) (int, int) { return x, 7 - y }) }},
+	{"rot90", "rot270", func(p [][]int) [][]int { return remapPixels(p, func(x, y int) (int, int) { return y, 7 - x }) }},
+	{"rot180", "rot180", func(p [][]int) [][]int { return remapPixels(p, func(x, y int) (int, int) { return 7 - x, 7 - y }) }},
+	{"rot270", "rot90", func(p [][]int) [][]int { return remapPixels(p, func(x, y int) (int, int) { return 7 - y, x }) }},
+}
+
+// runDedupe implements the "dedupe" subcommand
+func runDedupe(args []string) {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	exactOnly := fs.Bool("exact", false, "Only report exact duplicates, not flipped or rotated ones")
+	outPath := fs.String("out", "duplicates.json", "Output path for the report")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	if len(gfxData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	sheet, err := generateSpriteSheetJSON(gfxData, parseFlagSection(cartPath), opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating spritesheet JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cells []MapCell
+	if mapData := parseSection(cartPath, "__map__"); len(mapData) > 0 {
+		mapSheet, err := generateMapJSON(mapData, gfxData, opts.useSection3, opts.useSection4)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
+			os.Exit(1)
+		}
+		cells = mapSheet.Cells
+	}
+
+	report := findDuplicateSprites(sheet, cells, *exactOnly)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling duplicate report: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*outPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+
+	for _, group := range report.Groups {
+		for _, dup := range group.Duplicates {
+			fmt.Printf("sprite %3d = %-8s of sprite %3d (%d map cells)\n", dup.Sprite, dup.Transform, group.Canonical, len(dup.MapCells))
+		}
+	}
+	fmt.Printf("Scanned %d sprites: %d exact and %d flipped/rotated duplicates. Report saved to %s\n",
+		report.Summary.SpritesScanned, report.Summary.Exact, report.Summary.Transformed, *outPath)
+}
+
+// findDuplicateSprites groups every used sprite under the lowest-numbered sprite it
+// copies. Blank sprites are not part of the spritesheet JSON and are never reported.
+func findDuplicateSprites(sheet *SpriteSheet, cells []MapCell, exactOnly bool) *DuplicateReport {
+	report := &DuplicateReport{
+		Version:     "1.0",
+		Description: "PICO-8 duplicate sprite report",
+		Groups:      make([]DuplicateGroup, 0),
+	}
+
+	cellsBySprite := make(map[int][]MapCell)
+	for _, cell := range cells {
+		cellsBySprite[cell.Sprite] = append(cellsBySprite[cell.Sprite], cell)
+	}
+
+	canonicalByHash := make(map[string]int)
+	groupIndex := make(map[int]int)
+	for _, sprite := range sheet.Sprites {
+		report.Summary.SpritesScanned++
+
+		canonical, transform := -1, ""
+		for _, t := range spriteTransforms {
+			if exactOnly && t.name != "identity" {
+				break
+			}
+			// t(sprite) == canonical means sprite is inverse(t) of the canonical one
+			if id, ok := canonicalByHash[pixelHash(t.apply(sprite.Pixels))]; ok {
+				canonical, transform = id, t.inverse
+				break
+			}
+		}
+		if canonical < 0 {
+			canonicalByHash[pixelHash(sprite.Pixels)] = sprite.ID
+			continue
+		}
+
+		idx, ok := groupIndex[canonical]
+		if !ok {
+			idx = len(report.Groups)
+			groupIndex[canonical] = idx
+			report.Groups = append(report.Groups, DuplicateGroup{Canonical: canonical})
+		}
+		mapCells := cellsBySprite[sprite.ID]
+		if mapCells == nil {
+			mapCells = make([]MapCell, 0)
+		}
+		report.Groups[idx].Duplicates = append(report.Groups[idx].Duplicates, SpriteDuplicate{
+			Sprite:    sprite.ID,
+			Transform: transform,
+			MapCells:  mapCells,
+		})
+		if transform == "identity" {
+			report.Summary.Exact++
+		} else {
+			report.Summary.Transformed++
+		}
+	}
+	return report
+}
+
+// pixelHash turns an 8x8 grid of color indices into a map key
+func pixelHash(pixels [][]int) string {
+	var b strings.Builder
+	for _, row := range pixels {
+		for _, c := range row {
+			b.WriteByte("0123456789abcdef"[c&0xf])
+		}
+	}
+	return b.String()
+}
+
+// remapPixels builds an 8x8 grid whose (x,y) pixel is taken from src at from(x,y)
+func remapPixels(src [][]int, from func(x, y int) (int, int)) [][]int {
+	dst := make([][]int, 8)
+	for y := range dst {
+		dst[y] = make([]int, 8)
+		for x := range dst[y] {
+			sx, sy := from(x, y)
+			dst[y][x] = src[sy][sx]
+		}
+	}
+	return dst
+}
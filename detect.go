@@ -0,0 +1,313 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// DualPurposeGuess is the outcome of guessing which halves of the shared
+// gfx/map memory hold map data
+type DualPurposeGuess struct {
+	UseSection3 bool     `json:"section3"`
+	UseSection4 bool     `json:"section4"`
+	Confidence  float64  `json:"confidence"` // 0.5 (coin toss) .. 1 (certain)
+	Reasons     []string `json:"reasons"`
+}
+
+// Flags formats the guess as the command line flags it stands for
+func (g DualPurposeGuess) Flags() string {
+	var flags []string
+	if g.UseSection3 {
+		flags = append(flags, "--3")
+	}
+	if g.UseSection4 {
+		flags = append(flags, "--4")
+	}
+	if len(flags) == 0 {
+		return "no --3/--4"
+	}
+	return strings.Join(flags, " ")
+}
+
+// sharedRegion describes one of the dual-purpose halves
+type sharedRegion struct {
+	name             string
+	section          int // 3 or 4
+	firstSprite      int // first sprite ID stored in the region
+	firstRow, endRow int // map rows the region holds
+}
+
+var sharedRegions = []sharedRegion{
+	{name: "section 3", section: 3, firstSprite: 128, firstRow: 32, endRow: 48},
+	{name: "section 4", section: 4, firstSprite: 192, firstRow: 48, endRow: 64},
+}
+
+// detectDualPurpose looks at gfx rows 64..127 both as pixels and as map cells,
+// and at how the code uses them, to guess the --3/--4 flags. Each region gets
+// a score: positive when it looks like map data, negative when it looks like
+// sprites.
+func detectDualPurpose(gfxData, mapData []string, calls map[string][]luaCall) DualPurposeGuess {
+	mem := newMemory(map[string][]string{"__gfx__": gfxData, "__map__": mapData})
+	guess := DualPurposeGuess{Confidence: 1}
+
+	// Sprites that have pixels, and tiles the upper map uses
+	var nonBlank [256]bool
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			if mem.Sget(x, y) != 0 {
+				nonBlank[y/8*16+x/8] = true
+			}
+		}
+	}
+	var upperTiles [256]bool
+	upperCells := 0
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 128; x++ {
+			if t := mem.Mget(x, y); t != 0 {
+				upperTiles[t] = true
+				upperCells++
+			}
+		}
+	}
+
+	for _, r := range sharedRegions {
+		score := 0.0
+		note := func(delta float64, format string, args ...any) {
+			score += delta
+			guess.Reasons = append(guess.Reasons, r.name+": "+fmt.Sprintf(format, args...))
+		}
+
+		var cells []byte
+		for y := r.firstRow; y < r.endRow; y++ {
+			for x := 0; x < 128; x++ {
+				if t := mem.Mget(x, y); t != 0 {
+					cells = append(cells, t)
+				}
+			}
+		}
+
+		codeScore := codeEvidence(calls, r, note)
+		if len(cells) == 0 && codeScore == 0 {
+			// Nothing to be wrong about, so this doesn't lower the confidence
+			note(0, "empty, so the flag makes no difference")
+			continue
+		}
+		if len(cells) == 0 {
+			guess.apply(r, score > 0, score)
+			continue
+		}
+
+		// Map cells name sprites that exist; pixel pairs mostly don't
+		valid := 0
+		for _, t := range cells {
+			if nonBlank[t] && !(int(t) >= r.firstSprite && int(t) < r.firstSprite+64) {
+				valid++
+			}
+		}
+		ratio := float64(valid) / float64(len(cells))
+		note((ratio-0.5)*4, "%.0f%% of %d non-zero bytes name drawn sprites outside this region", ratio*100, len(cells))
+
+		// Map data reuses the tiles of the upper map
+		if upperCells > 0 {
+			shared := 0
+			for _, t := range cells {
+				if upperTiles[t] {
+					shared++
+				}
+			}
+			ratio := float64(shared) / float64(len(cells))
+			note((ratio-0.5)*4, "%.0f%% of them are tiles the upper map also uses", ratio*100)
+		}
+
+		// Sprite art is vertically coherent: a pixel usually matches the one
+		// below it. As map data, consecutive gfx rows are the left and right
+		// halves of a map row, which have little to do with each other.
+		same, pairs := 0, 0
+		for y := r.firstSprite / 16 * 8; y < r.firstSprite/16*8+31; y++ {
+			for x := 0; x < 128; x++ {
+				a, b := mem.Sget(x, y), mem.Sget(x, y+1)
+				if a == 0 && b == 0 {
+					continue
+				}
+				pairs++
+				if a == b {
+					same++
+				}
+			}
+		}
+		if pairs > 0 {
+			ratio := float64(same) / float64(pairs)
+			note((0.5-ratio)*4, "%.0f%% of pixels match the pixel below (sprite art is usually above 50%%)", ratio*100)
+		}
+
+		guess.apply(r, score > 0, score)
+	}
+	return guess
+}
+
+// apply records the decision for a region; the overall confidence is that of
+// the least certain region
+func (g *DualPurposeGuess) apply(r sharedRegion, isMap bool, score float64) {
+	if r.section == 3 {
+		g.UseSection3 = isMap
+	} else {
+		g.UseSection4 = isMap
+	}
+	g.Confidence = math.Min(g.Confidence, 1/(1+math.Exp(-math.Abs(score))))
+}
+
+// luaCall is a call to a global function in a cart's code
+type luaCall struct {
+	Where string // file:line, with includes traced back to their files
+	Args  []lua.Expr
+}
+
+// findGlobalCalls collects the calls to the named global functions in a
+// parsed program, keyed by name
+func findGlobalCalls(block *lua.Block, program *resolvedProgram, names ...string) map[string][]luaCall {
+	calls := make(map[string][]luaCall)
+	lua.Inspect(block, func(n lua.Node) bool {
+		call, ok := n.(*lua.CallExpr)
+		if !ok {
+			return true
+		}
+		if fn, ok := call.Fn.(*lua.NameExpr); ok && slices.Contains(names, fn.Name) {
+			origin := program.origin(call.Line)
+			calls[fn.Name] = append(calls[fn.Name], luaCall{Where: fmt.Sprintf("%s:%d", origin.File, origin.Line), Args: call.Args})
+		}
+		return true
+	})
+	return calls
+}
+
+// intLiteral is the value of an argument written as a whole number
+func intLiteral(e lua.Expr) (int, bool) {
+	switch e := e.(type) {
+	case *lua.ParenExpr:
+		return intLiteral(e.Inner)
+	case *lua.UnaryExpr:
+		if e.Op == "-" {
+			n, ok := intLiteral(e.Operand)
+			return -n, ok
+		}
+	case *lua.NumberExpr:
+		if f := e.Value.Float(); f == math.Trunc(f) {
+			return int(f), true
+		}
+	}
+	return 0, false
+}
+
+// codeEvidence scores how the code uses a region: map(), mget() and mset()
+// reaching into its rows count for map data, spr() and sspr() on its sprites
+// count against. Only literal arguments are understood.
+func codeEvidence(calls map[string][]luaCall, r sharedRegion, note func(float64, string, ...any)) float64 {
+	total := 0.0
+	add := func(delta float64, format string, args ...any) {
+		total += delta
+		note(delta, format, args...)
+	}
+	inRows := func(y int) bool { return y >= r.firstRow && y < r.endRow }
+
+	for _, call := range calls["map"] {
+		if len(call.Args) < 2 {
+			continue
+		}
+		y, ok := intLiteral(call.Args[1])
+		if !ok {
+			continue
+		}
+		h := 32 // map() draws 32 rows unless told otherwise
+		if len(call.Args) >= 6 {
+			if n, ok := intLiteral(call.Args[5]); ok {
+				h = n
+			}
+		}
+		if y < r.endRow && y+h > r.firstRow {
+			add(3, "%s draws map rows %d..%d", call.Where, y, y+h-1)
+		}
+	}
+	for _, name := range []string{"mget", "mset"} {
+		for _, call := range calls[name] {
+			if len(call.Args) < 2 {
+				continue
+			}
+			if y, ok := intLiteral(call.Args[1]); ok && inRows(y) {
+				add(3, "%s calls %s on map row %d", call.Where, name, y)
+			}
+		}
+	}
+	for _, call := range calls["spr"] {
+		if len(call.Args) == 0 {
+			continue
+		}
+		if n, ok := intLiteral(call.Args[0]); ok && n >= r.firstSprite && n < r.firstSprite+64 {
+			add(-3, "%s draws sprite %d", call.Where, n)
+		}
+	}
+	for _, call := range calls["sspr"] {
+		if len(call.Args) < 2 {
+			continue
+		}
+		if y, ok := intLiteral(call.Args[1]); ok && y >= r.firstSprite/16*8 && y < r.firstSprite/16*8+32 {
+			add(-3, "%s stretches sprite sheet pixels from y=%d", call.Where, y)
+		}
+	}
+	return total
+}
+
+// detectCartDualPurpose runs the detection on a cart file. Code that can't be
+// loaded or parsed is left out of the evidence.
+func detectCartDualPurpose(cartPath string) DualPurposeGuess {
+	calls, err := cartCalls(cartPath)
+	guess := detectDualPurpose(parseSection(cartPath, "__gfx__"), parseSection(cartPath, "__map__"), calls)
+	if err != nil {
+		guess.Reasons = append(guess.Reasons, fmt.Sprintf("code ignored: %v", err))
+	}
+	return guess
+}
+
+// cartCalls parses a cart's code, includes resolved, for the calls the
+// detection looks at
+func cartCalls(cartPath string) (map[string][]luaCall, error) {
+	program, err := resolveProgram(cartPath)
+	if err != nil {
+		return nil, err
+	}
+	block, err := lua.Parse(program.Source())
+	if err != nil {
+		return nil, locateError(program, err)
+	}
+	return findGlobalCalls(block, program, "map", "mget", "mset", "spr", "sspr"), nil
+}
+
+// printGuess reports a guess and its reasoning
+func printGuess(w io.Writer, guess DualPurposeGuess) {
+	fmt.Fprintf(w, "Detected %s (confidence %.0f%%)\n", guess.Flags(), guess.Confidence*100)
+	for _, reason := range guess.Reasons {
+		fmt.Fprintf(w, "  - %s\n", reason)
+	}
+}
+
+// runDetect implements the "detect" subcommand, which only reports the guess
+func runDetect(args []string) {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 detect --cart <file.p8>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Guesses whether the lower half of the sprite sheet holds map data (--3/--4).")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	path := requireCart(fs, &cartOptions{path: *cartPath})
+	printGuess(os.Stdout, detectCartDualPurpose(path))
+}
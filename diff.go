@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// MapDiff is the map_diff.json output
+type MapDiff struct {
+	Version     string         `json:"version"`
+	Description string         `json:"description"`
+	Old         string         `json:"old"`
+	New         string         `json:"new"`
+	Changes     []CellChange   `json:"changes"`
+	Summary     MapDiffSummary `json:"summary"`
+}
+
+// CellChange is a map cell whose sprite differs between the two carts
+type CellChange struct {
+	X   int `json:"x"`
+	Y   int `json:"y"`
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// MapDiffSummary counts the changed cells by kind
+type MapDiffSummary struct {
+	Changed  int `json:"changed"`
+	Added    int `json:"added"`    // empty -> sprite
+	Removed  int `json:"removed"`  // sprite -> empty
+	Modified int `json:"modified"` // sprite -> other sprite
+}
+
+// highlightRed marks changed tiles in diff images
+var highlightRed = color.RGBA{255, 0, 0, 255}
+
+// runDiff implements the "diff" subcommand
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	useSection3 := fs.Bool("3", false, "Include dual-purpose section 3 (sprites 128..191)")
+	useSection4 := fs.Bool("4", false, "Include dual-purpose section 4 (sprites 192..255)")
+	mapMode := fs.Bool("map", false, "Compare the map cells and write map_diff.json/png")
+	gfxMode := fs.Bool("gfx", false, "Compare the sprite sheet pixels and sprite flags and write gfx_diff.json/png")
+	scale := fs.Int("scale", 2, "Integer scale factor for gfx_diff.png")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 diff [--map] [--gfx] [--3] [--4] old.p8 new.p8")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	oldPath, errOld := resolveCartPath(fs.Arg(0))
+	newPath, errNew := resolveCartPath(fs.Arg(1))
+	if errOld != nil || errNew != nil {
+		fmt.Fprintln(os.Stderr, "Error resolving cart paths")
+		os.Exit(1)
+	}
+
+	if !*mapMode && !*gfxMode {
+		runCartDiff(oldPath, newPath, *useSection3, *useSection4)
+		return
+	}
+	if *mapMode {
+		runMapDiff(oldPath, newPath, *useSection3, *useSection4)
+	}
+	if *gfxMode {
+		if *scale < 1 {
+			fmt.Fprintln(os.Stderr, "Error: --scale must be at least 1")
+			os.Exit(1)
+		}
+		runGfxDiff(oldPath, newPath, *useSection3, *useSection4, *scale)
+	}
+}
+
+// runMapDiff writes map_diff.json and map_diff.png and prints a summary
+func runMapDiff(oldPath, newPath string, useSection3, useSection4 bool) {
+	oldGrid, err := loadMapGrid(oldPath, useSection3, useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", oldPath, err)
+		os.Exit(1)
+	}
+	newGrid, err := loadMapGrid(newPath, useSection3, useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", newPath, err)
+		os.Exit(1)
+	}
+
+	diff := diffMapGrids(oldGrid, newGrid)
+	diff.Old, diff.New = oldPath, newPath
+
+	for _, change := range diff.Changes {
+		fmt.Printf("(%d,%d): %d -> %d\n", change.X, change.Y, change.Old, change.New)
+	}
+	fmt.Printf("%d cells changed: %d added, %d removed, %d modified\n",
+		diff.Summary.Changed, diff.Summary.Added, diff.Summary.Removed, diff.Summary.Modified)
+
+	data, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling map diff JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("map_diff.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving map_diff.json: %v\n", err)
+		os.Exit(1)
+	}
+
+	newGfx := parseSection(newPath, "__gfx__")
+	mapImage := renderMapLayers(newGrid, reconstructImage(newGfx), make([]int, 256), 0, false)
+	highlightTiles(mapImage, diff.Changes)
+	if err := saveAsPng(mapImage, "map_diff.png"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving map_diff.png: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated map_diff.json and map_diff.png")
+}
+
+// loadMapGrid parses a cart's map, including dual-purpose rows, into a dense grid
+func loadMapGrid(cartPath string, useSection3, useSection4 bool) ([][]int, error) {
+	if _, err := os.Stat(cartPath); err != nil {
+		return nil, err
+	}
+	mapSheet, err := generateMapJSON(parseSection(cartPath, "__map__"), parseSection(cartPath, "__gfx__"), useSection3, useSection4)
+	if err != nil {
+		return nil, err
+	}
+	return mapGrid(mapSheet), nil
+}
+
+// diffMapGrids lists every cell whose sprite changed, in row-major order
+func diffMapGrids(oldGrid, newGrid [][]int) *MapDiff {
+	diff := &MapDiff{
+		Version:     "1.0",
+		Description: "PICO-8 map diff",
+		Changes:     make([]CellChange, 0),
+	}
+	for y := range newGrid {
+		for x := range newGrid[y] {
+			before, after := oldGrid[y][x], newGrid[y][x]
+			if before == after {
+				continue
+			}
+			diff.Changes = append(diff.Changes, CellChange{X: x, Y: y, Old: before, New: after})
+			diff.Summary.Changed++
+			switch {
+			case before == 0:
+				diff.Summary.Added++
+			case after == 0:
+				diff.Summary.Removed++
+			default:
+				diff.Summary.Modified++
+			}
+		}
+	}
+	return diff
+}
+
+// highlightTiles tints changed tiles red and outlines them
+func highlightTiles(img *image.RGBA, changes []CellChange) {
+	const tileSize = 8
+	tint := color.RGBA{255, 0, 0, 128}
+	for _, change := range changes {
+		x0, y0 := change.X*tileSize, change.Y*tileSize
+		for yy := 0; yy < tileSize; yy++ {
+			for xx := 0; xx < tileSize; xx++ {
+				if xx == 0 || yy == 0 || xx == tileSize-1 || yy == tileSize-1 {
+					img.SetRGBA(x0+xx, y0+yy, highlightRed)
+				} else {
+					img.SetRGBA(x0+xx, y0+yy, blendRGBA(img.RGBAAt(x0+xx, y0+yy), tint))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package fixed implements PICO-8's only number type: signed 16.16 fixed point.
+//
+// Every operation wraps around on overflow the way PICO-8 does, so the results
+// match what a cart computes on the real console bit for bit.
+package fixed
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Fixed is a signed 16.16 fixed point number: the upper 16 bits hold the
+// integer part and the lower 16 bits the fraction
+type Fixed int32
+
+const (
+	// One is 1.0
+	One Fixed = 1 << 16
+	// Max is 0x7fff.ffff, the largest number (32767.99998)
+	Max Fixed = math.MaxInt32
+	// Min is 0x8000.0000, the smallest number (-32768)
+	Min Fixed = math.MinInt32
+)
+
+// FromInt converts an integer, wrapping outside -32768..32767
+func FromInt(i int) Fixed { return Fixed(int32(i << 16)) }
+
+// FromFloat converts a float, rounding to the nearest 1/65536 and wrapping
+// outside -32768..32767
+func FromFloat(f float64) Fixed {
+	f = math.Round(f * 65536)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	if math.Abs(f) >= 1<<62 {
+		f = math.Mod(f, 1<<32)
+	}
+	return Fixed(int32(int64(f)))
+}
+
+// FromBits reinterprets raw 32-bit data, as peek4 does
+func FromBits(b uint32) Fixed { return Fixed(int32(b)) }
+
+// Bits returns the raw 32-bit representation
+func (x Fixed) Bits() uint32 { return uint32(x) }
+
+// Float returns the value as a float64; the conversion is exact
+func (x Fixed) Float() float64 { return float64(x) / 65536 }
+
+// Int returns the integer part, rounded towards negative infinity like flr()
+func (x Fixed) Int() int { return int(x >> 16) }
+
+// Frac returns the fractional bits
+func (x Fixed) Frac() uint16 { return uint16(x) }
+
+// Add is a + b
+func (x Fixed) Add(y Fixed) Fixed { return x + y }
+
+// Sub is a - b
+func (x Fixed) Sub(y Fixed) Fixed { return x - y }
+
+// Neg is -x; -0x8000 stays 0x8000
+func (x Fixed) Neg() Fixed { return -x }
+
+// Mul is a * b; the low bits of the 32.32 product are dropped
+func (x Fixed) Mul(y Fixed) Fixed { return Fixed(int32((int64(x) * int64(y)) >> 16)) }
+
+// Div is a / b, truncated towards zero. Quotients out of range saturate
+// instead of wrapping: to Max, or -Max when negative, which is also what
+// dividing by zero gives.
+func (x Fixed) Div(y Fixed) Fixed {
+	if y == 0 {
+		if x < 0 {
+			return -Max
+		}
+		return Max
+	}
+	q := (int64(x) << 16) / int64(y)
+	switch {
+	case q > int64(Max):
+		return Max
+	case q < int64(Min):
+		return -Max
+	}
+	return Fixed(q)
+}
+
+// IntDiv is a \ b, the floor of the quotient. Dividing by zero behaves like
+// Div, and out of range quotients saturate to 32767 or -32768, the floors of
+// Max and -Max.
+func (x Fixed) IntDiv(y Fixed) Fixed {
+	if y == 0 {
+		return x.Div(y)
+	}
+	a, b := int64(x), int64(y)
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return FromInt(int(min(max(q, -32768), 32767)))
+}
+
+// Mod is a % b = a - flr(a/b)*b, so the result has the sign of b. The one
+// exception is x % 0, which is 0 rather than x.
+func (x Fixed) Mod(y Fixed) Fixed {
+	if y == 0 {
+		return 0
+	}
+	r := int64(x) % int64(y)
+	if r != 0 && (r < 0) != (y < 0) {
+		r += int64(y)
+	}
+	return Fixed(int32(r))
+}
+
+// Pow is a ^ b
+func (x Fixed) Pow(y Fixed) Fixed { return FromFloat(math.Pow(x.Float(), y.Float())) }
+
+// Flr rounds towards negative infinity
+func (x Fixed) Flr() Fixed { return x &^ 0xffff }
+
+// Ceil rounds towards positive infinity
+func (x Fixed) Ceil() Fixed { return -(-x).Flr() }
+
+// Abs is the absolute value; abs(-32768) wraps to -32768
+func (x Fixed) Abs() Fixed {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// And, Or, Xor and Not work on all 32 bits, fraction included
+func (x Fixed) And(y Fixed) Fixed { return x & y }
+func (x Fixed) Or(y Fixed) Fixed  { return x | y }
+func (x Fixed) Xor(y Fixed) Fixed { return x ^ y }
+func (x Fixed) Not() Fixed        { return ^x }
+
+// Shl is x << n and shl(x, n). Shifting by 32 or more gives 0; negative
+// amounts shift right.
+func (x Fixed) Shl(n int) Fixed {
+	switch {
+	case n < 0:
+		return x.Shr(-n)
+	case n >= 32:
+		return 0
+	}
+	return x << n
+}
+
+// Shr is x >> n and shr(x, n): an arithmetic shift that keeps the sign.
+// Negative amounts shift left.
+func (x Fixed) Shr(n int) Fixed {
+	switch {
+	case n < 0:
+		return x.Shl(-n)
+	case n >= 32:
+		return x >> 31
+	}
+	return x >> n
+}
+
+// Lshr is x >>> n and lshr(x, n): a logical shift that fills with zeros
+func (x Fixed) Lshr(n int) Fixed {
+	switch {
+	case n < 0:
+		return x.Shl(-n)
+	case n >= 32:
+		return 0
+	}
+	return Fixed(int32(uint32(x) >> n))
+}
+
+// Rotl is x <<> n and rotl(x, n); only the low five bits of n count
+func (x Fixed) Rotl(n int) Fixed { return Fixed(int32(bits.RotateLeft32(uint32(x), n&31))) }
+
+// Rotr is x >>< n and rotr(x, n)
+func (x Fixed) Rotr(n int) Fixed { return Fixed(int32(bits.RotateLeft32(uint32(x), -(n & 31)))) }
+
+// String formats the number the way print() and tostr() do: rounded to four
+// decimals with trailing zeros dropped, e.g. 0.1, 0.3333 or -32768
+func (x Fixed) String() string {
+	if x.Frac() == 0 {
+		return strconv.Itoa(x.Int())
+	}
+	f := x.Float()
+	if math.Abs(f) > 32767.9999 {
+		// Rounding up would leave the number range, so 0x7fff.ffff prints
+		// as 32767.9999 rather than 32768
+		f = math.Copysign(32767.9999, f)
+	}
+	s := strconv.FormatFloat(f, 'f', 4, 64)
+	s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// Hex formats the raw bits as tostr(x, true) does, e.g. 0x0001.8000
+func (x Fixed) Hex() string {
+	return fmt.Sprintf("0x%04x.%04x", uint32(x)>>16, uint32(x)&0xffff)
+}
+
+// Parse reads a number the way tonum() does: surrounding whitespace, an
+// optional minus sign, then a decimal, 0x hex or 0b binary number. Hex and
+// binary numbers may have a fractional part (0x.8, 0b1.1); anything past 16
+// fraction bits is dropped and integer parts wrap like arithmetic does.
+func Parse(s string) (Fixed, bool) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	x, ok := ParseLiteral(s)
+	if neg {
+		x = -x
+	}
+	return x, ok
+}
+
+// ParseLiteral reads an unsigned numeric literal as the Lua lexer sees it
+func ParseLiteral(s string) (Fixed, bool) {
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			return parseRadix(s[2:], 4)
+		case 'b', 'B':
+			return parseRadix(s[2:], 1)
+		}
+	}
+	// Only digits, a point and an exponent; ParseFloat would also take inf,
+	// underscores and a leading plus
+	if s == "" || strings.Trim(s, "0123456789.eE+-") != "" || s[0] == '+' || s[0] == '-' {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return FromFloat(f), true
+}
+
+// parseRadix reads the digits after 0x or 0b, each worth bitsPerDigit bits
+func parseRadix(s string, bitsPerDigit uint) (Fixed, bool) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, false
+	}
+	base := 1 << bitsPerDigit
+	var v uint64
+	for _, c := range intPart {
+		d := digitValue(c)
+		if d < 0 || d >= base {
+			return 0, false
+		}
+		v = v<<bitsPerDigit | uint64(d) // overflowing digits wrap out the top
+	}
+	v <<= 16
+	shift := 16
+	for _, c := range fracPart {
+		d := digitValue(c)
+		if d < 0 || d >= base {
+			return 0, false
+		}
+		shift -= int(bitsPerDigit)
+		if shift >= 0 {
+			v |= uint64(d) << shift
+		}
+	}
+	return Fixed(int32(uint32(v))), true
+}
+
+func digitValue(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
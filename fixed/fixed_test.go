@@ -0,0 +1,254 @@
+package fixed
+
+import "testing"
+
+func TestParseLiteral(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Fixed
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"42", FromInt(42), true},
+		{"0.5", 0x8000, true},
+		{"32767", FromInt(32767), true},
+		{"32768", Min, true}, // wraps like arithmetic
+		{"65536", 0, true},
+		{"0x10", FromInt(16), true},
+		{"0XfF", FromInt(255), true},
+		{"0x.8", 0x8000, true},
+		{"0x1.4", 0x14000, true},
+		{"0x.0001", 1, true},
+		{"0x.00008", 0, true}, // past 16 fraction bits
+		{"0x7fff.ffff", Max, true},
+		{"0x8000", Min, true},
+		{"0xffff", FromInt(-1), true},
+		{"0x12345", FromInt(0x2345), true}, // the top digit wraps out
+		{"0b101", FromInt(5), true},
+		{"0b1.1", 0x18000, true},
+		{"0b.01", 0x4000, true},
+		{"0b10000000000000001", FromInt(1), true},
+		{"", 0, false},
+		{"0x", 0, false},
+		{"0x.", 0, false},
+		{"0xg", 0, false},
+		{"0b2", 0, false},
+		{"+1", 0, false},
+		{"-1", 0, false},
+		{"inf", 0, false},
+		{"1_000", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseLiteral(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("ParseLiteral(%q) = %s, %v; want %s, %v", tt.in, got.Hex(), ok, tt.want.Hex(), tt.ok)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		x, y, want Fixed
+	}{
+		{FromInt(2), FromInt(3), FromInt(6)},
+		{0x8000, 0x8000, 0x4000},       // 0.5 * 0.5 = 0.25
+		{FromInt(-1), 0x8000, -0x8000}, // -1 * 0.5
+		{FromInt(-3), FromInt(-4), FromInt(12)},
+		{FromInt(256), FromInt(256), 0}, // 65536 wraps to 0
+		{FromInt(200), FromInt(200), FromInt(-25536)},
+		{1, 1, 0}, // 0x.0001 squared is below the smallest fraction
+		{Max, One, Max},
+	}
+	for _, tt := range tests {
+		if got := tt.x.Mul(tt.y); got != tt.want {
+			t.Errorf("%s * %s = %s; want %s", tt.x.Hex(), tt.y.Hex(), got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		x, y, want Fixed
+	}{
+		{FromInt(6), FromInt(3), FromInt(2)},
+		{One, FromInt(3), 0x5555},          // 0.3333, truncated
+		{FromInt(-1), FromInt(3), -0x5555}, // towards zero
+		{One, FromInt(2), 0x8000},
+		{FromInt(7), FromInt(-2), -0x38000}, // -3.5
+		{FromInt(32767), 0x8000, Max},       // 65534 saturates
+		{FromInt(16384), 0x8000, Max},
+		{One, 1, Max},
+		{FromInt(-16385), 0x8000, -Max},
+		{FromInt(-16384), 0x8000, Min}, // -32768 fits
+		{Min, One, Min},
+		{Min, FromInt(-1), Max},
+		{One, 0, Max},
+		{FromInt(-1), 0, -Max},
+		{Min, 0, -Max},
+	}
+	for _, tt := range tests {
+		if got := tt.x.Div(tt.y); got != tt.want {
+			t.Errorf("%s / %s = %s; want %s", tt.x.Hex(), tt.y.Hex(), got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestIntDiv(t *testing.T) {
+	tests := []struct {
+		x, y, want Fixed
+	}{
+		{FromInt(7), FromInt(2), FromInt(3)},
+		{FromInt(-7), FromInt(2), FromInt(-4)}, // floor, not truncation
+		{FromInt(7), FromInt(-2), FromInt(-4)},
+		{FromInt(-7), FromInt(-2), FromInt(3)},
+		{FromInt(6), FromInt(3), FromInt(2)},
+		{0x78000, One, FromInt(7)},               // 7.5 \ 1
+		{FromInt(-1), 0x8000, FromInt(-2)},       // -1 \ 0.5
+		{FromInt(16384), 0x8000, FromInt(32767)}, // saturates
+		{FromInt(-16385), 0x8000, Min},
+		{One, 0, Max},
+		{FromInt(-1), 0, -Max},
+	}
+	for _, tt := range tests {
+		if got := tt.x.IntDiv(tt.y); got != tt.want {
+			t.Errorf("%s \\ %s = %s; want %s", tt.x.Hex(), tt.y.Hex(), got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestMod(t *testing.T) {
+	tests := []struct {
+		x, y, want Fixed
+	}{
+		{FromInt(7), FromInt(3), One},
+		{FromInt(-7), FromInt(3), FromInt(2)}, // the sign of the divisor
+		{FromInt(7), FromInt(-3), FromInt(-2)},
+		{FromInt(-7), FromInt(-3), FromInt(-1)},
+		{FromInt(6), FromInt(3), 0},
+		{0x58000, FromInt(2), 0x18000}, // 5.5 % 2 = 1.5
+		{FromInt(-1), 0x8000, 0},
+		{0x4000, One, 0x4000},
+		{-0x4000, One, 0xc000}, // -0.25 % 1 = 0.75
+		{FromInt(5), 0, 0},     // not 5, as a - flr(a/0)*0 would give
+		{FromInt(-5), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.x.Mod(tt.y); got != tt.want {
+			t.Errorf("%s %% %s = %s; want %s", tt.x.Hex(), tt.y.Hex(), got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Fixed
+		ok   bool
+	}{
+		{"12", FromInt(12), true},
+		{"-12", FromInt(-12), true},
+		{"-0.5", -0x8000, true},
+		{"-0x10", FromInt(-16), true},
+		{"-0b11", FromInt(-3), true},
+		{" 12 ", FromInt(12), true},
+		{"\t-3\n", FromInt(-3), true},
+		{"-32768", Min, true},
+		{"32768", Min, true},
+		{"0x.8", 0x8000, true},
+		{"", 0, false},
+		{" ", 0, false},
+		{"-", 0, false},
+		{"--1", 0, false},
+		{"- 1", 0, false},
+		{"+1", 0, false},
+		{"1 2", 0, false},
+		{"12px", 0, false},
+		{"0x", 0, false},
+		{"abc", 0, false},
+		{"nan", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("tonum(%q) = %s, %v; want %s, %v", tt.in, got.Hex(), ok, tt.want.Hex(), tt.ok)
+		}
+	}
+}
+
+func TestShifts(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Fixed
+		want Fixed
+	}{
+		{"1 << 4", One.Shl(4), FromInt(16)},
+		{"0.5 << 1", Fixed(0x8000).Shl(1), One},
+		{"1 << 15", One.Shl(15), Min},
+		{"1 << 16", One.Shl(16), 0},
+		{"1 << 32", One.Shl(32), 0},
+		{"1 >> 1", One.Shr(1), 0x8000},
+		{"-8 >> 1", FromInt(-8).Shr(1), FromInt(-4)},
+		{"-1 >> 32", FromInt(-1).Shr(32), FromBits(0xffffffff)},
+		{"-1 >>> 16", FromInt(-1).Lshr(16), 0xffff},
+		{"-1 >>> 32", FromInt(-1).Lshr(32), 0},
+		{"1 <<> 16", One.Rotl(16), 1},
+		{"1 >>< 17", One.Rotr(17), FromBits(0x80000000)},
+		{"0x8000 <<> 1", Min.Rotl(1), 1},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.name, tt.got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		x    Fixed
+		want string
+	}{
+		{0, "0"},
+		{One, "1"},
+		{FromInt(-1), "-1"},
+		{FromInt(32767), "32767"},
+		{Min, "-32768"},
+		{0x8000, "0.5"},
+		{-0x8000, "-0.5"},
+		{0x14000, "1.25"},
+		{FromFloat(0.1), "0.1"},
+		{One.Div(FromInt(3)), "0.3333"},
+		{FromInt(2).Div(FromInt(3)), "0.6667"},
+		{FromInt(-1).Div(FromInt(3)), "-0.3333"},
+		{1, "0"},
+		{-1, "0"},
+		{0xffff, "1"},
+		{Max, "32767.9999"},
+		{-Max, "-32767.9999"},
+		{FromInt(32767).Add(0xfff0), "32767.9998"},
+		{FromInt(-32767), "-32767"},
+	}
+	for _, tt := range tests {
+		if got := tt.x.String(); got != tt.want {
+			t.Errorf("tostr(%s) = %q; want %q", tt.x.Hex(), got, tt.want)
+		}
+	}
+}
+
+func TestHex(t *testing.T) {
+	tests := []struct {
+		x    Fixed
+		want string
+	}{
+		{0, "0x0000.0000"},
+		{One, "0x0001.0000"},
+		{0x18000, "0x0001.8000"},
+		{FromInt(-1), "0xffff.0000"},
+		{Max, "0x7fff.ffff"},
+		{Min, "0x8000.0000"},
+	}
+	for _, tt := range tests {
+		if got := tt.x.Hex(); got != tt.want {
+			t.Errorf("tostr(%#08x, true) = %q; want %q", tt.x.Bits(), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+// FlagLayerSheet is the flags.json output
+type FlagLayerSheet struct {
+	Version     string      `json:"version"`
+	Description string      `json:"description"`
+	Width       int         `json:"width"`
+	Height      int         `json:"height"`
+	Layers      []FlagLayer `json:"layers"`
+}
+
+// FlagLayer marks the map cells whose sprite has one flag bit set
+type FlagLayer struct {
+	Bit      int        `json:"bit"`
+	Count    int        `json:"count"`    // number of cells with the bit set
+	Grid     [][]bool   `json:"grid"`     // [y][x]
+	Rects    []TileRect `json:"rects"`    // the set cells merged into larger boxes
+	Filename string     `json:"filename"` // 1-bit mask PNG
+}
+
+// runFlags implements the "flags" subcommand
+func runFlags(args []string) {
+	fs := flag.NewFlagSet("flags", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	scale := fs.Int("scale", 1, "Pixels per tile in the mask PNGs (8 matches map.png)")
+	outDir := fs.String("out", "flags", "Output directory for the mask PNGs")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	if *scale < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --scale must be at least 1")
+		os.Exit(1)
+	}
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	mapData := parseSection(cartPath, "__map__")
+	if len(mapData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __map__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	mapSheet, err := generateMapJSON(mapData, gfxData, opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	sheet := generateFlagLayers(mapGrid(mapSheet), parseFlagSection(cartPath))
+	for i := range sheet.Layers {
+		layer := &sheet.Layers[i]
+		layer.Filename = fmt.Sprintf("flag_%d.png", layer.Bit)
+		path := filepath.Join(*outDir, layer.Filename)
+		if err := saveAsPng(renderFlagMask(layer.Grid, *scale), path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("flag %d: %d cells in %d rects\n", layer.Bit, layer.Count, len(layer.Rects))
+	}
+	fmt.Printf("Saved %d flag masks into '%s' folder.\n", len(sheet.Layers), *outDir)
+
+	data, err := json.MarshalIndent(sheet, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling flags JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("flags.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving flags.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated flags.json")
+}
+
+// generateFlagLayers builds one layer per flag bit from the map grid and __gff__ data
+func generateFlagLayers(grid [][]int, flagData []int) *FlagLayerSheet {
+	height, width := len(grid), len(grid[0])
+	sheet := &FlagLayerSheet{
+		Version:     "1.0",
+		Description: "PICO-8 map flag layers",
+		Width:       width,
+		Height:      height,
+		Layers:      make([]FlagLayer, 0, 8),
+	}
+
+	for bit := 0; bit < 8; bit++ {
+		layer := FlagLayer{Bit: bit, Grid: flagMask(grid, flagData, 1<<bit)}
+		for _, row := range layer.Grid {
+			for _, set := range row {
+				if set {
+					layer.Count++
+				}
+			}
+		}
+		layer.Rects = greedyMesh(layer.Grid)
+		sheet.Layers = append(sheet.Layers, layer)
+	}
+	return sheet
+}
+
+// flagMask marks the cells whose sprite flags intersect mask, like fget(mget(x,y)) & mask
+func flagMask(grid [][]int, flagData []int, mask int) [][]bool {
+	out := make([][]bool, len(grid))
+	for y, row := range grid {
+		out[y] = make([]bool, len(row))
+		for x, id := range row {
+			out[y][x] = flagData[id]&mask != 0
+		}
+	}
+	return out
+}
+
+// greedyMesh covers the set cells with few, large rectangles: each rectangle
+// grows right as far as it can, then down while the whole span stays set.
+func greedyMesh(mask [][]bool) []TileRect {
+	height := len(mask)
+	used := make([][]bool, height)
+	for y := range used {
+		used[y] = make([]bool, len(mask[y]))
+	}
+	free := func(x, y int) bool {
+		return mask[y][x] && !used[y][x]
+	}
+
+	rects := make([]TileRect, 0)
+	for y := 0; y < height; y++ {
+		width := len(mask[y])
+		for x := 0; x < width; x++ {
+			if !free(x, y) {
+				continue
+			}
+			w := 1
+			for x+w < width && free(x+w, y) {
+				w++
+			}
+			h := 1
+			for y+h < height && rowFree(free, x, y+h, w) {
+				h++
+			}
+			for yy := y; yy < y+h; yy++ {
+				for xx := x; xx < x+w; xx++ {
+					used[yy][xx] = true
+				}
+			}
+			rects = append(rects, TileRect{X: x, Y: y, W: w, H: h})
+		}
+	}
+	return rects
+}
+
+// rowFree reports whether w cells starting at (x,y) are all free
+func rowFree(free func(x, y int) bool, x, y, w int) bool {
+	for xx := x; xx < x+w; xx++ {
+		if !free(xx, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderFlagMask draws a 1-bit image with white for set cells
+func renderFlagMask(mask [][]bool, scale int) *image.Paletted {
+	height, width := len(mask), len(mask[0])
+	palette := color.Palette{color.Black, color.White}
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), palette)
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			if mask[y/scale][x/scale] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// fontGlyphs is the PICO-8 3x5 font, five rows of three pixels per character.
+// Upper case letters use the same shapes as lower case ones.
+var fontGlyphs = map[byte]string{
+	'0': "### #.# #.# #.# ###", '1': "##. .#. .#. .#. ###", '2': "### ..# ### #.. ###",
+	'3': "### ..# .## ..# ###", '4': "#.# #.# ### ..# ..#", '5': "### #.. ### ..# ###",
+	'6': "#.. #.. ### #.# ###", '7': "### ..# ..# ..# ..#", '8': "### #.# ### #.# ###",
+	'9': "### #.# ### ..# ..#",
+
+	'a': "### #.# ### #.# #.#", 'b': "### #.# ##. #.# ###", 'c': "### #.. #.. #.. ###",
+	'd': "##. #.# #.# #.# ###", 'e': "### #.. ##. #.. ###", 'f': "### #.. ##. #.. #..",
+	'g': "### #.. #.. #.# ###", 'h': "#.# #.# ### #.# #.#", 'i': "### .#. .#. .#. ###",
+	'j': "### .#. .#. .#. ##.", 'k': "#.# #.# ##. #.# #.#", 'l': "#.. #.. #.. #.. ###",
+	'm': "### ### #.# #.# #.#", 'n': "##. #.# #.# #.# #.#", 'o': ".## #.# #.# #.# ##.",
+	'p': "### #.# ### #.. #..", 'q': ".#. #.# #.# ##. .##", 'r': "### #.# ##. #.# #.#",
+	's': ".## #.. ### ..# ##.", 't': "### .#. .#. .#. .#.", 'u': "#.# #.# #.# #.# .##",
+	'v': "#.# #.# #.# ### .#.", 'w': "#.# #.# #.# ### ###", 'x': "#.# #.# .#. #.# #.#",
+	'y': "#.# #.# ### ..# ###", 'z': "### ..# .#. #.. ###",
+
+	' ': "... ... ... ... ...", '!': ".#. .#. .#. ... .#.", '"': "#.# #.# ... ... ...",
+	'#': "#.# ### #.# ### #.#", '$': "### ##. ### .## ###", '%': "#.# ..# .#. #.. #.#",
+	'&': "##. ##. ### #.# ###", '\'': ".#. #.. ... ... ...", '(': ".#. #.. #.. #.. .#.",
+	')': ".#. ..# ..# ..# .#.", '*': "#.# .#. ### .#. #.#", '+': "... .#. ### .#. ...",
+	',': "... ... ... .#. #..", '-': "... ... ### ... ...", '.': "... ... ... ... .#.",
+	'/': "..# .#. .#. .#. #..", ':': "... .#. ... .#. ...", ';': "... .#. ... .#. #..",
+	'<': "..# .#. #.. .#. ..#", '=': "... ### ... ### ...", '>': "#.. .#. ..# .#. #..",
+	'?': "### ..# .## ... .#.", '@': ".#. #.# #.# #.. .##", '[': "##. #.. #.. #.. ##.",
+	'\\': "#.. .#. .#. .#. ..#", ']': ".## ..# ..# ..# .##", '^': ".#. #.# ... ... ...",
+	'_': "... ... ... ... ###", '`': ".#. ..# ... ... ...", '{': ".## .#. ##. .#. .##",
+	'|': ".#. .#. .#. .#. .#.", '}': "##. .#. .## .#. ##.", '~': "... ..# ### #.. ...",
+}
+
+// glyphRows returns the five rows of a character's glyph, or nil for characters
+// the font has no shape for
+func glyphRows(c byte) []string {
+	if c >= 'A' && c <= 'Z' {
+		c += 'a' - 'A'
+	}
+	glyph, ok := fontGlyphs[c]
+	if !ok {
+		return nil
+	}
+	return strings.Fields(glyph)
+}
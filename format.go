@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// runFmt implements the "fmt" subcommand
+func runFmt(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	indent := fs.Int("indent", 1, "Spaces per indentation level")
+	check := fs.Bool("check", false, "Only report whether the cart is formatted; exit 1 if it isn't")
+	outPath := fs.String("out", "", "Write the cart here instead of over --cart")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 fmt --cart <file.p8> [--indent <n>] [--check] [--out <file.p8>]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Rewrites the __lua__ section in a canonical layout without changing its token count.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	path := requireCart(fs, &cartOptions{path: *cartPath})
+	if *indent < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --indent can't be negative")
+		os.Exit(1)
+	}
+
+	cart, err := readCartFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	code, _ := cart.section("__lua__")
+	formatted, err := lua.Format(strings.Join(code, "\n"), strings.Repeat(" ", *indent))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error formatting %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	var lines []string
+	if formatted != "" {
+		lines = strings.Split(strings.TrimSuffix(formatted, "\n"), "\n")
+	}
+	changed := !slices.Equal(code, lines)
+
+	if *check {
+		if changed {
+			fmt.Printf("%s is not formatted\n", path)
+			os.Exit(1)
+		}
+		return
+	}
+	target := *outPath
+	if target == "" {
+		if !changed {
+			return
+		}
+		target = path
+	}
+	cart.setSection("__lua__", lines)
+	if err := os.WriteFile(target, []byte(cart.String()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", target, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Formatted %s\n", target)
+}
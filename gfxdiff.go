@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+)
+
+// GfxDiff is the gfx_diff.json output
+type GfxDiff struct {
+	Version     string         `json:"version"`
+	Description string         `json:"description"`
+	Old         string         `json:"old"`
+	New         string         `json:"new"`
+	Sprites     []SpriteChange `json:"sprites"`
+	Flags       []FlagChange   `json:"flags"`
+	Summary     GfxDiffSummary `json:"summary"`
+}
+
+// SpriteChange is a sprite with at least one changed pixel
+type SpriteChange struct {
+	ID            int `json:"id"`
+	ChangedPixels int `json:"changedPixels"`
+}
+
+// FlagChange is a sprite whose __gff__ flag byte changed
+type FlagChange struct {
+	ID      int   `json:"id"`
+	Old     int   `json:"old"`
+	New     int   `json:"new"`
+	Set     []int `json:"set"`     // flag bits turned on
+	Cleared []int `json:"cleared"` // flag bits turned off
+}
+
+// GfxDiffSummary totals the sprite sheet changes
+type GfxDiffSummary struct {
+	ChangedSprites int `json:"changedSprites"`
+	ChangedPixels  int `json:"changedPixels"`
+	ChangedFlags   int `json:"changedFlags"`
+}
+
+// runGfxDiff writes gfx_diff.json and gfx_diff.png and prints the changed sprites and flags
+func runGfxDiff(oldPath, newPath string, useSection3, useSection4 bool, scale int) {
+	for _, path := range []string{oldPath, newPath} {
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	oldPixels := sheetPixels(parseSection(oldPath, "__gfx__"))
+	newPixels := sheetPixels(parseSection(newPath, "__gfx__"))
+
+	diff := diffSpriteSheets(oldPixels, newPixels, parseFlagSection(oldPath), parseFlagSection(newPath), useSection3, useSection4)
+	diff.Old, diff.New = oldPath, newPath
+
+	for _, change := range diff.Sprites {
+		fmt.Printf("sprite %3d: %d pixels changed\n", change.ID, change.ChangedPixels)
+	}
+	for _, change := range diff.Flags {
+		fmt.Printf("sprite %3d flags: 0x%02x -> 0x%02x (set %v, cleared %v)\n", change.ID, change.Old, change.New, change.Set, change.Cleared)
+	}
+	fmt.Printf("%d sprites changed (%d pixels), %d flag bytes changed\n",
+		diff.Summary.ChangedSprites, diff.Summary.ChangedPixels, diff.Summary.ChangedFlags)
+
+	data, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling gfx diff JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("gfx_diff.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving gfx_diff.json: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := saveAsPng(scaleImage(renderGfxDiff(oldPixels, newPixels), scale), "gfx_diff.png"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving gfx_diff.png: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated gfx_diff.json and gfx_diff.png")
+}
+
+// diffSpriteSheets compares pixels sprite by sprite and flags byte by byte.
+// Sprites that hold map data under --3/--4 are left to the map diff.
+func diffSpriteSheets(oldPixels, newPixels [][]int, oldFlags, newFlags []int, useSection3, useSection4 bool) *GfxDiff {
+	diff := &GfxDiff{
+		Version:     "1.0",
+		Description: "PICO-8 spritesheet diff",
+		Sprites:     make([]SpriteChange, 0),
+		Flags:       make([]FlagChange, 0),
+	}
+
+	for id := 0; id < 256; id++ {
+		if !spriteAvailable(id, useSection3, useSection4) {
+			continue
+		}
+		x0, y0 := (id%16)*8, (id/16)*8
+		changed := 0
+		for y := y0; y < y0+8; y++ {
+			for x := x0; x < x0+8; x++ {
+				if oldPixels[y][x] != newPixels[y][x] {
+					changed++
+				}
+			}
+		}
+		if changed > 0 {
+			diff.Sprites = append(diff.Sprites, SpriteChange{ID: id, ChangedPixels: changed})
+			diff.Summary.ChangedSprites++
+			diff.Summary.ChangedPixels += changed
+		}
+
+		if oldFlags[id] != newFlags[id] {
+			change := FlagChange{ID: id, Old: oldFlags[id], New: newFlags[id], Set: make([]int, 0), Cleared: make([]int, 0)}
+			for bit := 0; bit < 8; bit++ {
+				before, after := oldFlags[id]&(1<<bit) != 0, newFlags[id]&(1<<bit) != 0
+				switch {
+				case after && !before:
+					change.Set = append(change.Set, bit)
+				case before && !after:
+					change.Cleared = append(change.Cleared, bit)
+				}
+			}
+			diff.Flags = append(diff.Flags, change)
+			diff.Summary.ChangedFlags++
+		}
+	}
+	return diff
+}
+
+// renderGfxDiff lays out old, new and an overlay side by side. The overlay is the
+// new sheet dimmed, with changed pixels in red and changed sprites outlined.
+func renderGfxDiff(oldPixels, newPixels [][]int) *image.RGBA {
+	const size = 16 * 8
+	const gap = 4
+	out := image.NewRGBA(image.Rect(0, 0, size*3+gap*2, size))
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.RGBA{64, 64, 64, 255}), image.Point{}, draw.Src)
+
+	dim := color.RGBA{0, 0, 0, 160}
+	changedSprites := make(map[int]bool)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			before := pico8Palette[oldPixels[y][x]]
+			after := pico8Palette[newPixels[y][x]]
+			out.SetRGBA(x, y, before)
+			out.SetRGBA(size+gap+x, y, after)
+			overlay := blendRGBA(after, dim)
+			if oldPixels[y][x] != newPixels[y][x] {
+				overlay = highlightRed
+				changedSprites[(y/8)*16+x/8] = true
+			}
+			out.SetRGBA(2*(size+gap)+x, y, overlay)
+		}
+	}
+
+	// Outline changed sprites in the overlay so single-pixel edits are easy to spot
+	outline := color.RGBA{255, 236, 39, 255}
+	for id := range changedSprites {
+		x0, y0 := 2*(size+gap)+(id%16)*8, (id/16)*8
+		for i := 0; i < 8; i++ {
+			for _, p := range []image.Point{{x0 + i, y0}, {x0 + i, y0 + 7}, {x0, y0 + i}, {x0 + 7, y0 + i}} {
+				if out.RGBAAt(p.X, p.Y) != highlightRed {
+					out.SetRGBA(p.X, p.Y, outline)
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tabSeparator starts a new code tab inside __lua__
+const tabSeparator = "-->8"
+
+// SourceLine is where a line of a resolved program came from: a file relative
+// to the cart directory and a 1-based line in that file
+type SourceLine struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// resolvedProgram is a cart's code with every #include replaced by the code it
+// names. Origins has one entry per line.
+type resolvedProgram struct {
+	Lines   []string
+	Origins []SourceLine
+}
+
+// Source joins the program into one chunk
+func (p *resolvedProgram) Source() string {
+	return strings.Join(p.Lines, "\n")
+}
+
+// origin maps a 1-based line of the flattened program back to its source
+func (p *resolvedProgram) origin(line int) SourceLine {
+	if line < 1 || line > len(p.Origins) {
+		return SourceLine{}
+	}
+	return p.Origins[line-1]
+}
+
+// resolveProgram loads a cart's __lua__ and expands #include directives:
+// "#include foo.lua" inserts a Lua file, "#include other.p8" all of another
+// cart's code and "#include other.p8:1" just its tab 1 (tabs count from 0).
+// Paths are relative to the cart's directory. Included files may include
+// others; an include cycle is an error.
+func resolveProgram(cartPath string) (*resolvedProgram, error) {
+	r := &includeResolver{dir: filepath.Dir(cartPath), program: &resolvedProgram{}}
+	if err := r.include(filepath.Base(cartPath), -1); err != nil {
+		return nil, err
+	}
+	return r.program, nil
+}
+
+type includeResolver struct {
+	dir     string
+	program *resolvedProgram
+	stack   []string // includes being expanded, for cycle detection
+}
+
+// include appends a file, or one tab of a cart when tab >= 0
+func (r *includeResolver) include(name string, tab int) error {
+	key := name
+	if tab >= 0 {
+		key += ":" + strconv.Itoa(tab)
+	}
+	for i, open := range r.stack {
+		// A whole cart overlaps each of its tabs
+		if open == key || strings.HasPrefix(key, open+":") || strings.HasPrefix(open, key+":") {
+			return fmt.Errorf("include cycle: %s -> %s", strings.Join(r.stack[i:], " -> "), key)
+		}
+	}
+	r.stack = append(r.stack, key)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	lines, firstLine, err := readCodeLines(filepath.Join(r.dir, name), tab)
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		origin := SourceLine{File: filepath.ToSlash(name), Line: firstLine[i]}
+		target, ok := includeTarget(line)
+		if !ok {
+			r.program.Lines = append(r.program.Lines, line)
+			r.program.Origins = append(r.program.Origins, origin)
+			continue
+		}
+		file, tab := target, -1
+		if base, n, ok := strings.Cut(target, ":"); ok && strings.HasSuffix(strings.ToLower(base), ".p8") {
+			if tab, err = strconv.Atoi(n); err != nil || tab < 0 {
+				return fmt.Errorf("%s:%d: invalid tab in #include %s", origin.File, origin.Line, target)
+			}
+			file = base
+		}
+		if err := r.include(file, tab); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s:%d: #include %s: file not found", origin.File, origin.Line, target)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// includeTarget returns the file named by an "#include file" line
+func includeTarget(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "#include")
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// readCodeLines reads the code of a file with the file line number of each
+// line. For .p8 carts that's the __lua__ section, or only tab when tab >= 0;
+// other files are read whole.
+func readCodeLines(path string, tab int) (lines []string, lineNumbers []int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	isCart := strings.HasSuffix(strings.ToLower(path), ".p8")
+	inCode := !isCart
+	currentTab := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if isCart && isSectionMarker(line) {
+			inCode = line == "__lua__"
+			continue
+		}
+		if !inCode {
+			continue
+		}
+		if isCart && line == tabSeparator {
+			currentTab++
+			if tab < 0 {
+				lines = append(lines, line)
+				lineNumbers = append(lineNumbers, n)
+			}
+			continue
+		}
+		if tab < 0 || currentTab == tab {
+			lines = append(lines, line)
+			lineNumbers = append(lineNumbers, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if tab > currentTab {
+		return nil, nil, fmt.Errorf("%s has no tab %d", filepath.Base(path), tab)
+	}
+	return lines, lineNumbers, nil
+}
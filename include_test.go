@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const cartHeader = "pico-8 cartridge // http://www.pico-8.com\nversion 41\n__lua__\n"
+
+// writeFiles creates files, which may be in subdirectories, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveProgram(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		lines   []string
+		origins []string // file:line of each line
+	}{
+		{
+			"no includes",
+			map[string]string{"game.p8": cartHeader + "a()\n-->8\nb()\n__gfx__\n0000\n"},
+			[]string{"a()", "-->8", "b()"},
+			[]string{"game.p8:4", "game.p8:5", "game.p8:6"},
+		},
+		{
+			"nested lua files",
+			map[string]string{
+				"game.p8":      cartHeader + "a()\n#include lib/util.lua\nb()\n",
+				"lib/util.lua": "-- util\n#include lib/math.lua\nu()\n",
+				"lib/math.lua": "m()\n",
+			},
+			[]string{"a()", "-- util", "m()", "u()", "b()"},
+			[]string{"game.p8:4", "lib/util.lua:1", "lib/math.lua:1", "lib/util.lua:3", "game.p8:6"},
+		},
+		{
+			"one tab of another cart",
+			map[string]string{
+				"game.p8":  cartHeader + "#include other.p8:1\nmain()\n",
+				"other.p8": cartHeader + "zero()\n-->8\none()\n-->8\ntwo()\n",
+			},
+			[]string{"one()", "main()"},
+			[]string{"other.p8:6", "game.p8:5"},
+		},
+		{
+			"all of another cart",
+			map[string]string{
+				"game.p8":  cartHeader + " #include other.p8 -- everything\n",
+				"other.p8": cartHeader + "zero()\n-->8\none()\n",
+			},
+			[]string{"zero()", "-->8", "one()"},
+			[]string{"other.p8:4", "other.p8:5", "other.p8:6"},
+		},
+		{
+			"the same file twice",
+			map[string]string{
+				"game.p8": cartHeader + "#include a.lua\n#include a.lua\n",
+				"a.lua":   "a()",
+			},
+			[]string{"a()", "a()"},
+			[]string{"a.lua:1", "a.lua:1"},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, tt.files)
+		program, err := resolveProgram(filepath.Join(dir, "game.p8"))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var origins []string
+		for i := range program.Lines {
+			origin := program.origin(i + 1)
+			origins = append(origins, fmt.Sprintf("%s:%d", origin.File, origin.Line))
+		}
+		if !slices.Equal(program.Lines, tt.lines) || !slices.Equal(origins, tt.origins) {
+			t.Errorf("%s: lines %q from %q; want %q from %q", tt.name, program.Lines, origins, tt.lines, tt.origins)
+		}
+		if got := program.origin(len(program.Lines) + 1); got != (SourceLine{}) {
+			t.Errorf("%s: origin past the end = %v; want none", tt.name, got)
+		}
+	}
+}
+
+func TestResolveProgramErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			"missing file",
+			map[string]string{"game.p8": cartHeader + "a()\n#include nope.lua\n"},
+			"game.p8:5: #include nope.lua: file not found",
+		},
+		{
+			"missing file in an included file",
+			map[string]string{"game.p8": cartHeader + "#include a.lua\n", "a.lua": "\n#include b.lua\n"},
+			"a.lua:2: #include b.lua: file not found",
+		},
+		{
+			"cycle between lua files",
+			map[string]string{"game.p8": cartHeader + "#include a.lua\n", "a.lua": "#include b.lua\n", "b.lua": "#include a.lua\n"},
+			"include cycle: a.lua -> b.lua -> a.lua",
+		},
+		{
+			"file including itself",
+			map[string]string{"game.p8": cartHeader + "#include a.lua\n", "a.lua": "#include a.lua\n"},
+			"include cycle: a.lua -> a.lua",
+		},
+		{
+			"cart including its own tab",
+			map[string]string{"game.p8": cartHeader + "#include game.p8:1\n-->8\nb()\n"},
+			"include cycle: game.p8 -> game.p8:1",
+		},
+		{
+			"invalid tab",
+			map[string]string{"game.p8": cartHeader + "#include other.p8:x\n", "other.p8": cartHeader},
+			"game.p8:4: invalid tab in #include other.p8:x",
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, tt.files)
+		_, err := resolveProgram(filepath.Join(dir, "game.p8"))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: error %v; want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestIncludeTarget(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"#include a.lua", "a.lua", true},
+		{"  #include\tlib/a.lua -- helpers", "lib/a.lua", true},
+		{"#include other.p8:2", "other.p8:2", true},
+		{"#include", "", false},
+		{"#includes a.lua", "", false},
+		{"-- #include a.lua", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := includeTarget(tt.line); got != tt.want || ok != tt.ok {
+			t.Errorf("includeTarget(%q) = %q, %v; want %q, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package lua
+
+// Node is any AST node; Line is the source line it starts on
+type Node interface {
+	line() int
+}
+
+// Pos records the source line of a node
+type Pos struct {
+	Line int `json:"line"`
+}
+
+func (p Pos) line() int { return p.Line }
+
+// Expr is an expression node
+type Expr interface {
+	Node
+	expr()
+}
+
+// Stmt is a statement node
+type Stmt interface {
+	Node
+	stmt()
+}
+
+// Block is a sequence of statements
+type Block struct {
+	Pos
+	Stmts   []Stmt
+	EndLine int `json:"-"` // line of the token that closes the block
+}
+
+// Expressions
+
+type (
+	// NilExpr is nil
+	NilExpr struct{ Pos }
+	// TrueExpr is true
+	TrueExpr struct{ Pos }
+	// FalseExpr is false
+	FalseExpr struct{ Pos }
+	// VarargExpr is ...
+	VarargExpr struct{ Pos }
+
+	// NumberExpr is a numeric literal
+	NumberExpr struct {
+		Pos
+		Value Number
+		Text  string // the literal as written
+	}
+
+	// StringExpr is a string literal. Names used as keys, as in t.x and {x=1},
+	// are strings too; their Text is empty.
+	StringExpr struct {
+		Pos
+		Value string
+		Text  string // the literal as written
+	}
+
+	// NameExpr is a variable reference
+	NameExpr struct {
+		Pos
+		Name string
+	}
+
+	// IndexExpr is Obj[Key], or Obj.Key when the key is a name
+	IndexExpr struct {
+		Pos
+		Obj, Key Expr
+	}
+
+	// CallExpr is Fn(Args...)
+	CallExpr struct {
+		Pos
+		Fn   Expr
+		Args []Expr
+		Bare bool // f"str" or f{...}, without parentheses
+	}
+
+	// MethodCallExpr is Obj:Method(Args...)
+	MethodCallExpr struct {
+		Pos
+		Obj    Expr
+		Method string
+		Args   []Expr
+		Bare   bool // o:m"str" or o:m{...}
+	}
+
+	// FunctionExpr is a function body; named functions are sugar over it
+	FunctionExpr struct {
+		Pos
+		Params   []string
+		IsVararg bool
+		Body     *Block
+		Name     string // for error messages
+	}
+
+	// BinaryExpr is Left Op Right
+	BinaryExpr struct {
+		Pos
+		Op          string
+		Left, Right Expr
+	}
+
+	// UnaryExpr is Op Operand: -, not, #, ~, and PICO-8's @, % and $ peeks
+	UnaryExpr struct {
+		Pos
+		Op      string
+		Operand Expr
+	}
+
+	// ParenExpr is (Inner), which truncates multiple results to one
+	ParenExpr struct {
+		Pos
+		Inner Expr
+	}
+
+	// TableExpr is a table constructor
+	TableExpr struct {
+		Pos
+		Fields []TableField
+	}
+)
+
+// TableField is one entry of a table constructor; Key is nil for positional entries
+type TableField struct {
+	Key   Expr
+	Value Expr
+}
+
+func (*NilExpr) expr()        {}
+func (*TrueExpr) expr()       {}
+func (*FalseExpr) expr()      {}
+func (*VarargExpr) expr()     {}
+func (*NumberExpr) expr()     {}
+func (*StringExpr) expr()     {}
+func (*NameExpr) expr()       {}
+func (*IndexExpr) expr()      {}
+func (*CallExpr) expr()       {}
+func (*MethodCallExpr) expr() {}
+func (*FunctionExpr) expr()   {}
+func (*BinaryExpr) expr()     {}
+func (*UnaryExpr) expr()      {}
+func (*ParenExpr) expr()      {}
+func (*TableExpr) expr()      {}
+
+// Statements
+
+type (
+	// LocalStmt is local Names = Exprs
+	LocalStmt struct {
+		Pos
+		Names []string
+		Exprs []Expr
+	}
+
+	// AssignStmt is Targets = Exprs
+	AssignStmt struct {
+		Pos
+		Targets []Expr
+		Exprs   []Expr
+	}
+
+	// OpAssignStmt is PICO-8's Target op= Value, e.g. x += 1
+	OpAssignStmt struct {
+		Pos
+		Op     string // the binary operator, e.g. "+"
+		Target Expr
+		Value  Expr
+	}
+
+	// CallStmt is a function call used as a statement
+	CallStmt struct {
+		Pos
+		Call      Expr
+		Shorthand bool // PICO-8's ?args for print(args)
+	}
+
+	// DoStmt is do Body end
+	DoStmt struct {
+		Pos
+		Body *Block
+	}
+
+	// WhileStmt is while Cond do Body end
+	WhileStmt struct {
+		Pos
+		Cond  Expr
+		Body  *Block
+		Short bool // PICO-8's single line while (cond) stmt
+	}
+
+	// RepeatStmt is repeat Body until Cond
+	RepeatStmt struct {
+		Pos
+		Body *Block
+		Cond Expr
+	}
+
+	// IfStmt is if Cond then Then else Else end; elseif chains nest in Else
+	IfStmt struct {
+		Pos
+		Cond   Expr
+		Then   *Block
+		Else   *Block
+		ElseIf bool // Else holds a single IfStmt written as elseif
+		Short  bool // PICO-8's single line if (cond) stmt
+	}
+
+	// NumericForStmt is for Var = Start, Limit, Step do Body end
+	NumericForStmt struct {
+		Pos
+		Var                string
+		Start, Limit, Step Expr // Step may be nil
+		Body               *Block
+	}
+
+	// GenericForStmt is for Names in Exprs do Body end
+	GenericForStmt struct {
+		Pos
+		Names []string
+		Exprs []Expr
+		Body  *Block
+	}
+
+	// FunctionStmt is function a.b.c:m() ... end
+	FunctionStmt struct {
+		Pos
+		Target Expr // a NameExpr or IndexExpr
+		Method bool // declared with ':', so self is an implicit first parameter
+		Func   *FunctionExpr
+	}
+
+	// LocalFunctionStmt is local function Name() ... end
+	LocalFunctionStmt struct {
+		Pos
+		Name string
+		Func *FunctionExpr
+	}
+
+	// ReturnStmt is return Exprs
+	ReturnStmt struct {
+		Pos
+		Exprs []Expr
+	}
+
+	// BreakStmt is break
+	BreakStmt struct{ Pos }
+
+	// GotoStmt is goto Label
+	GotoStmt struct {
+		Pos
+		Label string
+	}
+
+	// LabelStmt is ::Name::
+	LabelStmt struct {
+		Pos
+		Name string
+	}
+)
+
+func (*LocalStmt) stmt()         {}
+func (*AssignStmt) stmt()        {}
+func (*OpAssignStmt) stmt()      {}
+func (*CallStmt) stmt()          {}
+func (*DoStmt) stmt()            {}
+func (*WhileStmt) stmt()         {}
+func (*RepeatStmt) stmt()        {}
+func (*IfStmt) stmt()            {}
+func (*NumericForStmt) stmt()    {}
+func (*GenericForStmt) stmt()    {}
+func (*FunctionStmt) stmt()      {}
+func (*LocalFunctionStmt) stmt() {}
+func (*ReturnStmt) stmt()        {}
+func (*BreakStmt) stmt()         {}
+func (*GotoStmt) stmt()          {}
+func (*LabelStmt) stmt()         {}
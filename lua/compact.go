@@ -0,0 +1,586 @@
+package lua
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/drpaneas/parsepico/fixed"
+)
+
+// atomPriority is the priority of expressions that never need parentheses
+const atomPriority = 100
+
+// printCompact writes a chunk with as few characters as the syntax allows,
+// using PICO-8's shorthand where it is shorter: if(c) x=1, while(c) x+=1
+// and ?x for print(x)
+func printCompact(b *Block) string {
+	p := &compactPrinter{short: make(map[Node]bool)}
+	for _, s := range b.Stmts {
+		p.stmt(s)
+	}
+	return p.out.String()
+}
+
+type compactPrinter struct {
+	out       strings.Builder
+	last      string        // the last token written
+	lineStart bool          // nothing written on the current line yet
+	stmtStart bool          // the next token starts a statement
+	depth     int           // block nesting; statements at depth 0 go on new lines
+	short     map[Node]bool // memoized shortForm results
+}
+
+// tok writes a token, separated from the previous one only when they would
+// otherwise run together
+func (p *compactPrinter) tok(s string) {
+	if !p.lineStart && needSpace(p.last, s) {
+		if p.stmtStart && p.depth == 0 {
+			p.out.WriteByte('\n')
+		} else {
+			p.out.WriteByte(' ')
+		}
+	}
+	p.out.WriteString(s)
+	p.last, p.lineStart, p.stmtStart = s, false, false
+}
+
+// newline ends the line, which the shorthand forms need
+func (p *compactPrinter) newline() {
+	if p.out.Len() > 0 && !p.lineStart {
+		p.out.WriteByte('\n')
+		p.lineStart = true
+	}
+}
+
+// needSpace reports whether token b written right after token a would lex
+// differently
+func needSpace(a, b string) bool {
+	if a == "" {
+		return false
+	}
+	x, y := a[len(a)-1], b[0]
+	switch {
+	case isNameChar(x) && isNameChar(y):
+		return true
+	case isDigit(a[0]) || a[0] == '.' && len(a) > 1 && isDigit(a[1]):
+		// a number followed by a point, or a point followed by a digit
+		return y == '.'
+	case x == '.' && (y == '.' || isDigit(y)):
+		return true
+	}
+	joined := a + b
+	if strings.HasPrefix(joined[len(a)-1:], "--") || strings.HasPrefix(joined[len(a)-1:], "//") {
+		return true
+	}
+	for _, op := range operators {
+		if len(op) > len(a) && strings.HasPrefix(op, a) && strings.HasPrefix(joined, op) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *compactPrinter) block(b *Block) {
+	p.depth++
+	for _, s := range b.Stmts {
+		p.stmt(s)
+	}
+	p.depth--
+}
+
+func (p *compactPrinter) stmt(s Stmt) {
+	p.stmtStart = true
+	if startsWithParen(s) && p.out.Len() > 0 {
+		// Otherwise (f)() would call whatever the last statement ended with
+		p.tok(";")
+		p.stmtStart = true
+	}
+	switch s := s.(type) {
+	case *LocalStmt:
+		p.tok("local")
+		p.names(s.Names)
+		if len(s.Exprs) > 0 {
+			p.tok("=")
+			p.exprList(s.Exprs)
+		}
+	case *AssignStmt:
+		p.exprList(s.Targets)
+		p.tok("=")
+		p.exprList(s.Exprs)
+	case *OpAssignStmt:
+		p.expr(s.Target, 0)
+		p.tok(s.Op + "=")
+		p.expr(s.Value, 0)
+	case *CallStmt:
+		if isPrintShorthand(s) {
+			p.newline()
+			p.tok("?")
+			p.exprList(s.Call.(*CallExpr).Args)
+			p.newline()
+			return
+		}
+		p.expr(s.Call, 0)
+	case *DoStmt:
+		p.tok("do")
+		p.block(s.Body)
+		p.tok("end")
+	case *WhileStmt:
+		if p.shortForm(s) {
+			p.tok("while")
+			p.shortCond(s.Cond)
+			p.block(s.Body)
+			p.newline()
+			return
+		}
+		p.tok("while")
+		p.expr(s.Cond, 0)
+		p.tok("do")
+		p.block(s.Body)
+		p.tok("end")
+	case *RepeatStmt:
+		p.tok("repeat")
+		p.block(s.Body)
+		p.tok("until")
+		p.expr(s.Cond, 0)
+	case *IfStmt:
+		if p.shortForm(s) {
+			p.tok("if")
+			p.shortCond(s.Cond)
+			p.block(s.Then)
+			if s.Else != nil {
+				p.tok("else")
+				p.block(s.Else)
+			}
+			p.newline()
+			return
+		}
+		p.tok("if")
+		p.ifChain(s)
+		p.tok("end")
+	case *NumericForStmt:
+		p.tok("for")
+		p.tok(s.Var)
+		p.tok("=")
+		p.expr(s.Start, 0)
+		p.tok(",")
+		p.expr(s.Limit, 0)
+		if s.Step != nil {
+			p.tok(",")
+			p.expr(s.Step, 0)
+		}
+		p.tok("do")
+		p.block(s.Body)
+		p.tok("end")
+	case *GenericForStmt:
+		p.tok("for")
+		p.names(s.Names)
+		p.tok("in")
+		p.exprList(s.Exprs)
+		p.tok("do")
+		p.block(s.Body)
+		p.tok("end")
+	case *FunctionStmt:
+		p.tok("function")
+		p.funcName(s.Target, s.Method)
+		p.funcBody(s.Func, s.Method)
+	case *LocalFunctionStmt:
+		p.tok("local")
+		p.tok("function")
+		p.tok(s.Name)
+		p.funcBody(s.Func, false)
+	case *ReturnStmt:
+		p.tok("return")
+		p.exprList(s.Exprs)
+	case *BreakStmt:
+		p.tok("break")
+	case *GotoStmt:
+		p.tok("goto")
+		p.tok(s.Label)
+	case *LabelStmt:
+		p.tok("::")
+		p.tok(s.Name)
+		p.tok("::")
+	}
+}
+
+// ifChain writes cond then ... [elseif ...] [else ...], without the end
+func (p *compactPrinter) ifChain(s *IfStmt) {
+	p.expr(s.Cond, 0)
+	p.tok("then")
+	p.block(s.Then)
+	if s.Else == nil {
+		return
+	}
+	if len(s.Else.Stmts) == 1 {
+		if next, ok := s.Else.Stmts[0].(*IfStmt); ok {
+			p.tok("elseif")
+			p.ifChain(next)
+			return
+		}
+	}
+	p.tok("else")
+	p.block(s.Else)
+}
+
+// shortCond writes the parenthesized condition of a single line if or while
+func (p *compactPrinter) shortCond(cond Expr) {
+	p.tok("(")
+	p.expr(cond, 0)
+	p.tok(")")
+}
+
+// shortForm reports whether an if or while can be written on one line: the
+// body runs to the end of the line, so it must fit on it and must not begin
+// with a parenthesis that would extend the condition
+func (p *compactPrinter) shortForm(s Stmt) bool {
+	if short, ok := p.short[s]; ok {
+		return short
+	}
+	fits := func(b *Block) bool {
+		return len(b.Stmts) > 0 && !startsWithParen(b.Stmts[0]) && !p.forcesNewline(b)
+	}
+	short := false
+	switch s := s.(type) {
+	case *IfStmt:
+		short = fits(s.Then) && (s.Else == nil || fits(s.Else))
+	case *WhileStmt:
+		short = fits(s.Body)
+	}
+	p.short[s] = short
+	return short
+}
+
+// forcesNewline reports whether n contains anything written in a form that
+// must end its line
+func (p *compactPrinter) forcesNewline(n Node) bool {
+	found := false
+	Inspect(n, func(n Node) bool {
+		switch n := n.(type) {
+		case *IfStmt, *WhileStmt:
+			found = found || p.shortForm(n.(Stmt))
+		case *CallStmt:
+			found = found || isPrintShorthand(n)
+		}
+		return !found
+	})
+	return found
+}
+
+// isPrintShorthand reports whether a statement is a print call that can be
+// written as ?args
+func isPrintShorthand(s *CallStmt) bool {
+	call, ok := s.Call.(*CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return false
+	}
+	name, ok := call.Fn.(*NameExpr)
+	return ok && name.Name == "print"
+}
+
+// startsWithParen reports whether a statement is written starting with (
+func startsWithParen(s Stmt) bool {
+	switch s := s.(type) {
+	case *CallStmt:
+		return prefixStartsWithParen(s.Call)
+	case *AssignStmt:
+		return prefixStartsWithParen(s.Targets[0])
+	case *OpAssignStmt:
+		return prefixStartsWithParen(s.Target)
+	}
+	return false
+}
+
+func prefixStartsWithParen(e Expr) bool {
+	switch e := e.(type) {
+	case *NameExpr:
+		return false
+	case *CallExpr:
+		return prefixStartsWithParen(e.Fn)
+	case *IndexExpr:
+		return prefixStartsWithParen(e.Obj)
+	case *MethodCallExpr:
+		return prefixStartsWithParen(e.Obj)
+	case *ParenExpr:
+		if isPrefixExpr(e.Inner) {
+			return prefixStartsWithParen(e.Inner)
+		}
+	}
+	return true
+}
+
+// isPrefixExpr reports whether e can be called or indexed without parentheses
+func isPrefixExpr(e Expr) bool {
+	switch e.(type) {
+	case *NameExpr, *IndexExpr, *CallExpr, *MethodCallExpr:
+		return true
+	}
+	return false
+}
+
+func (p *compactPrinter) names(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			p.tok(",")
+		}
+		p.tok(name)
+	}
+}
+
+func (p *compactPrinter) funcName(target Expr, method bool) {
+	switch t := target.(type) {
+	case *NameExpr:
+		p.tok(t.Name)
+	case *IndexExpr:
+		p.funcName(t.Obj, false)
+		if method {
+			p.tok(":")
+		} else {
+			p.tok(".")
+		}
+		p.tok(t.Key.(*StringExpr).Value)
+	}
+}
+
+func (p *compactPrinter) funcBody(fn *FunctionExpr, method bool) {
+	params := fn.Params
+	if method {
+		params = params[1:] // self
+	}
+	p.tok("(")
+	p.names(params)
+	if fn.IsVararg {
+		if len(params) > 0 {
+			p.tok(",")
+		}
+		p.tok("...")
+	}
+	p.tok(")")
+	p.block(fn.Body)
+	p.tok("end")
+}
+
+func (p *compactPrinter) exprList(list []Expr) {
+	for i, e := range list {
+		if i > 0 {
+			p.tok(",")
+		}
+		p.expr(e, 0)
+	}
+}
+
+// exprPriority is how tightly an expression binds, as in binaryPriority
+func exprPriority(e Expr) int {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		return binaryPriority[e.Op]
+	case *UnaryExpr:
+		return unaryPriority
+	case *NumberExpr:
+		if e.Value < 0 {
+			return unaryPriority
+		}
+	case *ParenExpr:
+		if !multiValued(e.Inner) {
+			return exprPriority(e.Inner)
+		}
+	}
+	return atomPriority
+}
+
+// expr writes e, in parentheses when it binds looser than min
+func (p *compactPrinter) expr(e Expr, min int) {
+	if exprPriority(e) < min {
+		p.tok("(")
+		p.expr(e, 0)
+		p.tok(")")
+		return
+	}
+	switch e := e.(type) {
+	case *NilExpr:
+		p.tok("nil")
+	case *TrueExpr:
+		p.tok("true")
+	case *FalseExpr:
+		p.tok("false")
+	case *VarargExpr:
+		p.tok("...")
+	case *NumberExpr:
+		switch {
+		case e.Value == fixed.Min:
+			p.tok("0x8000") // -32768 has no positive counterpart
+		case e.Value < 0:
+			p.tok("-")
+			p.tok(FormatNumber(e.Value.Neg()))
+		default:
+			p.tok(FormatNumber(e.Value))
+		}
+	case *StringExpr:
+		p.tok(QuoteString(e.Value))
+	case *NameExpr:
+		p.tok(e.Name)
+	case *IndexExpr:
+		p.prefix(e.Obj)
+		if key, ok := e.Key.(*StringExpr); ok && isName(key.Value) {
+			p.tok(".")
+			p.tok(key.Value)
+			return
+		}
+		p.tok("[")
+		p.expr(e.Key, 0)
+		p.tok("]")
+	case *CallExpr:
+		p.prefix(e.Fn)
+		p.args(e.Args)
+	case *MethodCallExpr:
+		p.prefix(e.Obj)
+		p.tok(":")
+		p.tok(e.Method)
+		p.args(e.Args)
+	case *FunctionExpr:
+		p.tok("function")
+		p.funcBody(e, false)
+	case *BinaryExpr:
+		prio := binaryPriority[e.Op]
+		left, right := prio, prio+1
+		if e.Op == ".." || e.Op == "^" {
+			left, right = prio+1, prio // right associative
+		}
+		if exprPriority(e.Right) == unaryPriority {
+			right = unaryPriority // a unary operator can start any operand, as in 2^-1
+		}
+		p.expr(e.Left, left)
+		p.tok(e.Op)
+		p.expr(e.Right, right)
+	case *UnaryExpr:
+		p.tok(e.Op)
+		p.expr(e.Operand, unaryPriority)
+	case *ParenExpr:
+		if multiValued(e.Inner) {
+			// (f()) keeps only the first result
+			p.tok("(")
+			p.expr(e.Inner, 0)
+			p.tok(")")
+			return
+		}
+		p.expr(e.Inner, min)
+	case *TableExpr:
+		p.tok("{")
+		for i, f := range e.Fields {
+			if i > 0 {
+				p.tok(",")
+			}
+			switch key := f.Key.(type) {
+			case nil:
+			case *StringExpr:
+				if isName(key.Value) {
+					p.tok(key.Value)
+					p.tok("=")
+					break
+				}
+				p.tableKey(key)
+			default:
+				p.tableKey(key)
+			}
+			p.expr(f.Value, 0)
+		}
+		p.tok("}")
+	}
+}
+
+func (p *compactPrinter) tableKey(key Expr) {
+	p.tok("[")
+	p.expr(key, 0)
+	p.tok("]")
+	p.tok("=")
+}
+
+// prefix writes the object of a call or index, which must be a name, a call,
+// an index or parenthesized
+func (p *compactPrinter) prefix(e Expr) {
+	if paren, ok := e.(*ParenExpr); ok && isPrefixExpr(paren.Inner) {
+		e = paren.Inner
+	}
+	if isPrefixExpr(e) {
+		p.expr(e, 0)
+		return
+	}
+	p.tok("(")
+	p.expr(e, 0)
+	p.tok(")")
+}
+
+// args writes call arguments; a single string or table needs no parentheses
+func (p *compactPrinter) args(args []Expr) {
+	if len(args) == 1 {
+		switch args[0].(type) {
+		case *StringExpr, *TableExpr:
+			p.expr(args[0], 0)
+			return
+		}
+	}
+	p.tok("(")
+	p.exprList(args)
+	p.tok(")")
+}
+
+// FormatNumber writes a non-negative number as the shortest literal that
+// reads back as exactly the same value
+func FormatNumber(n Number) string {
+	hex := "0x" + strconv.FormatUint(uint64(n.Bits()>>16), 16)
+	if frac := n.Bits() & 0xffff; frac != 0 {
+		hex += "." + strings.TrimRight(strconv.FormatUint(uint64(frac)|0x10000, 16)[1:], "0")
+	}
+	for digits := 0; digits <= 6; digits++ {
+		s := strconv.FormatFloat(n.Float(), 'f', digits, 64)
+		if strings.Contains(s, ".") {
+			s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+		}
+		if strings.HasPrefix(s, "0.") {
+			s = s[1:]
+		}
+		if v, ok := fixed.ParseLiteral(s); ok && v == n {
+			if len(hex) < len(s) {
+				return hex
+			}
+			return s
+		}
+	}
+	return hex
+}
+
+// QuoteString writes a string literal with whichever quote needs fewer escapes
+func QuoteString(s string) string {
+	quote := byte('"')
+	if strings.Count(s, `"`) > strings.Count(s, "'") {
+		quote = '\''
+	}
+	var out strings.Builder
+	out.WriteByte(quote)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c >= 1 && c <= 6:
+			out.WriteByte('\\')
+			out.WriteByte(p8sciiEscapes[c-1])
+		case c == '\n':
+			out.WriteString(`\n`)
+		case c == '\r':
+			out.WriteString(`\r`)
+		case c == '\t':
+			out.WriteString(`\t`)
+		case c < 0x20 || c == 0x7f:
+			code := strconv.Itoa(int(c))
+			if i+1 < len(s) && isDigit(s[i+1]) {
+				code = strings.Repeat("0", 3-len(code)) + code
+			}
+			out.WriteString(`\` + code)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte(quote)
+	return out.String()
+}
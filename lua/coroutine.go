@@ -0,0 +1,77 @@
+package lua
+
+// Coroutine is a thread created by cocreate. Each one runs on its own goroutine,
+// but control is handed back and forth so only one of them runs at a time.
+type Coroutine struct {
+	fn      Value
+	status  string // suspended, running, normal or dead
+	started bool
+	resume  chan []Value
+	yield   chan coResult
+}
+
+type coResult struct {
+	values []Value
+	err    error
+	done   bool
+}
+
+// NewCoroutine wraps a function in a suspended coroutine
+func NewCoroutine(fn Value) *Coroutine {
+	return &Coroutine{fn: fn, status: "suspended", resume: make(chan []Value), yield: make(chan coResult)}
+}
+
+// Status is the result of costatus()
+func (co *Coroutine) Status() string { return co.status }
+
+// Current returns the running coroutine, or nil on the main thread
+func (in *Interp) Current() *Coroutine { return in.co }
+
+// Resume runs the coroutine until it yields or returns
+func (in *Interp) Resume(co *Coroutine, args []Value) ([]Value, error) {
+	if co.status != "suspended" {
+		return nil, &Error{Line: in.line, Msg: "cannot resume " + co.status + " coroutine"}
+	}
+	prev, depth, line := in.co, in.depth, in.line
+	if prev != nil {
+		prev.status = "normal"
+	}
+	in.co = co
+	co.status = "running"
+
+	if !co.started {
+		co.started = true
+		go func() {
+			results, err := in.Call(co.fn, args...)
+			co.yield <- coResult{values: results, err: err, done: true}
+		}()
+	} else {
+		co.resume <- args
+	}
+	r := <-co.yield
+
+	in.co, in.depth, in.line = prev, depth, line
+	if prev != nil {
+		prev.status = "running"
+	}
+	if r.done {
+		co.status = "dead"
+	} else {
+		co.status = "suspended"
+	}
+	return r.values, r.err
+}
+
+// Yield suspends the running coroutine, handing values to Resume, and returns
+// the arguments of the next Resume
+func (in *Interp) Yield(values []Value) []Value {
+	co := in.co
+	if co == nil {
+		in.Errorf("attempt to yield from outside a coroutine")
+	}
+	depth, line := in.depth, in.line
+	co.yield <- coResult{values: values}
+	args := <-co.resume
+	in.depth, in.line = depth, line
+	return args
+}
@@ -0,0 +1,62 @@
+package lua
+
+import (
+	"reflect"
+	"strings"
+)
+
+// DumpAST turns an AST into plain maps and slices ready for encoding/json.
+// Each node becomes an object with a "type" ("LocalStmt", "BinaryExpr", ...),
+// its "line", and its fields in lower camel case, except those tagged
+// json:"-". When where is not nil it translates line numbers, e.g. back to the
+// files of an #include'd program, and its result replaces the plain line.
+func DumpAST(n Node, where func(line int) map[string]any) any {
+	return dumpValue(reflect.ValueOf(n), where)
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+func dumpValue(v reflect.Value, where func(int) map[string]any) any {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpValue(v.Elem(), where)
+	case reflect.Slice:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = dumpValue(v.Index(i), where)
+		}
+		return out
+	case reflect.Struct:
+		out := make(map[string]any)
+		t := v.Type()
+		if reflect.PointerTo(t).Implements(nodeType) {
+			out["type"] = t.Name()
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Type == reflect.TypeOf(Pos{}) {
+				line := int(v.Field(i).FieldByName("Line").Int())
+				if where == nil {
+					out["line"] = line
+					continue
+				}
+				for k, val := range where(line) {
+					out[k] = val
+				}
+				continue
+			}
+			if !f.IsExported() || f.Tag.Get("json") == "-" {
+				continue
+			}
+			out[strings.ToLower(f.Name[:1])+f.Name[1:]] = dumpValue(v.Field(i), where)
+		}
+		return out
+	}
+	if n, ok := v.Interface().(Number); ok {
+		return n.Float()
+	}
+	return v.Interface()
+}
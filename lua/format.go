@@ -0,0 +1,547 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Format pretty-prints a chunk of PICO-8 Lua: one statement per line, each
+// block indented by indent, spaces around binary operators and after commas.
+// Comments, single blank lines, #include lines and the line breaks of table
+// constructors stay where they were. Whatever the token count depends on is
+// written as it was: parentheses, elseif, t.x or t["x"], f"s" or f("s"),
+// ?x or print(x) and the single line forms of if and while.
+func Format(src, indent string) (string, error) {
+	code, includes := hideIncludes(src)
+	tokens, comments, err := LexComments(code)
+	if err != nil {
+		return "", err
+	}
+	block, err := ParseTokens(tokens)
+	if err != nil {
+		return "", err
+	}
+	comments = append(comments, includes...)
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].Line < comments[j].Line })
+
+	f := &formatter{indent: indent, src: strings.Split(src, "\n"), comments: comments}
+	f.stmts(block.Stmts)
+	f.commentsBefore(math.MaxInt)
+	f.flushLine()
+	out := f.out.String()
+
+	// Formatting that changes what the code means or costs is a bug here
+	check, _ := hideIncludes(out)
+	after, err := Lex(check)
+	if err == nil {
+		_, err = ParseTokens(after)
+	}
+	if err != nil {
+		return "", fmt.Errorf("formatted code is invalid: %v", err)
+	}
+	if before, after := CountTokens(tokens), CountTokens(after); before != after {
+		return "", fmt.Errorf("formatting would change the token count from %d to %d", before, after)
+	}
+	return out, nil
+}
+
+// hideIncludes blanks the #include lines, which are not Lua, and returns them
+// as comments to put back
+func hideIncludes(src string) (string, []Comment) {
+	lines := strings.Split(src, "\n")
+	var includes []Comment
+	for i, line := range lines {
+		if text := strings.TrimSpace(line); strings.HasPrefix(text, "#include") {
+			includes = append(includes, Comment{Text: text, Line: i + 1, Own: true})
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n"), includes
+}
+
+type formatter struct {
+	out       strings.Builder
+	line      strings.Builder // the current line, without its indentation
+	lineDepth int             // indentation of the current line
+	blank     bool            // the last line written is blank
+	indent    string
+	depth     int
+	inline    int       // > 0 while writing something that must stay on one line
+	src       []string  // source lines, to keep blank lines
+	srcLine   int       // the last source line written from
+	items     int       // statements and comments written in the current block
+	next      int       // source line of the next statement
+	comments  []Comment // comments not written yet
+}
+
+func (f *formatter) w(parts ...string) {
+	for _, s := range parts {
+		if f.line.Len() == 0 {
+			f.lineDepth = f.depth
+		}
+		f.line.WriteString(s)
+	}
+}
+
+// space separates what comes next from the text before it on the line
+func (f *formatter) space() {
+	if s := f.line.String(); s != "" && !strings.HasSuffix(s, " ") {
+		f.w(" ")
+	}
+}
+
+// mark notes that the source up to line has been written
+func (f *formatter) mark(line int) {
+	f.srcLine = max(f.srcLine, line)
+}
+
+func (f *formatter) flushLine() {
+	if f.line.Len() == 0 {
+		return
+	}
+	f.out.WriteString(strings.Repeat(f.indent, f.lineDepth))
+	f.out.WriteString(strings.TrimRight(f.line.String(), " "))
+	f.out.WriteByte('\n')
+	f.line.Reset()
+	f.blank = false
+}
+
+// nl ends the line, followed by the comments of the source lines written so
+// far unless the next statement shares their line
+func (f *formatter) nl() {
+	for len(f.comments) > 0 && f.comments[0].Line <= f.srcLine {
+		c := f.comments[0]
+		if c.Own || f.line.Len() == 0 {
+			f.ownComment(c)
+		} else if c.Line < f.next {
+			f.space()
+			f.w(strings.TrimRight(c.Text, " \t\r"))
+		} else {
+			break
+		}
+		f.comments = f.comments[1:]
+	}
+	f.flushLine()
+}
+
+// commentsBefore writes the comments that come before a source line
+func (f *formatter) commentsBefore(line int) {
+	for len(f.comments) > 0 && f.comments[0].Line < line {
+		f.ownComment(f.comments[0])
+		f.comments = f.comments[1:]
+	}
+}
+
+// ownComment writes a comment on a line of its own. Tab separators and
+// #include lines stay in the first column, where PICO-8 looks for them.
+func (f *formatter) ownComment(c Comment) {
+	f.flushLine()
+	f.blankBefore(c.Line)
+	text := strings.TrimRight(c.Text, " \t\r")
+	if text == "-->8" || strings.HasPrefix(text, "#include") {
+		f.out.WriteString(text + "\n")
+		f.blank = false
+	} else {
+		f.w(text)
+		f.flushLine()
+	}
+	f.items++
+	f.mark(c.Line + strings.Count(c.Text, "\n"))
+}
+
+// blankBefore keeps a blank line that separates line from what came before,
+// except at the start of a block
+func (f *formatter) blankBefore(line int) {
+	if f.items > 0 && !f.blank && line >= 2 && f.srcLine < line-1 && strings.TrimSpace(f.src[line-2]) == "" {
+		f.out.WriteByte('\n')
+		f.blank = true
+	}
+}
+
+func (f *formatter) stmts(list []Stmt) {
+	for i, s := range list {
+		next := math.MaxInt
+		if i+1 < len(list) {
+			next = list[i+1].line()
+		}
+		f.stmt(s, next)
+	}
+}
+
+// block writes the statements of a block on lines of their own, indented, or
+// after each other when inline
+func (f *formatter) block(b *Block) {
+	if f.inline > 0 {
+		f.stmts(b.Stmts)
+		f.space()
+		return
+	}
+	f.nl()
+	f.depth++
+	items := f.items
+	f.items = 0
+	f.stmts(b.Stmts)
+	f.commentsBefore(b.EndLine)
+	f.depth--
+	f.items = items
+	f.mark(b.EndLine)
+}
+
+// inlineBlock writes the body of a single line if or while
+func (f *formatter) inlineBlock(b *Block) {
+	f.inline++
+	if len(b.Stmts) == 0 {
+		f.w(" ;")
+	}
+	f.block(b)
+	f.inline--
+}
+
+func (f *formatter) stmt(s Stmt, next int) {
+	f.next = next
+	if f.inline > 0 {
+		f.space()
+		if leadsWithParen(s) {
+			f.w(";")
+		}
+		f.stmtBody(s)
+		return
+	}
+	f.commentsBefore(s.line())
+	f.blankBefore(s.line())
+	f.items++
+	f.mark(s.line())
+	if leadsWithParen(s) && f.out.Len() > 0 {
+		// Otherwise (f)() would call whatever the last statement ended with
+		f.w(";")
+	}
+	f.stmtBody(s)
+	f.next = next
+	f.nl()
+}
+
+func (f *formatter) stmtBody(s Stmt) {
+	switch s := s.(type) {
+	case *LocalStmt:
+		f.w("local ", strings.Join(s.Names, ", "))
+		if len(s.Exprs) > 0 {
+			f.w(" = ")
+			f.exprList(s.Exprs)
+		}
+	case *AssignStmt:
+		f.exprList(s.Targets)
+		f.w(" = ")
+		f.exprList(s.Exprs)
+	case *OpAssignStmt:
+		f.expr(s.Target)
+		f.w(" ", s.Op, "= ")
+		f.expr(s.Value)
+	case *CallStmt:
+		if s.Shorthand {
+			f.w("?")
+			f.exprList(s.Call.(*CallExpr).Args)
+			return
+		}
+		f.expr(s.Call)
+	case *DoStmt:
+		f.w("do")
+		f.block(s.Body)
+		f.w("end")
+	case *WhileStmt:
+		f.w("while ")
+		f.expr(s.Cond)
+		if s.Short {
+			f.inlineBlock(s.Body)
+			return
+		}
+		f.w(" do")
+		f.block(s.Body)
+		f.w("end")
+	case *RepeatStmt:
+		f.w("repeat")
+		f.block(s.Body)
+		f.w("until ")
+		f.expr(s.Cond)
+	case *IfStmt:
+		if s.Short {
+			f.w("if ")
+			f.expr(s.Cond)
+			f.inlineBlock(s.Then)
+			if s.Else != nil {
+				f.w("else")
+				f.inlineBlock(s.Else)
+			}
+			return
+		}
+		f.w("if ")
+		f.ifChain(s)
+		f.w("end")
+	case *NumericForStmt:
+		f.w("for ", s.Var, " = ")
+		f.expr(s.Start)
+		f.w(", ")
+		f.expr(s.Limit)
+		if s.Step != nil {
+			f.w(", ")
+			f.expr(s.Step)
+		}
+		f.w(" do")
+		f.block(s.Body)
+		f.w("end")
+	case *GenericForStmt:
+		f.w("for ", strings.Join(s.Names, ", "), " in ")
+		f.exprList(s.Exprs)
+		f.w(" do")
+		f.block(s.Body)
+		f.w("end")
+	case *FunctionStmt:
+		f.w("function ")
+		f.funcName(s.Target, s.Method)
+		f.funcBody(s.Func, s.Method, false)
+	case *LocalFunctionStmt:
+		f.w("local function ", s.Name)
+		f.funcBody(s.Func, false, false)
+	case *ReturnStmt:
+		f.w("return")
+		if len(s.Exprs) > 0 {
+			f.w(" ")
+			f.exprList(s.Exprs)
+		}
+	case *BreakStmt:
+		f.w("break")
+	case *GotoStmt:
+		f.w("goto ", s.Label)
+	case *LabelStmt:
+		f.w("::", s.Name, "::")
+	}
+}
+
+// ifChain writes cond then ... [elseif ...] [else ...], without the end
+func (f *formatter) ifChain(s *IfStmt) {
+	f.expr(s.Cond)
+	f.w(" then")
+	f.block(s.Then)
+	switch {
+	case s.ElseIf:
+		f.w("elseif ")
+		f.ifChain(s.Else.Stmts[0].(*IfStmt))
+	case s.Else != nil:
+		f.w("else")
+		f.block(s.Else)
+	}
+}
+
+// leadsWithParen reports whether a statement is written starting with (
+func leadsWithParen(s Stmt) bool {
+	var e Expr
+	switch s := s.(type) {
+	case *CallStmt:
+		if s.Shorthand {
+			return false
+		}
+		e = s.Call
+	case *AssignStmt:
+		e = s.Targets[0]
+	case *OpAssignStmt:
+		e = s.Target
+	}
+	_, ok := leftmost(e).(*ParenExpr)
+	return ok
+}
+
+// leftmost is the expression a call, index or binary expression starts with
+func leftmost(e Expr) Expr {
+	switch e := e.(type) {
+	case *CallExpr:
+		return leftmost(e.Fn)
+	case *MethodCallExpr:
+		return leftmost(e.Obj)
+	case *IndexExpr:
+		return leftmost(e.Obj)
+	case *BinaryExpr:
+		return leftmost(e.Left)
+	}
+	return e
+}
+
+func (f *formatter) funcName(target Expr, method bool) {
+	switch t := target.(type) {
+	case *NameExpr:
+		f.w(t.Name)
+	case *IndexExpr:
+		f.funcName(t.Obj, false)
+		if method {
+			f.w(":")
+		} else {
+			f.w(".")
+		}
+		f.w(t.Key.(*StringExpr).Value)
+	}
+}
+
+// funcBody writes (params) body end. Function expressions written on one line
+// stay on one line.
+func (f *formatter) funcBody(fn *FunctionExpr, method, expr bool) {
+	params := fn.Params
+	if method {
+		params = params[1:] // self
+	}
+	if fn.IsVararg {
+		params = append(params[:len(params):len(params)], "...")
+	}
+	f.w("(", strings.Join(params, ", "), ")")
+	inline := expr && fn.Body.EndLine == fn.Line
+	if inline {
+		f.inline++
+		f.space()
+	}
+	f.block(fn.Body)
+	if inline {
+		f.inline--
+	}
+	f.w("end")
+}
+
+func (f *formatter) exprList(list []Expr) {
+	for i, e := range list {
+		if i > 0 {
+			f.w(", ")
+		}
+		f.expr(e)
+	}
+}
+
+func (f *formatter) expr(e Expr) {
+	f.mark(e.line())
+	switch e := e.(type) {
+	case *NilExpr:
+		f.w("nil")
+	case *TrueExpr:
+		f.w("true")
+	case *FalseExpr:
+		f.w("false")
+	case *VarargExpr:
+		f.w("...")
+	case *NumberExpr:
+		if e.Text == "" {
+			f.w(FormatNumber(e.Value))
+			break
+		}
+		f.w(e.Text)
+	case *StringExpr:
+		if e.Text == "" {
+			f.w(QuoteString(e.Value))
+			break
+		}
+		f.w(e.Text)
+		f.mark(e.Line + strings.Count(e.Text, "\n"))
+	case *NameExpr:
+		f.w(e.Name)
+	case *IndexExpr:
+		f.expr(e.Obj)
+		if key, ok := e.Key.(*StringExpr); ok && key.Text == "" {
+			f.w(".", key.Value)
+			break
+		}
+		f.w("[")
+		f.expr(e.Key)
+		f.w("]")
+	case *CallExpr:
+		f.expr(e.Fn)
+		f.args(e.Args, e.Bare)
+	case *MethodCallExpr:
+		f.expr(e.Obj)
+		f.w(":", e.Method)
+		f.args(e.Args, e.Bare)
+	case *FunctionExpr:
+		f.w("function")
+		f.funcBody(e, false, true)
+	case *BinaryExpr:
+		f.expr(e.Left)
+		f.w(" ", e.Op, " ")
+		f.expr(e.Right)
+	case *UnaryExpr:
+		f.w(e.Op)
+		if inner, ok := e.Operand.(*UnaryExpr); e.Op == "not" || ok && e.Op == "-" && inner.Op == "-" {
+			f.w(" ") // not x, and - -x rather than a comment
+		}
+		f.expr(e.Operand)
+	case *ParenExpr:
+		f.w("(")
+		f.expr(e.Inner)
+		f.w(")")
+	case *TableExpr:
+		f.table(e)
+	}
+}
+
+// args writes call arguments, in parentheses unless they were written
+// without
+func (f *formatter) args(args []Expr, bare bool) {
+	if bare {
+		f.expr(args[0])
+		return
+	}
+	f.w("(")
+	f.exprList(args)
+	f.w(")")
+}
+
+// table writes a table constructor on one line, or with its fields broken
+// over lines where the source broke them
+func (f *formatter) table(t *TableExpr) {
+	multiline := false
+	for _, field := range t.Fields {
+		multiline = multiline || fieldLine(field) > t.Line
+	}
+	if f.inline > 0 || !multiline {
+		f.w("{")
+		for i, field := range t.Fields {
+			if i > 0 {
+				f.w(", ")
+			}
+			f.field(field)
+		}
+		f.w("}")
+		return
+	}
+
+	f.w("{")
+	f.depth++
+	last := t.Line
+	for i, field := range t.Fields {
+		if line := fieldLine(field); i == 0 || line > last {
+			f.nl()
+			f.commentsBefore(line)
+			last = line
+		} else {
+			f.w(" ")
+		}
+		f.field(field)
+		f.w(",")
+	}
+	f.depth--
+	f.nl()
+	f.w("}")
+}
+
+func (f *formatter) field(field TableField) {
+	if key, ok := field.Key.(*StringExpr); ok && key.Text == "" {
+		f.w(key.Value, " = ")
+	} else if field.Key != nil {
+		f.w("[")
+		f.expr(field.Key)
+		f.w("] = ")
+	}
+	f.expr(field.Value)
+}
+
+// fieldLine is the source line a table field starts on
+func fieldLine(field TableField) int {
+	if field.Key != nil {
+		return field.Key.line()
+	}
+	return leftmost(field.Value).line()
+}
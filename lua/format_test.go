@@ -0,0 +1,115 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+// formatSamples cover the statements, comments and shorthands Format has to keep
+var formatSamples = []string{
+	`-- game
+#include lib.lua
+x=1 y=2 -- two
+--[[ long
+comment ]]
+function _update() if btn(0) then x-=1 end
+if(btn(1)) x+=1
+for i=1,3 do y+=i end end
+-->8
+-- tab 2
+--[==[ level
+   comment ]==]
+t={1,2,
+ 3, key="v", ["k"]=4}
+function t:m(a,...) return a.."x",... end
+?"hi"
+s=[[long -- not a comment]]
+while(x>0) x-=1
+repeat y-=1 until y<0
+local function f() goto done ::done:: end
+// c style`,
+	`function _init()
+  -- setup
+
+
+  p={x=64,y=64,spd=(1+1)*2}
+end
+-->8
+function _draw()
+	cls() spr(1,p.x,p.y) -- player
+	if p.x>100 then print"far" elseif p.x<10 then print("near") else
+		circ(p.x,p.y,4,8)
+	end
+end
+-->8
+local a,b=unpack{1,2}
+function f(...) local t={...} return #t end
+x=not a and b or -f(1,2)^2`,
+	`for k,v in pairs(t) do printh(k..v) end -- trailing
+do local z=1 end
+x = (y) -- parens stay
+x = t["x"] + t.x`,
+}
+
+func TestFormat(t *testing.T) {
+	for _, src := range formatSamples {
+		out, err := Format(src, "  ")
+		if err != nil {
+			t.Fatalf("Format: %v\n%s", err, src)
+		}
+
+		if before, after := formatTokens(t, src), formatTokens(t, out); before != after {
+			t.Errorf("%d tokens became %d\n%s", before, after, out)
+		}
+
+		again, err := Format(out, "  ")
+		if err != nil || again != out {
+			t.Errorf("formatting twice gave %q, %v; want %q", again, err, out)
+		}
+
+		code, includes := hideIncludes(src)
+		_, comments, err := LexComments(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range append(comments, includes...) {
+			if !strings.Contains(out, c.Text) {
+				t.Errorf("comment %q was lost\n%s", c.Text, out)
+			}
+		}
+		if want, got := strings.Count(src, "\n-->8\n"), strings.Count(out, "\n-->8\n"); got != want {
+			t.Errorf("%d tab separators on their own line; want %d\n%s", got, want, out)
+		}
+	}
+}
+
+// formatTokens counts tokens the way Format does, with #include lines hidden
+func formatTokens(t *testing.T, src string) int {
+	t.Helper()
+	code, _ := hideIncludes(src)
+	return countTokens(t, code)
+}
+
+func TestFormatOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"one statement per line", "x=1 y=2", "x = 1\ny = 2\n"},
+		{"indented blocks", "if a then b() end", "if a then\n  b()\nend\n"},
+		{"shorthand if stays", "if(a) b()", "if (a) b()\n"},
+		{"compound assignment", "x+=1", "x += 1\n"},
+		{"single blank lines", "a()\n\n\n\nb()", "a()\n\nb()\n"},
+		{"comment after a statement", "a() -- hi", "a() -- hi\n"},
+		{"tab separator", "a()\n-->8\nb()", "a()\n-->8\nb()\n"},
+		{"include", "#include x.lua\na()", "#include x.lua\na()\n"},
+		{"print shorthand", "?x", "?x\n"},
+	}
+	for _, tt := range tests {
+		got, err := Format(tt.src, "  ")
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Format(%q) = %q, %v; want %q", tt.name, tt.src, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,756 @@
+package lua
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// Interp runs PICO-8 Lua code
+type Interp struct {
+	Globals *Table
+
+	// MaxSteps stops runaway code once this many steps (statements, loop
+	// iterations and calls) ran since the counter was last reset with
+	// ResetSteps; 0 means no limit
+	MaxSteps int
+	// Printh receives the output of printh()
+	Printh io.Writer
+
+	steps int
+	depth int
+	line  int
+	co    *Coroutine // the running coroutine, nil for the main thread
+	rng   *rand.Rand
+}
+
+// maxCallDepth keeps runaway recursion from exhausting the Go stack
+const maxCallDepth = 400
+
+// New creates an interpreter with the base library installed
+func New() *Interp {
+	in := &Interp{Globals: NewTable(), Printh: os.Stderr, rng: rand.New(rand.NewSource(0))}
+	in.openBase()
+	return in
+}
+
+// Register installs a builtin as a global
+func (in *Interp) Register(name string, fn func(in *Interp, args []Value) []Value) {
+	in.Globals.Set(name, &GoFunction{Name: name, Fn: fn})
+}
+
+// Errorf aborts the running code with an error at the current line. Builtins use
+// it to report bad arguments.
+func (in *Interp) Errorf(format string, args ...any) {
+	panic(&Error{Line: in.line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// ResetSteps restarts the MaxSteps budget
+func (in *Interp) ResetSteps() { in.steps = 0 }
+
+// step charges one step against MaxSteps. Loops charge every iteration, so
+// that even one with an empty body, such as repeat until btnp(4), runs out.
+func (in *Interp) step() {
+	in.steps++
+	if in.MaxSteps > 0 && in.steps > in.MaxSteps {
+		in.Errorf("too many instructions (is a loop waiting for something that never happens?)")
+	}
+}
+
+// Load parses a chunk and returns it as a function without running it
+func (in *Interp) Load(src string) (Value, error) {
+	block, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Closure{fn: &FunctionExpr{Body: block, IsVararg: true, Name: "main chunk"}}, nil
+}
+
+// Exec parses and runs a chunk
+func (in *Interp) Exec(src string) error {
+	chunk, err := in.Load(src)
+	if err != nil {
+		return err
+	}
+	_, err = in.Call(chunk)
+	return err
+}
+
+// Call calls a function, turning runtime errors into an error value
+func (in *Interp) Call(fn Value, args ...Value) (results []Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			in.depth = 0
+			results, err = nil, rerr
+		}
+	}()
+	return in.call(fn, args), nil
+}
+
+// scope holds the locals of one block
+type scope struct {
+	names  []string
+	values []Value
+	parent *scope
+}
+
+func (s *scope) declare(name string, v Value) {
+	s.names = append(s.names, name)
+	s.values = append(s.values, v)
+}
+
+// lookup finds the innermost local with this name
+func (s *scope) lookup(name string) (*scope, int) {
+	for ; s != nil; s = s.parent {
+		for i := len(s.names) - 1; i >= 0; i-- {
+			if s.names[i] == name {
+				return s, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// frame is the state of one function call
+type frame struct {
+	varargs []Value
+	ret     []Value
+	label   string // target of a pending goto
+}
+
+// flow tells a block how a statement ended
+type flow int
+
+const (
+	flowNormal flow = iota
+	flowBreak
+	flowReturn
+	flowGoto
+)
+
+func (in *Interp) call(fn Value, args []Value) []Value {
+	in.step()
+	switch f := fn.(type) {
+	case *GoFunction:
+		return f.Fn(in, args)
+	case *Closure:
+		in.depth++
+		if in.depth > maxCallDepth {
+			in.depth = 0
+			in.Errorf("stack overflow")
+		}
+		sc := &scope{parent: f.scope}
+		for i, name := range f.fn.Params {
+			var v Value
+			if i < len(args) {
+				v = args[i]
+			}
+			sc.declare(name, v)
+		}
+		fr := &frame{}
+		if f.fn.IsVararg && len(args) > len(f.fn.Params) {
+			fr.varargs = args[len(f.fn.Params):]
+		}
+		line := in.line
+		if in.execBlock(f.fn.Body, sc, fr) == flowGoto {
+			in.Errorf("no visible label '%s' for goto", fr.label)
+		}
+		in.line = line
+		in.depth--
+		return fr.ret
+	}
+	if mm := in.metamethod(fn, "__call"); mm != nil {
+		return in.call(mm, append([]Value{fn}, args...))
+	}
+	in.Errorf("attempt to call a %s value", TypeName(fn))
+	return nil
+}
+
+// execBlock runs a block in a new scope
+func (in *Interp) execBlock(b *Block, parent *scope, fr *frame) flow {
+	return in.execStmtsIn(b, &scope{parent: parent}, fr)
+}
+
+// execStmtsIn runs a block's statements in the given scope. A goto is resolved
+// here when the label is in this block; otherwise it is passed to the enclosing one.
+func (in *Interp) execStmtsIn(b *Block, sc *scope, fr *frame) flow {
+	for i := 0; i < len(b.Stmts); i++ {
+		f := in.exec(b.Stmts[i], sc, fr)
+		if f == flowGoto {
+			target := -1
+			for j, stmt := range b.Stmts {
+				if l, ok := stmt.(*LabelStmt); ok && l.Name == fr.label {
+					target = j
+					break
+				}
+			}
+			if target < 0 {
+				return flowGoto
+			}
+			i = target
+			continue
+		}
+		if f != flowNormal {
+			return f
+		}
+	}
+	return flowNormal
+}
+
+func (in *Interp) exec(s Stmt, sc *scope, fr *frame) flow {
+	in.line = s.line()
+	in.step()
+
+	switch s := s.(type) {
+	case *LocalStmt:
+		values := in.evalMulti(s.Exprs, sc, fr)
+		for i, name := range s.Names {
+			var v Value
+			if i < len(values) {
+				v = values[i]
+			}
+			sc.declare(name, v)
+		}
+	case *AssignStmt:
+		in.assign(s, sc, fr)
+	case *OpAssignStmt:
+		// Evaluate the target's object and key once
+		switch t := s.Target.(type) {
+		case *NameExpr:
+			in.setVar(t.Name, in.arith(s.Op, in.getVar(t.Name, sc), in.eval(s.Value, sc, fr)), sc)
+		case *IndexExpr:
+			obj, key := in.eval(t.Obj, sc, fr), in.eval(t.Key, sc, fr)
+			in.setIndex(obj, key, in.arith(s.Op, in.index(obj, key), in.eval(s.Value, sc, fr)))
+		}
+	case *CallStmt:
+		in.evalCall(s.Call, sc, fr)
+	case *DoStmt:
+		return in.execBlock(s.Body, sc, fr)
+	case *WhileStmt:
+		for {
+			in.step()
+			if !Truthy(in.eval(s.Cond, sc, fr)) {
+				break
+			}
+			if f := in.execBlock(s.Body, sc, fr); f == flowBreak {
+				break
+			} else if f != flowNormal {
+				return f
+			}
+		}
+	case *RepeatStmt:
+		return in.execRepeat(s, sc, fr)
+	case *IfStmt:
+		if Truthy(in.eval(s.Cond, sc, fr)) {
+			return in.execBlock(s.Then, sc, fr)
+		} else if s.Else != nil {
+			return in.execBlock(s.Else, sc, fr)
+		}
+	case *NumericForStmt:
+		return in.execNumericFor(s, sc, fr)
+	case *GenericForStmt:
+		return in.execGenericFor(s, sc, fr)
+	case *FunctionStmt:
+		fn := &Closure{fn: s.Func, scope: sc}
+		switch t := s.Target.(type) {
+		case *NameExpr:
+			in.setVar(t.Name, fn, sc)
+		case *IndexExpr:
+			in.setIndex(in.eval(t.Obj, sc, fr), in.eval(t.Key, sc, fr), fn)
+		}
+	case *LocalFunctionStmt:
+		// Declared first so the function can call itself
+		sc.declare(s.Name, nil)
+		sc.values[len(sc.values)-1] = &Closure{fn: s.Func, scope: sc}
+	case *ReturnStmt:
+		fr.ret = in.evalMulti(s.Exprs, sc, fr)
+		return flowReturn
+	case *BreakStmt:
+		return flowBreak
+	case *GotoStmt:
+		fr.label = s.Label
+		return flowGoto
+	case *LabelStmt:
+	}
+	return flowNormal
+}
+
+// execRepeat runs repeat ... until; the condition can see the body's locals
+func (in *Interp) execRepeat(s *RepeatStmt, sc *scope, fr *frame) flow {
+	for {
+		in.step()
+		body := &scope{parent: sc}
+		f := in.execStmtsIn(s.Body, body, fr)
+		if f == flowBreak {
+			return flowNormal
+		}
+		if f != flowNormal {
+			return f
+		}
+		if Truthy(in.eval(s.Cond, body, fr)) {
+			return flowNormal
+		}
+	}
+}
+
+func (in *Interp) execNumericFor(s *NumericForStmt, sc *scope, fr *frame) flow {
+	start, ok1 := ToNumber(in.eval(s.Start, sc, fr))
+	limit, ok2 := ToNumber(in.eval(s.Limit, sc, fr))
+	step := IntNumber(1)
+	ok3 := true
+	if s.Step != nil {
+		step, ok3 = ToNumber(in.eval(s.Step, sc, fr))
+	}
+	if !ok1 || !ok2 || !ok3 {
+		in.Errorf("'for' initial value must be a number")
+	}
+	if step == 0 {
+		in.Errorf("'for' step is zero")
+	}
+	// Count in 64 bits so a limit of 32767 does not wrap around forever
+	for i := int64(start); (step > 0 && i <= int64(limit)) || (step < 0 && i >= int64(limit)); i += int64(step) {
+		in.step()
+		body := &scope{parent: sc}
+		body.declare(s.Var, Number(int32(i)))
+		if f := in.execStmtsIn(s.Body, body, fr); f == flowBreak {
+			break
+		} else if f != flowNormal {
+			return f
+		}
+	}
+	return flowNormal
+}
+
+func (in *Interp) execGenericFor(s *GenericForStmt, sc *scope, fr *frame) flow {
+	values := in.evalMulti(s.Exprs, sc, fr)
+	for len(values) < 3 {
+		values = append(values, nil)
+	}
+	iter, state, control := values[0], values[1], values[2]
+	for {
+		in.step()
+		results := in.call(iter, []Value{state, control})
+		if len(results) == 0 || results[0] == nil {
+			return flowNormal
+		}
+		control = results[0]
+		body := &scope{parent: sc}
+		for i, name := range s.Names {
+			var v Value
+			if i < len(results) {
+				v = results[i]
+			}
+			body.declare(name, v)
+		}
+		if f := in.execStmtsIn(s.Body, body, fr); f == flowBreak {
+			return flowNormal
+		} else if f != flowNormal {
+			return f
+		}
+	}
+}
+
+func (in *Interp) assign(s *AssignStmt, sc *scope, fr *frame) {
+	// Evaluate all table targets and values before assigning anything
+	type target struct {
+		obj, key Value
+		name     string
+	}
+	targets := make([]target, len(s.Targets))
+	for i, t := range s.Targets {
+		switch t := t.(type) {
+		case *NameExpr:
+			targets[i].name = t.Name
+		case *IndexExpr:
+			targets[i].obj, targets[i].key = in.eval(t.Obj, sc, fr), in.eval(t.Key, sc, fr)
+		}
+	}
+	values := in.evalMulti(s.Exprs, sc, fr)
+	for i, t := range targets {
+		var v Value
+		if i < len(values) {
+			v = values[i]
+		}
+		if t.name != "" {
+			in.setVar(t.name, v, sc)
+		} else {
+			in.setIndex(t.obj, t.key, v)
+		}
+	}
+}
+
+func (in *Interp) getVar(name string, sc *scope) Value {
+	if s, i := sc.lookup(name); s != nil {
+		return s.values[i]
+	}
+	return in.Globals.Get(name)
+}
+
+func (in *Interp) setVar(name string, v Value, sc *scope) {
+	if s, i := sc.lookup(name); s != nil {
+		s.values[i] = v
+		return
+	}
+	in.Globals.Set(name, v)
+}
+
+// evalMulti evaluates an expression list, expanding the last expression's results
+func (in *Interp) evalMulti(exprs []Expr, sc *scope, fr *frame) []Value {
+	values := make([]Value, 0, len(exprs))
+	for i, e := range exprs {
+		if i == len(exprs)-1 {
+			switch e.(type) {
+			case *CallExpr, *MethodCallExpr:
+				return append(values, in.evalCall(e, sc, fr)...)
+			case *VarargExpr:
+				return append(values, fr.varargs...)
+			}
+		}
+		values = append(values, in.eval(e, sc, fr))
+	}
+	return values
+}
+
+func (in *Interp) evalCall(e Expr, sc *scope, fr *frame) []Value {
+	line := e.line()
+	switch c := e.(type) {
+	case *CallExpr:
+		fn := in.eval(c.Fn, sc, fr)
+		args := in.evalMulti(c.Args, sc, fr)
+		in.line = line
+		if fn == nil {
+			if name, ok := c.Fn.(*NameExpr); ok {
+				in.Errorf("attempt to call a nil value (global '%s')", name.Name)
+			}
+		}
+		results := in.call(fn, args)
+		in.line = line
+		return results
+	case *MethodCallExpr:
+		obj := in.eval(c.Obj, sc, fr)
+		fn := in.index(obj, c.Method)
+		args := append([]Value{obj}, in.evalMulti(c.Args, sc, fr)...)
+		in.line = line
+		if fn == nil {
+			in.Errorf("attempt to call a nil value (method '%s')", c.Method)
+		}
+		results := in.call(fn, args)
+		in.line = line
+		return results
+	}
+	return []Value{in.eval(e, sc, fr)}
+}
+
+func (in *Interp) eval(e Expr, sc *scope, fr *frame) Value {
+	switch e := e.(type) {
+	case *NumberExpr:
+		return e.Value
+	case *StringExpr:
+		return e.Value
+	case *NilExpr:
+		return nil
+	case *TrueExpr:
+		return true
+	case *FalseExpr:
+		return false
+	case *VarargExpr:
+		if len(fr.varargs) > 0 {
+			return fr.varargs[0]
+		}
+		return nil
+	case *NameExpr:
+		return in.getVar(e.Name, sc)
+	case *IndexExpr:
+		obj := in.eval(e.Obj, sc, fr)
+		key := in.eval(e.Key, sc, fr)
+		in.line = e.Line
+		return in.index(obj, key)
+	case *CallExpr, *MethodCallExpr:
+		if results := in.evalCall(e, sc, fr); len(results) > 0 {
+			return results[0]
+		}
+		return nil
+	case *FunctionExpr:
+		return &Closure{fn: e, scope: sc}
+	case *ParenExpr:
+		return in.eval(e.Inner, sc, fr)
+	case *TableExpr:
+		return in.evalTable(e, sc, fr)
+	case *UnaryExpr:
+		return in.unary(e.Op, in.eval(e.Operand, sc, fr))
+	case *BinaryExpr:
+		switch e.Op {
+		case "and":
+			left := in.eval(e.Left, sc, fr)
+			if !Truthy(left) {
+				return left
+			}
+			return in.eval(e.Right, sc, fr)
+		case "or":
+			left := in.eval(e.Left, sc, fr)
+			if Truthy(left) {
+				return left
+			}
+			return in.eval(e.Right, sc, fr)
+		}
+		left, right := in.eval(e.Left, sc, fr), in.eval(e.Right, sc, fr)
+		in.line = e.Line
+		return in.binary(e.Op, left, right)
+	}
+	in.Errorf("cannot evaluate %T", e)
+	return nil
+}
+
+func (in *Interp) evalTable(e *TableExpr, sc *scope, fr *frame) *Table {
+	t := NewTable()
+	n := 1
+	for i, field := range e.Fields {
+		if field.Key != nil {
+			key := in.eval(field.Key, sc, fr)
+			if key == nil {
+				in.Errorf("table index is nil")
+			}
+			t.Set(key, in.eval(field.Value, sc, fr))
+			continue
+		}
+		if i == len(e.Fields)-1 {
+			for _, v := range in.evalMulti([]Expr{field.Value}, sc, fr) {
+				t.Set(IntNumber(n), v)
+				n++
+			}
+			continue
+		}
+		t.Set(IntNumber(n), in.eval(field.Value, sc, fr))
+		n++
+	}
+	return t
+}
+
+// metamethod returns the named metamethod of a table value, or nil
+func (in *Interp) metamethod(v Value, name string) Value {
+	if t, ok := v.(*Table); ok && t.Meta != nil {
+		return t.Meta.Get(name)
+	}
+	return nil
+}
+
+// index reads obj[key], following __index
+func (in *Interp) index(obj, key Value) Value {
+	for range 100 {
+		t, ok := obj.(*Table)
+		if !ok {
+			in.Errorf("attempt to index a %s value", TypeName(obj))
+		}
+		if v := t.Get(key); v != nil || t.Meta == nil {
+			return v
+		}
+		handler := t.Meta.Get("__index")
+		switch h := handler.(type) {
+		case nil:
+			return nil
+		case *Table:
+			obj = h
+		default:
+			return first(in.call(h, []Value{t, key}))
+		}
+	}
+	in.Errorf("'__index' chain too long; possible loop")
+	return nil
+}
+
+// Index reads obj[key] with metamethods, for builtins
+func (in *Interp) Index(obj, key Value) Value { return in.index(obj, key) }
+
+// setIndex writes obj[key] = v, following __newindex
+func (in *Interp) setIndex(obj, key, v Value) {
+	for range 100 {
+		t, ok := obj.(*Table)
+		if !ok {
+			in.Errorf("attempt to index a %s value", TypeName(obj))
+		}
+		if key == nil {
+			in.Errorf("table index is nil")
+		}
+		if t.Meta == nil || t.Get(key) != nil {
+			t.Set(key, v)
+			return
+		}
+		switch h := t.Meta.Get("__newindex").(type) {
+		case nil:
+			t.Set(key, v)
+			return
+		case *Table:
+			obj = h
+		default:
+			in.call(h, []Value{t, key, v})
+			return
+		}
+	}
+	in.Errorf("'__newindex' chain too long; possible loop")
+}
+
+func first(values []Value) Value {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+func (in *Interp) unary(op string, v Value) Value {
+	switch op {
+	case "not":
+		return !Truthy(v)
+	case "-":
+		if n, ok := ToNumber(v); ok {
+			return -n
+		}
+		if mm := in.metamethod(v, "__unm"); mm != nil {
+			return first(in.call(mm, []Value{v, v}))
+		}
+		in.Errorf("attempt to perform arithmetic on a %s value", TypeName(v))
+	case "#":
+		switch v := v.(type) {
+		case string:
+			return IntNumber(len(v))
+		case *Table:
+			if mm := in.metamethod(v, "__len"); mm != nil {
+				return first(in.call(mm, []Value{v}))
+			}
+			return IntNumber(v.Len())
+		}
+		in.Errorf("attempt to get length of a %s value", TypeName(v))
+	case "~":
+		return ^in.toNumber(v, "perform bitwise operation on")
+	case "@", "%", "$":
+		peek := map[string]string{"@": "peek", "%": "peek2", "$": "peek4"}[op]
+		return first(in.call(in.Globals.Get(peek), []Value{v}))
+	}
+	return nil
+}
+
+func (in *Interp) toNumber(v Value, what string) Number {
+	n, ok := ToNumber(v)
+	if !ok {
+		in.Errorf("attempt to %s a %s value", what, TypeName(v))
+	}
+	return n
+}
+
+// arithMeta maps operators to the metamethods that can overload them
+var arithMeta = map[string]string{
+	"+": "__add", "-": "__sub", "*": "__mul", "/": "__div", "%": "__mod", "^": "__pow",
+	"\\": "__idiv", "&": "__and", "|": "__or", "^^": "__xor", "~": "__xor",
+	"<<": "__shl", ">>": "__shr", ">>>": "__lshr", "<<>": "__rotl", ">><": "__rotr", "..": "__concat",
+}
+
+// arith applies an arithmetic, bitwise or concatenation operator
+func (in *Interp) arith(op string, a, b Value) Value {
+	if op == ".." {
+		as, aok := concatString(a)
+		bs, bok := concatString(b)
+		if aok && bok {
+			return as + bs
+		}
+	} else {
+		x, xok := ToNumber(a)
+		y, yok := ToNumber(b)
+		if xok && yok {
+			return numberArith(op, x, y)
+		}
+	}
+	for _, v := range []Value{a, b} {
+		if mm := in.metamethod(v, arithMeta[op]); mm != nil {
+			return first(in.call(mm, []Value{a, b}))
+		}
+	}
+	bad := a
+	if op == ".." {
+		if _, ok := concatString(a); ok {
+			bad = b
+		}
+		in.Errorf("attempt to concatenate a %s value", TypeName(bad))
+	}
+	if _, ok := ToNumber(a); ok {
+		bad = b
+	}
+	in.Errorf("attempt to perform arithmetic on a %s value", TypeName(bad))
+	return nil
+}
+
+func concatString(v Value) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+func (in *Interp) binary(op string, a, b Value) Value {
+	switch op {
+	case "==":
+		return in.equal(a, b)
+	case "~=", "!=":
+		return !in.equal(a, b)
+	case "<":
+		return in.less(a, b, "__lt")
+	case ">":
+		return in.less(b, a, "__lt")
+	case "<=":
+		return in.less(a, b, "__le")
+	case ">=":
+		return in.less(b, a, "__le")
+	}
+	return in.arith(op, a, b)
+}
+
+func (in *Interp) equal(a, b Value) bool {
+	if a == b {
+		return true
+	}
+	ta, ok1 := a.(*Table)
+	tb, ok2 := b.(*Table)
+	if ok1 && ok2 {
+		mm := in.metamethod(ta, "__eq")
+		if mm == nil {
+			mm = in.metamethod(tb, "__eq")
+		}
+		if mm != nil {
+			return Truthy(first(in.call(mm, []Value{a, b})))
+		}
+	}
+	return false
+}
+
+// less implements < (mm "__lt") and <= (mm "__le")
+func (in *Interp) less(a, b Value, mm string) bool {
+	switch x := a.(type) {
+	case Number:
+		if y, ok := b.(Number); ok {
+			if mm == "__lt" {
+				return x < y
+			}
+			return x <= y
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			if mm == "__lt" {
+				return x < y
+			}
+			return x <= y
+		}
+	}
+	for _, v := range []Value{a, b} {
+		if h := in.metamethod(v, mm); h != nil {
+			return Truthy(first(in.call(h, []Value{a, b})))
+		}
+	}
+	in.Errorf("attempt to compare %s with %s", TypeName(a), TypeName(b))
+	return false
+}
@@ -0,0 +1,213 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+// run executes src and returns what it printed with printh, one line per call
+func run(t *testing.T, src string) (string, error) {
+	t.Helper()
+	in := New()
+	var out strings.Builder
+	in.Printh = &out
+	err := in.Exec(src)
+	return strings.TrimSuffix(out.String(), "\n"), err
+}
+
+type runTest struct {
+	name string
+	src  string
+	want string
+}
+
+func checkRuns(t *testing.T, tests []runTest) {
+	t.Helper()
+	for _, tt := range tests {
+		got, err := run(t, tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s printed\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"precedence", "printh(1 + 2 * 3) printh(2 ^ 3 ^ 2) printh(-2 ^ 2)", "7\n512\n-4"},
+		{"division", "printh(1 / 3) printh(7 / 2) printh(1 / 0 == 0x7fff.ffff)", "0.3333\n3.5\ntrue"},
+		{"floor division", "printh(7 \\ 2) printh(-7 \\ 2) printh(7 \\ -2) printh(7.5 \\ 1)", "3\n-4\n-4\n7"},
+		{"modulo", "printh(7 % 3) printh(-7 % 3) printh(7 % -3) printh(5.5 % 2) printh(5 % 0)", "1\n2\n-2\n1.5\n0"},
+		{"wraparound", "printh(32767 + 1) printh(-32768 - 1) printh(200 * 200)", "-32768\n32767\n-25536"},
+		{"shifts", "printh(1 << 4) printh(-8 >> 1) printh(-1 >>> 16 == 0x.ffff) printh(1 >> 1)", "16\n-4\ntrue\n0.5"},
+		{"rotates", "printh(1 <<> 16 == 0x.0001) printh(0x.0001 >>< 1 == 0x8000)", "true\ntrue"},
+		{"bitwise", "printh(6 & 3) printh(6 | 3) printh(6 ^^ 3) printh(~0 == -0x.0001)", "2\n7\n5\ntrue"},
+		{"builtin shifts", "printh(shl(1, 2)) printh(shr(-8, 1)) printh(lshr(-1, 16) == 0x.ffff) printh(rotl(1, 16) == 0x.0001)", "4\n-4\ntrue\ntrue"},
+		{"string coercion", "printh(\"10\" + 1) printh(1 .. 2) printh(\"0x10\" * 1)", "11\n12\n16"},
+		{"compound assignment", "x = 5 x += 2 x *= 3 x \\= 2 x %= 7 x ..= \"!\" printh(x)", "3!"},
+		{"comparison", "printh(1 < 2, \"a\" < \"b\", 1 == \"1\", 1 != 2)", "true"},
+		{"length", "printh(#\"abc\") printh(#{1, 2, 3})", "3\n3"},
+		{"logic", "printh(nil or 1) printh(false and 1) printh(1 and 2) printh(not nil)", "1\nfalse\n2\ntrue"},
+	})
+}
+
+func TestControlFlow(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"numeric for", "s = 0 for i = 1, 10 do s += i end printh(s)", "55"},
+		{"for with step", "s = \"\" for i = 10, 1, -3 do s ..= i end printh(s)", "10741"},
+		{"for up to the limit", "n = 0 for i = 32760, 32767 do n += 1 end printh(n)", "8"},
+		{"while and break", "i = 0 while true do i += 1 if i == 5 then break end end printh(i)", "5"},
+		{"repeat sees body locals", "i = 0 repeat local j = i i += 1 until j >= 3 printh(i)", "4"},
+		{"short if", "x = 1\nif (x == 1) printh(\"one\") else printh(\"other\")\nprinth(\"after\")", "one\nafter"},
+		{"short while", "x = 3\nwhile (x > 0) x -= 1\nprinth(x)", "0"},
+		{"elseif", "for i = 1, 3 do if i == 1 then printh(\"a\") elseif i == 2 then printh(\"b\") else printh(\"c\") end end", "a\nb\nc"},
+		{"goto continue", "for i = 1, 4 do if i % 2 == 0 then goto continue end printh(i) ::continue:: end", "1\n3"},
+		{"goto backwards", "i = 0 ::top:: i += 1 if i < 3 then goto top end printh(i)", "3"},
+		{"goto out of nested blocks", "for i = 1, 3 do for j = 1, 3 do if j == 2 then goto done end end end ::done:: printh(\"out\")", "out"},
+		{"generic for", "t = {} for k, v in pairs({a = 1}) do printh(k .. v) end", "a1"},
+		{"ipairs stops at nil", "for i, v in ipairs({1, 2, nil, 4}) do printh(i) end", "1\n2"},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"closures share upvalues", `
+function counter()
+ local n = 0
+ return function() n += 1 return n end, function() return n end
+end
+inc, get = counter()
+inc() inc()
+printh(get())`, "2"},
+		{"each call gets fresh locals", `
+function counter() local n = 0 return function() n += 1 return n end end
+a, b = counter(), counter()
+a() a()
+printh(a() .. b())`, "31"},
+		{"loops capture a new variable per iteration", `
+fns = {}
+for i = 1, 3 do add(fns, function() return i end) end
+printh(fns[1]() .. fns[2]() .. fns[3]())`, "123"},
+		{"recursion", "local function fib(n) if n < 2 then return n end return fib(n - 1) + fib(n - 2) end printh(fib(15))", "610"},
+		{"varargs", "function f(...) local a, b = ... return select(\"#\", ...), b end printh(f(1, 2, 3))", "3"},
+		{"multiple results", "function f() return 1, 2 end local a, b, c = f() printh(b) printh(c) local d, e = (f()) printh(e)", "2\n[nil]\n[nil]"},
+		{"methods", `
+obj = {n = 2}
+function obj:twice(x) return self.n * x end
+printh(obj:twice(21))`, "42"},
+	})
+}
+
+func TestMetatables(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"__index table", `
+base = {hp = 10}
+obj = setmetatable({}, {__index = base})
+printh(obj.hp) obj.hp = 3 printh(obj.hp) printh(base.hp)`, "10\n3\n10"},
+		{"__index function", "t = setmetatable({}, {__index = function(t, k) return k .. \"!\" end}) printh(t.hi)", "hi!"},
+		{"__newindex", "log = {} t = setmetatable({}, {__newindex = function(t, k, v) rawset(t, k, v * 2) end}) t.x = 4 printh(t.x)", "8"},
+		{"arithmetic metamethods", `
+v = {}
+v.__add = function(a, b) return setmetatable({x = a.x + b.x}, v) end
+v.__eq = function(a, b) return a.x == b.x end
+v.__lt = function(a, b) return a.x < b.x end
+v.__unm = function(a) return setmetatable({x = -a.x}, v) end
+a, b = setmetatable({x = 1}, v), setmetatable({x = 2}, v)
+printh((a + b).x) printh((-a).x) printh(a == setmetatable({x = 1}, v)) printh(a < b)`, "3\n-1\ntrue\ntrue"},
+		{"__call", "t = setmetatable({}, {__call = function(self, x) return x + 1 end}) printh(t(1))", "2"},
+		{"__concat and __len", "t = setmetatable({}, {__concat = function(a, b) return \"cat\" end, __len = function() return 7 end}) printh(t .. \"x\") printh(#t)", "cat\n7"},
+		{"getmetatable", "mt = {} t = setmetatable({}, mt) printh(getmetatable(t) == mt)", "true"},
+	})
+}
+
+func TestCoroutines(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"yield and resume", `
+co = cocreate(function(a)
+ local b = yield(a + 1)
+ yield(b * 2)
+ return "done"
+end)
+printh(costatus(co))
+_, x = coresume(co, 1) printh(x)
+_, x = coresume(co, 10) printh(x)
+_, x = coresume(co) printh(x)
+printh(costatus(co))
+ok, err = coresume(co) printh(ok) printh(err)`, "suspended\n2\n20\ndone\ndead\nfalse\nline 12: cannot resume dead coroutine"},
+		{"errors inside", "co = cocreate(function() assert(false, \"boom\") end) ok, err = coresume(co) printh(ok) printh(err)", "false\nline 1: boom"},
+		{"nested", `
+inner = cocreate(function() yield(1) end)
+outer = cocreate(function() coresume(inner) printh(costatus(inner)) yield() end)
+coresume(outer)
+printh(costatus(outer))`, "suspended\nsuspended"},
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x = nil + 1", "line 1: attempt to perform arithmetic on a nil value"},
+		{"\n\nlocal t = nil\nprinth(t.x)", "line 4: attempt to index a nil value"},
+		{"f()", "line 1: attempt to call a nil value (global 'f')"},
+		{"function f()\n assert(false, \"bad\")\nend\nf()", "line 2: bad"},
+		{"assert(false, \"nope\")", "line 1: nope"},
+		{"for i = 1, 10, 0 do end", "line 1: 'for' step is zero"},
+		{"goto nowhere", "line 1: no visible label 'nowhere' for goto"},
+		{"yield()", "line 1: attempt to yield from outside a coroutine"},
+		{"x = 1 < \"2\"", "line 1: attempt to compare number with string"},
+	}
+	for _, tt := range tests {
+		_, err := run(t, tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q error = %v; want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestStepBudget(t *testing.T) {
+	tests := []string{
+		"while true do end",
+		"repeat until false",
+		"for i = 1, 32767 do for j = 1, 32767 do end end",
+		"function f() end while true do f() end",
+		"::l:: goto l",
+	}
+	for _, src := range tests {
+		in := New()
+		in.MaxSteps = 10000
+		err := in.Exec(src)
+		if err == nil || !strings.Contains(err.Error(), "too many instructions") {
+			t.Errorf("%q error = %v; want the step budget to run out", src, err)
+		}
+	}
+
+	in := New()
+	in.MaxSteps = 10000
+	if err := in.Exec("for i = 1, 100 do end"); err != nil {
+		t.Errorf("a short loop ran out of steps: %v", err)
+	}
+	in.ResetSteps()
+	if err := in.Exec("for i = 1, 100 do end"); err != nil {
+		t.Errorf("ResetSteps didn't restore the budget: %v", err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := run(t, "function f(n) return f(n + 1) + 1 end f(1)")
+	if err == nil || !strings.Contains(err.Error(), "stack overflow") {
+		t.Errorf("error = %v; want a stack overflow", err)
+	}
+	// The interpreter stays usable afterwards
+	in := New()
+	in.Exec("function f() f() end f()") //nolint:errcheck
+	var out strings.Builder
+	in.Printh = &out
+	if err := in.Exec("printh(\"ok\")"); err != nil || out.String() != "ok\n" {
+		t.Errorf("after a stack overflow: %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,357 @@
+// Package lua implements the PICO-8 dialect of Lua: a lexer, a parser producing
+// an AST, and a tree-walking interpreter with 16.16 fixed-point numbers.
+package lua
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drpaneas/parsepico/fixed"
+)
+
+// TokenKind classifies a token
+type TokenKind int
+
+// Token kinds
+const (
+	TokEOF TokenKind = iota
+	TokName
+	TokNumber
+	TokString
+	TokKeyword
+	TokOp
+)
+
+// Token is one lexical token. Line is 1-based and Pos is the byte offset of
+// the token in the source. Newline reports whether a line break separates it
+// from the previous token, which the single line forms of if and while need.
+type Token struct {
+	Kind    TokenKind
+	Text    string // source text; for strings the decoded value
+	Raw     string // a string literal as written, quotes and escapes included
+	Num     Number // value of a number token
+	Line    int
+	Pos     int
+	Newline bool
+}
+
+// Comment is a comment as written and the line and byte offset it starts at.
+// Own is set when nothing but whitespace comes before it on that line.
+type Comment struct {
+	Text string
+	Line int
+	Pos  int
+	Own  bool
+}
+
+// keywords are the reserved words of Lua
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "goto": true, "if": true, "in": true,
+	"local": true, "nil": true, "not": true, "or": true, "repeat": true, "return": true,
+	"then": true, "true": true, "until": true, "while": true,
+}
+
+// operators lists every operator and punctuation token, longest first so that
+// the lexer can match greedily
+var operators = []string{
+	">>>=", "<<>=", ">><=",
+	"...", "..=", ">>>", "<<>", ">><", "^^=", "<<=", ">>=",
+	"==", "~=", "!=", "<=", ">=", "..", "::", "<<", ">>", "^^",
+	"+=", "-=", "*=", "/=", "\\=", "%=", "^=", "|=", "&=",
+	"+", "-", "*", "/", "\\", "%", "^", "#", "&", "|", "~", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".", "@", "$", "?",
+}
+
+// Error is a syntax or runtime error with the source line it happened on
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// Lex splits source code into tokens
+func Lex(src string) ([]Token, error) {
+	tokens, _, err := LexComments(src)
+	return tokens, err
+}
+
+// LexComments splits source code into tokens and also returns the comments
+// between them
+func LexComments(src string) ([]Token, []Comment, error) {
+	lx := &lexer{src: src, line: 1}
+	var tokens []Token
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == TokEOF {
+			return tokens, lx.comments, nil
+		}
+	}
+}
+
+type lexer struct {
+	src      string
+	pos      int
+	line     int
+	newline  bool
+	comments []Comment
+}
+
+// comment records the comment from start to the current position
+func (lx *lexer) comment(start, line int) {
+	lineStart := strings.LastIndexByte(lx.src[:start], '\n') + 1
+	own := strings.TrimLeft(lx.src[lineStart:start], " \t\r") == ""
+	lx.comments = append(lx.comments, Comment{Text: lx.src[start:lx.pos], Line: line, Pos: start, Own: own})
+}
+
+func (lx *lexer) errorf(format string, args ...any) error {
+	return &Error{Line: lx.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipSpace skips whitespace and comments, noting line breaks
+func (lx *lexer) skipSpace() error {
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\n':
+			lx.line++
+			lx.newline = true
+			lx.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			lx.pos++
+		case strings.HasPrefix(lx.src[lx.pos:], "--"):
+			start, line := lx.pos, lx.line
+			lx.pos += 2
+			if level, ok := longBracket(lx.src[lx.pos:]); ok {
+				if _, err := lx.longString(level); err != nil {
+					return err
+				}
+				lx.comment(start, line)
+				continue
+			}
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.pos++
+			}
+			lx.comment(start, line)
+		case strings.HasPrefix(lx.src[lx.pos:], "//"):
+			// PICO-8 also accepts C style line comments
+			start := lx.pos
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.pos++
+			}
+			lx.comment(start, lx.line)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (lx *lexer) next() (Token, error) {
+	lx.newline = false
+	if err := lx.skipSpace(); err != nil {
+		return Token{}, err
+	}
+	tok := Token{Line: lx.line, Pos: lx.pos, Newline: lx.newline}
+	if lx.pos >= len(lx.src) {
+		tok.Kind = TokEOF
+		return tok, nil
+	}
+
+	c := lx.src[lx.pos]
+	switch {
+	case isDigit(c) || (c == '.' && lx.pos+1 < len(lx.src) && isDigit(lx.src[lx.pos+1])):
+		start := lx.pos
+		for lx.pos < len(lx.src) && (isNameChar(lx.src[lx.pos]) || lx.src[lx.pos] == '.') && lx.src[lx.pos] < 0x80 {
+			if strings.HasPrefix(lx.src[lx.pos:], "..") {
+				break // 1..x is a concatenation
+			}
+			lx.pos++
+		}
+		tok.Kind, tok.Text = TokNumber, lx.src[start:lx.pos]
+		n, ok := fixed.ParseLiteral(tok.Text)
+		if !ok {
+			return tok, lx.errorf("malformed number near %s", tok.Text)
+		}
+		tok.Num = n
+	case isNameStart(c):
+		start := lx.pos
+		for lx.pos < len(lx.src) && isNameChar(lx.src[lx.pos]) {
+			lx.pos++
+		}
+		tok.Kind, tok.Text = TokName, lx.src[start:lx.pos]
+		if keywords[tok.Text] {
+			tok.Kind = TokKeyword
+		}
+	case c == '"' || c == '\'':
+		start := lx.pos
+		s, err := lx.quotedString(c)
+		if err != nil {
+			return tok, err
+		}
+		tok.Kind, tok.Text, tok.Raw = TokString, s, lx.src[start:lx.pos]
+	case c == '[':
+		if level, ok := longBracket(lx.src[lx.pos:]); ok {
+			start := lx.pos
+			s, err := lx.longString(level)
+			if err != nil {
+				return tok, err
+			}
+			tok.Kind, tok.Text, tok.Raw = TokString, s, lx.src[start:lx.pos]
+			break
+		}
+		fallthrough
+	default:
+		for _, op := range operators {
+			if strings.HasPrefix(lx.src[lx.pos:], op) {
+				lx.pos += len(op)
+				tok.Kind, tok.Text = TokOp, op
+				return tok, nil
+			}
+		}
+		return tok, lx.errorf("unexpected symbol %q", c)
+	}
+	return tok, nil
+}
+
+// longBracket reports whether s starts with [[ or [==[ and returns the level
+func longBracket(s string) (int, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return 0, false
+	}
+	level := 1
+	for level < len(s) && s[level] == '=' {
+		level++
+	}
+	if level < len(s) && s[level] == '[' {
+		return level - 1, true
+	}
+	return 0, false
+}
+
+// longString reads a [==[ ... ]==] string or comment body
+func (lx *lexer) longString(level int) (string, error) {
+	lx.pos += level + 2
+	closing := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(lx.src[lx.pos:], closing)
+	if end < 0 {
+		return "", lx.errorf("unfinished long string")
+	}
+	s := lx.src[lx.pos : lx.pos+end]
+	lx.line += strings.Count(s, "\n")
+	lx.pos += end + len(closing)
+	// A newline right after the opening bracket is not part of the string
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "\r"), "\n")
+	return s, nil
+}
+
+// quotedString reads a '...' or "..." string and decodes its escapes
+func (lx *lexer) quotedString(quote byte) (string, error) {
+	lx.pos++
+	var out strings.Builder
+	for {
+		if lx.pos >= len(lx.src) || lx.src[lx.pos] == '\n' {
+			return "", lx.errorf("unfinished string")
+		}
+		c := lx.src[lx.pos]
+		lx.pos++
+		if c == quote {
+			return out.String(), nil
+		}
+		if c != '\\' {
+			out.WriteByte(c)
+			continue
+		}
+		if lx.pos >= len(lx.src) {
+			return "", lx.errorf("unfinished string")
+		}
+		e := lx.src[lx.pos]
+		lx.pos++
+		switch e {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case 'a':
+			out.WriteByte('\a')
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case 'v':
+			out.WriteByte('\v')
+		case '\n':
+			lx.line++
+			out.WriteByte('\n')
+		case '*', '#', '-', '|', '+', '^':
+			// PICO-8's escapes for the P8SCII control codes 1..6
+			out.WriteByte(byte(strings.IndexByte(p8sciiEscapes, e) + 1))
+		case 'x':
+			if lx.pos+2 > len(lx.src) {
+				return "", lx.errorf("hexadecimal digit expected")
+			}
+			hi, lo := hexValue(lx.src[lx.pos]), hexValue(lx.src[lx.pos+1])
+			if hi < 0 || lo < 0 {
+				return "", lx.errorf("hexadecimal digit expected")
+			}
+			out.WriteByte(byte(hi*16 + lo))
+			lx.pos += 2
+		case 'z':
+			for lx.pos < len(lx.src) && strings.IndexByte(" \t\r\n", lx.src[lx.pos]) >= 0 {
+				if lx.src[lx.pos] == '\n' {
+					lx.line++
+				}
+				lx.pos++
+			}
+		default:
+			if isDigit(e) {
+				v := int(e - '0')
+				for i := 0; i < 2 && lx.pos < len(lx.src) && isDigit(lx.src[lx.pos]); i++ {
+					v = v*10 + int(lx.src[lx.pos]-'0')
+					lx.pos++
+				}
+				out.WriteByte(byte(v))
+			} else {
+				out.WriteByte(e)
+			}
+		}
+	}
+}
+
+// p8sciiEscapes are the characters after a backslash that stand for the
+// control codes 1..6, in order
+const p8sciiEscapes = "*#-|+^"
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// isNameStart accepts bytes of multi-byte characters too, so PICO-8 glyphs such
+// as ⬅️ and 🅾️ lex as names
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isNameChar(c byte) bool { return isNameStart(c) || isDigit(c) }
+
+func hexValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
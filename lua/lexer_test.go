@@ -0,0 +1,152 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexStringEscapes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`'\t\r\a\b\f\v'`, "\t\r\a\b\f\v"},
+		{`"\"'"`, `"'`},
+		{`"\\"`, `\`},
+		{`"\65\066\0677"`, "ABC7"},
+		{`"\x41\x7a"`, "Az"},
+		{`"\xfF"`, "\xff"},
+		{`"\*\#\-\|\+\^"`, "\x01\x02\x03\x04\x05\x06"},
+		{"\"a\\z  \n  b\"", "ab"},
+		{"\"a\\\nb\"", "a\nb"},
+		{"[[a\\nb]]", `a\nb`},
+		{"[[\nfirst]]", "first"},
+		{"[==[a]]b]==]", "a]]b"},
+	}
+	for _, tt := range tests {
+		tokens, err := Lex(tt.src)
+		if err != nil {
+			t.Errorf("Lex(%s): %v", tt.src, err)
+			continue
+		}
+		if tokens[0].Kind != TokString || tokens[0].Text != tt.want || tokens[0].Raw != tt.src {
+			t.Errorf("Lex(%s) = %q (raw %q); want %q", tt.src, tokens[0].Text, tokens[0].Raw, tt.want)
+		}
+	}
+}
+
+func TestLexNumbers(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Number
+	}{
+		{"0", 0},
+		{"123", IntNumber(123)},
+		{"1.5", 0x18000},
+		{".25", 0x4000},
+		{"0x10", IntNumber(16)},
+		{"0x.8", 0x8000},
+		{"0b101", IntNumber(5)},
+		{"0b.1", 0x8000},
+		{"32768", IntNumber(-32768)},
+	}
+	for _, tt := range tests {
+		tokens, err := Lex(tt.src)
+		if err != nil {
+			t.Errorf("Lex(%s): %v", tt.src, err)
+			continue
+		}
+		if tokens[0].Kind != TokNumber || tokens[0].Num != tt.want || tokens[0].Text != tt.src {
+			t.Errorf("Lex(%s) = %s; want %s", tt.src, tokens[0].Num.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"\xfz"`, "line 1: hexadecimal digit expected"},
+		{`"\xz1"`, "line 1: hexadecimal digit expected"},
+		{`"\x4`, "line 1: hexadecimal digit expected"},
+		{"x = 1\n\"abc", "line 2: unfinished string"},
+		{"\"abc\ndef\"", "line 1: unfinished string"},
+		{"x = [[abc", "line 1: unfinished long string"},
+		{"--[[ never\nclosed", "line 1: unfinished long string"},
+		{"\n\nx = 0x1g", "line 3: malformed number near 0x1g"},
+		{"x = 1`", "line 1: unexpected symbol '`'"},
+	}
+	for _, tt := range tests {
+		_, err := Lex(tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Lex(%q) error = %v; want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestLexOperatorsAndNumbersTogether(t *testing.T) {
+	// 1..2 is a concatenation and >>>= wins over >>= and >>
+	tokens, err := Lex("a=1..2 b>>>=1 c\\=2 d!=e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, tok := range tokens[:len(tokens)-1] {
+		texts = append(texts, tok.Text)
+	}
+	want := "a = 1 .. 2 b >>>= 1 c \\= 2 d != e"
+	if got := strings.Join(texts, " "); got != want {
+		t.Errorf("tokens = %q; want %q", got, want)
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	src := "a=1 -- trailing\n--[==[ long\n]] still ]==]\n// c style\nb=[[--not a comment]]"
+	tokens, comments, err := LexComments(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Comment{
+		{Text: "-- trailing", Line: 1, Pos: 4, Own: false},
+		{Text: "--[==[ long\n]] still ]==]", Line: 2, Pos: 16, Own: true},
+		{Text: "// c style", Line: 4, Pos: 42, Own: true},
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("comments = %+v; want %+v", comments, want)
+	}
+	for i := range want {
+		if comments[i] != want[i] {
+			t.Errorf("comment %d = %+v; want %+v", i, comments[i], want[i])
+		}
+	}
+	last := tokens[len(tokens)-2]
+	if last.Kind != TokString || last.Text != "--not a comment" || last.Line != 5 || last.Pos != 55 {
+		t.Errorf("last token = %+v; want the long string on line 5 at 55", last)
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{"x = 1", 3},
+		{"x = -1", 3},               // a negative literal is one token
+		{"x = y - 1", 5},            // but a binary minus is not
+		{"local a, b = f(1, 2)", 7}, // local, commas and ) are free
+		{"t = {1, 2}", 5},
+		{"if a then b() end", 5},
+		{"print(\"hi\") -- comment", 3},
+	}
+	for _, tt := range tests {
+		tokens, err := Lex(tt.src)
+		if err != nil {
+			t.Fatalf("Lex(%q): %v", tt.src, err)
+		}
+		if got := CountTokens(tokens); got != tt.want {
+			t.Errorf("CountTokens(%q) = %d; want %d", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package lua
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MinifyOptions controls how far Minify goes in renaming. Locals are always
+// renamed; globals and fields are only safe to rename when no code reaches
+// them through computed strings, so they are opt-in.
+type MinifyOptions struct {
+	RenameGlobals bool            // rename globals the program assigns
+	RenameFields  bool            // rename fields written as names: t.x, t["x"], {x=1}, t:x()
+	Preserve      map[string]bool // globals and fields never renamed, e.g. the PICO-8 API
+}
+
+// Minify rewrites a chunk to use as few tokens and characters as possible and
+// returns the new source. The block is changed in place. The warnings point at
+// code that may reach renamed fields by computed keys, where renaming can't be
+// proven safe.
+func Minify(b *Block, opts MinifyOptions) (string, []string) {
+	foldConstants(b)
+	shortenStatements(b)
+	warnings := rename(b, opts)
+	return printCompact(b), warnings
+}
+
+// foldConstants evaluates arithmetic and bitwise operations on number literals
+// with the same fixed-point math the cart would run
+func foldConstants(n Node) {
+	forEachChild(n, func(child Node, replace func(Expr)) {
+		foldConstants(child)
+		if replace == nil {
+			return
+		}
+		if folded := foldExpr(child.(Expr)); folded != nil {
+			replace(folded)
+		}
+	})
+}
+
+// foldableOps are the binary operators foldConstants evaluates. ^ is left
+// out: it goes through floating point, so PICO-8 might round differently.
+var foldableOps = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "\\": true, "%": true,
+	"&": true, "|": true, "^^": true, "<<": true, ">>": true, ">>>": true, "<<>": true, ">><": true,
+}
+
+// foldExpr returns the literal e evaluates to, or nil
+func foldExpr(e Expr) Expr {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		a, ok1 := e.Left.(*NumberExpr)
+		b, ok2 := e.Right.(*NumberExpr)
+		if ok1 && ok2 && foldableOps[e.Op] {
+			return &NumberExpr{Pos: e.Pos, Value: numberArith(e.Op, a.Value, b.Value)}
+		}
+	case *UnaryExpr:
+		if n, ok := e.Operand.(*NumberExpr); ok {
+			switch e.Op {
+			case "-":
+				return &NumberExpr{Pos: e.Pos, Value: n.Value.Neg()}
+			case "~":
+				return &NumberExpr{Pos: e.Pos, Value: n.Value.Not()}
+			}
+		}
+	case *ParenExpr:
+		if n, ok := e.Inner.(*NumberExpr); ok {
+			return n
+		}
+	}
+	return nil
+}
+
+// shortenStatements turns a = a + b into a += b and drops trailing nils from
+// local declarations
+func shortenStatements(root *Block) {
+	Inspect(root, func(n Node) bool {
+		b, ok := n.(*Block)
+		if !ok {
+			return true
+		}
+		for i, s := range b.Stmts {
+			switch s := s.(type) {
+			case *AssignStmt:
+				if len(s.Targets) != 1 || len(s.Exprs) != 1 {
+					continue
+				}
+				bin, ok := s.Exprs[0].(*BinaryExpr)
+				if !ok || !isCompoundOp(bin.Op) || !sameTarget(s.Targets[0], bin.Left) {
+					continue
+				}
+				b.Stmts[i] = &OpAssignStmt{Pos: s.Pos, Op: bin.Op, Target: s.Targets[0], Value: bin.Right}
+			case *LocalStmt:
+				// local a,b=1,nil is local a,b=1, unless dropping the nil
+				// would let a call in last place fill b
+				for len(s.Exprs) > 0 {
+					if _, ok := s.Exprs[len(s.Exprs)-1].(*NilExpr); !ok {
+						break
+					}
+					if len(s.Exprs) > 1 && multiValued(s.Exprs[len(s.Exprs)-2]) {
+						break
+					}
+					s.Exprs = s.Exprs[:len(s.Exprs)-1]
+				}
+			}
+		}
+		return true
+	})
+}
+
+func isCompoundOp(op string) bool {
+	for _, binary := range compoundOps {
+		if binary == op {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTarget reports whether two expressions name the same variable or field
+// without calling anything on the way there
+func sameTarget(a, b Expr) bool {
+	switch a := a.(type) {
+	case *NameExpr:
+		b, ok := b.(*NameExpr)
+		return ok && a.Name == b.Name
+	case *IndexExpr:
+		b, ok := b.(*IndexExpr)
+		return ok && sameTarget(a.Obj, b.Obj) && sameConstant(a.Key, b.Key)
+	}
+	return false
+}
+
+func sameConstant(a, b Expr) bool {
+	switch a := a.(type) {
+	case *StringExpr:
+		b, ok := b.(*StringExpr)
+		return ok && a.Value == b.Value
+	case *NumberExpr:
+		b, ok := b.(*NumberExpr)
+		return ok && a.Value == b.Value
+	}
+	return false
+}
+
+// multiValued reports whether an expression can produce several values
+func multiValued(e Expr) bool {
+	switch e.(type) {
+	case *CallExpr, *MethodCallExpr, *VarargExpr:
+		return true
+	}
+	return false
+}
+
+// binding is one local variable
+type binding struct {
+	refs    []*string       // the declaration and every use
+	live    []*binding      // bindings in scope where this one is declared
+	globals map[string]bool // globals used while this one is in scope
+	fixed   bool            // the implicit self of a method
+	name    string          // the new name
+}
+
+// renamer resolves every name in a chunk to a local binding or a global
+type renamer struct {
+	scopes   []map[string]*binding
+	active   []*binding // bindings in scope, outermost first
+	marks    []int      // len(active) when each scope opened
+	locals   []*binding // every binding, in declaration order
+	globals  map[string][]*string
+	assigned map[string]bool  // globals the chunk assigns to
+	isLocal  map[*string]bool // names that refer to a local
+}
+
+// rename gives locals, and optionally globals and fields, the shortest names
+// that keep every reference pointing at the same thing
+func rename(b *Block, opts MinifyOptions) []string {
+	r := &renamer{globals: make(map[string][]*string), assigned: make(map[string]bool), isLocal: make(map[*string]bool)}
+	r.node(b)
+
+	// Fields first, while locals still have the names the warnings quote
+	var warnings []string
+	if opts.RenameFields {
+		warnings = renameFields(b, opts.Preserve, func(n *NameExpr) bool { return r.isLocal[&n.Name] })
+	}
+
+	newGlobal := make(map[string]string)
+	if opts.RenameGlobals {
+		var candidates []string
+		taken := make(map[string]bool)
+		for name := range opts.Preserve {
+			taken[name] = true
+		}
+		for name := range r.globals {
+			if r.assigned[name] && !opts.Preserve[name] {
+				candidates = append(candidates, name)
+			} else {
+				taken[name] = true
+			}
+		}
+		assignShortNames(candidates, func(name string) int { return len(r.globals[name]) }, taken, newGlobal)
+	}
+	finalGlobal := func(name string) string {
+		if n, ok := newGlobal[name]; ok {
+			return n
+		}
+		return name
+	}
+	for name, refs := range r.globals {
+		for _, ref := range refs {
+			*ref = finalGlobal(name)
+		}
+	}
+
+	for _, l := range r.locals {
+		if l.fixed {
+			l.name = *l.refs[0]
+			continue
+		}
+		taken := make(map[string]bool)
+		for _, other := range l.live {
+			taken[other.name] = true
+		}
+		for g := range l.globals {
+			taken[finalGlobal(g)] = true
+		}
+		for i := 0; ; i++ {
+			if name := shortName(i); !keywords[name] && !taken[name] {
+				l.name = name
+				break
+			}
+		}
+		for _, ref := range l.refs {
+			*ref = l.name
+		}
+	}
+	return warnings
+}
+
+// assignShortNames maps each name to the next free short name, the most used
+// names first
+func assignShortNames(names []string, uses func(string) int, taken map[string]bool, out map[string]string) {
+	sort.Slice(names, func(i, j int) bool {
+		if uses(names[i]) != uses(names[j]) {
+			return uses(names[i]) > uses(names[j])
+		}
+		return names[i] < names[j]
+	})
+	next := 0
+	for _, name := range names {
+		for {
+			short := shortName(next)
+			next++
+			if !keywords[short] && !taken[short] {
+				out[name] = short
+				break
+			}
+		}
+	}
+}
+
+// shortName is the i-th name of a, b, ..., z, aa, ba, ...
+func shortName(i int) string {
+	const first = "abcdefghijklmnopqrstuvwxyz"
+	const rest = "abcdefghijklmnopqrstuvwxyz0123456789_"
+	name := first[i%len(first) : i%len(first)+1]
+	for i /= len(first); i > 0; i /= len(rest) {
+		i--
+		name += rest[i%len(rest) : i%len(rest)+1]
+	}
+	return name
+}
+
+func (r *renamer) open() {
+	r.scopes = append(r.scopes, make(map[string]*binding))
+	r.marks = append(r.marks, len(r.active))
+}
+
+func (r *renamer) close() {
+	r.active = r.active[:r.marks[len(r.marks)-1]]
+	r.marks = r.marks[:len(r.marks)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *renamer) declare(name *string) *binding {
+	b := &binding{refs: []*string{name}, live: append([]*binding(nil), r.active...), globals: make(map[string]bool)}
+	r.scopes[len(r.scopes)-1][*name] = b
+	r.active = append(r.active, b)
+	r.locals = append(r.locals, b)
+	return b
+}
+
+func (r *renamer) lookup(name string) *binding {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if b, ok := r.scopes[i][name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (r *renamer) ref(name *string) {
+	if b := r.lookup(*name); b != nil {
+		b.refs = append(b.refs, name)
+		r.isLocal[name] = true
+		return
+	}
+	r.globals[*name] = append(r.globals[*name], name)
+	for _, b := range r.active {
+		b.globals[*name] = true
+	}
+}
+
+// noteAssigned records assignments to globals
+func (r *renamer) noteAssigned(target Expr) {
+	if name, ok := target.(*NameExpr); ok && r.lookup(name.Name) == nil {
+		r.assigned[name.Name] = true
+	}
+}
+
+func (r *renamer) function(fn *FunctionExpr, method bool) {
+	r.open()
+	for i := range fn.Params {
+		b := r.declare(&fn.Params[i])
+		b.fixed = method && i == 0
+	}
+	r.node(fn.Body)
+	r.close()
+}
+
+func (r *renamer) node(n Node) {
+	switch n := n.(type) {
+	case *Block:
+		r.open()
+		for _, s := range n.Stmts {
+			r.node(s)
+		}
+		r.close()
+	case *NameExpr:
+		r.ref(&n.Name)
+	case *FunctionExpr:
+		r.function(n, false)
+	case *LocalStmt:
+		for _, e := range n.Exprs {
+			r.node(e)
+		}
+		for i := range n.Names {
+			r.declare(&n.Names[i])
+		}
+	case *LocalFunctionStmt:
+		r.declare(&n.Name)
+		r.function(n.Func, false)
+	case *FunctionStmt:
+		r.noteAssigned(n.Target)
+		r.node(n.Target)
+		r.function(n.Func, n.Method)
+	case *AssignStmt:
+		for _, t := range n.Targets {
+			r.noteAssigned(t)
+		}
+		forEachChild(n, func(child Node, _ func(Expr)) { r.node(child) })
+	case *OpAssignStmt:
+		r.noteAssigned(n.Target)
+		forEachChild(n, func(child Node, _ func(Expr)) { r.node(child) })
+	case *RepeatStmt:
+		// until sees the body's locals
+		r.open()
+		for _, s := range n.Body.Stmts {
+			r.node(s)
+		}
+		r.node(n.Cond)
+		r.close()
+	case *NumericForStmt:
+		r.node(n.Start)
+		r.node(n.Limit)
+		if n.Step != nil {
+			r.node(n.Step)
+		}
+		r.open()
+		r.declare(&n.Var)
+		r.node(n.Body)
+		r.close()
+	case *GenericForStmt:
+		for _, e := range n.Exprs {
+			r.node(e)
+		}
+		r.open()
+		for i := range n.Names {
+			r.declare(&n.Names[i])
+		}
+		r.node(n.Body)
+		r.close()
+	default:
+		forEachChild(n, func(child Node, _ func(Expr)) { r.node(child) })
+	}
+}
+
+// renameFields shortens field names. Fields starting with __ are metamethods
+// and keep their names. So do fields the code may reach by computed keys:
+// names that also appear as string literals, as in k="speed" ... t[k], and
+// the fields of a table indexed with a computed key or walked with pairs or
+// next, when that table is named the same way everywhere, as in obj[k] and
+// obj.speed. Where it goes through another name, such as a parameter, that
+// can't be followed, and the result is a warning instead.
+func renameFields(b *Block, preserve map[string]bool, isLocal func(*NameExpr) bool) []string {
+	refs := make(map[string][]*string)
+	field := func(s *string) {
+		refs[*s] = append(refs[*s], s)
+	}
+	keys := make(map[*StringExpr]bool)
+	var literals []*StringExpr
+	var dynamic []dynamicTable
+	tablePaths := make(map[*TableExpr]string)
+	dynamicAt := func(e Expr, line int, how string) {
+		dynamic = append(dynamic, dynamicTable{obj: e, path: fieldPath(e), line: line, how: how})
+	}
+	Inspect(b, func(n Node) bool {
+		switch n := n.(type) {
+		case *IndexExpr:
+			switch key := n.Key.(type) {
+			case *StringExpr:
+				if isName(key.Value) {
+					field(&key.Value)
+					keys[key] = true
+				}
+			case *NumberExpr:
+			default:
+				dynamicAt(n.Obj, n.Line, "indexed with a computed key")
+			}
+		case *TableExpr:
+			for _, f := range n.Fields {
+				if key, ok := f.Key.(*StringExpr); ok && isName(key.Value) {
+					field(&key.Value)
+					keys[key] = true
+				}
+				if t, ok := f.Value.(*TableExpr); ok && tablePaths[n] != "" {
+					if key, ok := f.Key.(*StringExpr); ok {
+						tablePaths[t] = tablePaths[n] + "." + key.Value
+					}
+				}
+			}
+		case *MethodCallExpr:
+			field(&n.Method)
+		case *StringExpr:
+			literals = append(literals, n)
+		case *CallExpr:
+			if fn, ok := n.Fn.(*NameExpr); ok && !isLocal(fn) && len(n.Args) > 0 {
+				switch fn.Name {
+				case "pairs", "next":
+					dynamicAt(n.Args[0], n.Line, "walked with "+fn.Name)
+				case "rawget", "rawset":
+					if len(n.Args) > 1 && !isConstant(n.Args[1]) {
+						dynamicAt(n.Args[0], n.Line, "indexed with a computed key")
+					}
+				}
+			}
+		case *GenericForStmt:
+			if fn, ok := n.Exprs[0].(*NameExpr); ok && fn.Name == "next" && !isLocal(fn) && len(n.Exprs) > 1 {
+				dynamicAt(n.Exprs[1], n.Line, "walked with next")
+			}
+		case *AssignStmt:
+			for i, t := range n.Targets {
+				if i < len(n.Exprs) {
+					if table, ok := n.Exprs[i].(*TableExpr); ok {
+						tablePaths[table] = fieldPath(t)
+					}
+				}
+			}
+		case *LocalStmt:
+			for i, name := range n.Names {
+				if i < len(n.Exprs) {
+					if table, ok := n.Exprs[i].(*TableExpr); ok {
+						tablePaths[table] = name
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	keep := make(map[string]bool)
+	for _, lit := range literals {
+		if !keys[lit] {
+			keep[lit.Value] = true
+		}
+	}
+	dynamicPaths := make(map[string]bool)
+	for _, d := range dynamic {
+		if d.path != "" {
+			dynamicPaths[d.path] = true
+		}
+		if t, ok := d.obj.(*TableExpr); ok {
+			keepKeys(t, keep)
+		}
+	}
+	Inspect(b, func(n Node) bool {
+		switch n := n.(type) {
+		case *IndexExpr:
+			if key, ok := n.Key.(*StringExpr); ok && dynamicPaths[fieldPath(n.Obj)] {
+				keep[key.Value] = true
+			}
+		case *TableExpr:
+			if dynamicPaths[tablePaths[n]] {
+				keepKeys(n, keep)
+			}
+		}
+		return true
+	})
+
+	var candidates []string
+	taken := make(map[string]bool)
+	for name := range refs {
+		if preserve[name] || keep[name] || strings.HasPrefix(name, "__") {
+			taken[name] = true
+		} else {
+			candidates = append(candidates, name)
+		}
+	}
+	newName := make(map[string]string)
+	assignShortNames(candidates, func(name string) int { return len(refs[name]) }, taken, newName)
+	for name, short := range newName {
+		for _, ref := range refs[name] {
+			*ref = short
+		}
+	}
+
+	// Warn about the tables that couldn't be followed, naming what was renamed
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Strings(candidates)
+	renamed := strings.Join(candidates, ", ")
+	var warnings []string
+	for _, d := range dynamic {
+		root := d.obj
+		for {
+			if index, ok := root.(*IndexExpr); ok {
+				root = index.Obj
+			} else {
+				break
+			}
+		}
+		name, ok := root.(*NameExpr)
+		switch {
+		case d.path == "":
+			warnings = append(warnings, fmt.Sprintf("line %d: a table %s can't be traced, so it may look for renamed fields: %s", d.line, d.how, renamed))
+		case ok && isLocal(name):
+			warnings = append(warnings, fmt.Sprintf("line %d: %s is %s, and tables passed in as %s may have renamed fields: %s", d.line, d.path, d.how, name.Name, renamed))
+		}
+	}
+	return warnings
+}
+
+// dynamicTable is a table the code reaches by computed keys
+type dynamicTable struct {
+	obj  Expr
+	path string // as in obj.items, or "" when it isn't a plain name or field
+	line int
+	how  string
+}
+
+// fieldPath names the variable or field an expression reads, as in obj or
+// obj.items, or returns "" for anything else
+func fieldPath(e Expr) string {
+	switch e := e.(type) {
+	case *NameExpr:
+		return e.Name
+	case *ParenExpr:
+		return fieldPath(e.Inner)
+	case *IndexExpr:
+		key, ok := e.Key.(*StringExpr)
+		if obj := fieldPath(e.Obj); ok && obj != "" {
+			return obj + "." + key.Value
+		}
+	}
+	return ""
+}
+
+// keepKeys marks the names a table constructor gives its fields
+func keepKeys(t *TableExpr, keep map[string]bool) {
+	for _, f := range t.Fields {
+		if key, ok := f.Key.(*StringExpr); ok {
+			keep[key.Value] = true
+		}
+	}
+}
+
+func isConstant(e Expr) bool {
+	switch e.(type) {
+	case *StringExpr, *NumberExpr:
+		return true
+	}
+	return false
+}
+
+// isName reports whether s can be written as a plain name, as in t.s
+func isName(s string) bool {
+	if s == "" || keywords[s] || isDigit(s[0]) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
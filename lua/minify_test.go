@@ -0,0 +1,196 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+// apiPreserve keeps the builtins' names, as the minify command does
+func apiPreserve() map[string]bool {
+	preserve := make(map[string]bool)
+	g := New().Globals
+	for k, _ := g.Next(nil); k != nil; k, _ = g.Next(k) {
+		preserve[k.(string)] = true
+	}
+	return preserve
+}
+
+func minify(t *testing.T, src string, opts MinifyOptions) (string, []string) {
+	t.Helper()
+	block, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	out, warnings := Minify(block, opts)
+	if _, err := Parse(out); err != nil {
+		t.Fatalf("minified code doesn't parse: %v\n%s", err, out)
+	}
+	return out, warnings
+}
+
+func countTokens(t *testing.T, src string) int {
+	t.Helper()
+	tokens, err := Lex(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CountTokens(tokens)
+}
+
+// minifySamples are programs whose printh output must not change
+var minifySamples = []string{
+	`-- closures and shadowing
+local function counter()
+  local count = 0
+  return function(step) count = count + (step or 1) return count end
+end
+local c = counter()
+c() c(5)
+local count = "outer"
+printh(c() .. count)`,
+	`-- objects, methods and metatables
+vec = {}
+vec.__index = vec
+vec.__add = function(a, b) return vec.new(a.x + b.x, a.y + b.y) end
+function vec.new(x, y) return setmetatable({x = x, y = y}, vec) end
+function vec:len2() return self.x * self.x + self.y * self.y end
+local v = vec.new(1, 2) + vec.new(3, 4)
+printh(v.x .. "," .. v.y .. " " .. v:len2())`,
+	`-- constants, shorthands and loops
+local total = 0
+for i = 1, 10 do
+  if i % 2 == 0 then total = total + i * (0x10 / 4) end
+end
+local flags = 0b1010 | 1 << 2
+while total > 100 do total = total - 7 end
+printh(total .. " " .. flags .. " " .. 1 / 3 .. " " .. (7 \ 2))`,
+	`-- strings and tables
+names = split("ann,bob,cy")
+local out = ""
+for n in all(names) do out = out .. sub(n, 1, 1) end
+local t = {1, 2, 3, key = "v", ["odd key"] = 4}
+add(t, 4)
+printh(out .. #t .. t.key .. t["odd key"])`,
+	`-- fields reached by computed keys
+obj = {speed = 5, hp = 3}
+local k = "speed"
+printh(obj[k] .. obj.hp)
+cfg = {val = 5}
+for key, v in pairs(cfg) do printh(key .. v) end
+stats = {str = 1}
+stats.str = stats.str + rawget(stats, "str")
+printh(stats.str)`,
+	`-- coroutines and varargs
+local function sum(...)
+  local s = 0
+  for v in all({...}) do s = s + v end
+  return s, select("#", ...)
+end
+local co = cocreate(function(a) local b = yield(a * 2) printh(sum(a, b)) end)
+local _, first = coresume(co, 3)
+coresume(co, first)
+printh(costatus(co))`,
+}
+
+func TestMinifyKeepsBehavior(t *testing.T) {
+	optionSets := map[string]MinifyOptions{
+		"locals":             {Preserve: apiPreserve()},
+		"globals and fields": {RenameGlobals: true, RenameFields: true, Preserve: apiPreserve()},
+	}
+	for _, src := range minifySamples {
+		want, err := run(t, src)
+		if err != nil {
+			t.Fatalf("original: %v\n%s", err, src)
+		}
+		for name, opts := range optionSets {
+			out, _ := minify(t, src, opts)
+			got, err := run(t, out)
+			if err != nil || got != want {
+				t.Errorf("%s: minified code printed %q, %v; want %q\n%s", name, got, err, want, out)
+			}
+			if before, after := countTokens(t, src), countTokens(t, out); after > before {
+				t.Errorf("%s: %d tokens became %d\n%s", name, before, after, out)
+			}
+			if len(out) >= len(src) {
+				t.Errorf("%s: %d chars became %d", name, len(src), len(out))
+			}
+		}
+	}
+}
+
+func TestMinifyOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"comments and whitespace", "-- hi\nx = 1  -- one\n\n\ny = 2", "x=1\ny=2"},
+		{"folding", "x = 0x1000 + 8 * 128", "x=5120"},
+		{"folding fractions", "x = 1 / 4 + 0x.8", "x=.75"},
+		{"folding wraps like PICO-8", "x = 32767 + 1", "x=0x8000"},
+		{"folding shifts", "x = 1 << 4 | 3", "x=19"},
+		{"no folding of ^", "x = 2 ^ 3", "x=2^3"},
+		{"no folding of variables", "x = y + 1 * 2", "x=y+2"},
+		{"compound assignment", "x = x + 1", "x+=1"},
+		{"compound assignment on fields", "t.n = t.n * 2", "t.n*=2"},
+		{"shorthand if", "if x then y() end", "if(x)y()\n"},
+		{"shorthand if else", "if x then y() else z() end", "if(x)y()else z()\n"},
+		{"shorthand if with several statements", "if x then y() z() end\nq()", "if(x)y()z()\nq()"},
+		{"if with elseif stays long", "if x then y() elseif z then w() end", "if x then y()elseif z then w()end"},
+		{"trailing nil", "local a, b = 1, nil printh(a, b)", "local a,b=1\nprinth(a,b)"},
+		{"string call", "printh(\"hi\")", "printh\"hi\""},
+		{"index to field", "t[\"key\"] = 1", "t.key=1"},
+		{"leading zero", "x = 0.5", "x=.5"},
+		{"locals renamed", "local speed = 1 local function go(dist) return dist * speed end printh(go(2))", "local a=1\nlocal function b(c)return c*a end\nprinth(b(2))"},
+	}
+	for _, tt := range tests {
+		got, _ := minify(t, tt.src, MinifyOptions{Preserve: apiPreserve()})
+		if got != tt.want {
+			t.Errorf("%s: Minify(%q) = %q; want %q", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestMinifyFields(t *testing.T) {
+	opts := MinifyOptions{RenameFields: true, Preserve: apiPreserve()}
+	tests := []struct {
+		name     string
+		src      string
+		kept     []string // field names that must survive
+		renamed  []string // field names that must be gone
+		warnings int
+	}{
+		{"plain fields", "p = {speed = 1} p.speed += 1 printh(p.speed)", nil, []string{"speed"}, 0},
+		{"string literal used as a key", "p = {speed = 1, hp = 2} k = \"speed\" printh(p[k])", []string{"speed", "hp"}, nil, 0},
+		{"literal elsewhere", "p = {speed = 1} q = {hp = 1} printh(\"speed\") printh(q.hp)", []string{"speed"}, []string{"hp"}, 0},
+		{"pairs over a global", "cfg = {val = 5} cfg.other = 1 for k, v in pairs(cfg) do printh(k) end", []string{"val", "other"}, nil, 0},
+		{"computed key on a field path", "g = {} g.items = {sword = 1} g.items[\"sw\" .. \"ord\"] = 2", []string{"sword"}, nil, 0},
+		{"next in a for loop", "t = {a1 = 1} for k in next, t do printh(k) end", []string{"a1"}, nil, 0},
+		{"pairs over a constructor", "for k in pairs({lives = 3}) do printh(k) end", []string{"lives"}, nil, 0},
+		{"pairs over a parameter warns", "function dump(t) for k in pairs(t) do printh(k) end end dump({score = 1})", nil, []string{"score"}, 1},
+		{"untraceable table warns", "function get() return {} end get()[k] = 1 q = {hp = 1}", nil, []string{"hp"}, 1},
+		{"metamethods stay", "mt = {__index = function() end} mt.size = 1", []string{"__index"}, []string{"size"}, 0},
+	}
+	for _, tt := range tests {
+		out, warnings := minify(t, tt.src, opts)
+		for _, name := range tt.kept {
+			if !strings.Contains(out, name) {
+				t.Errorf("%s: field %s was renamed in %s", tt.name, name, out)
+			}
+		}
+		for _, name := range tt.renamed {
+			if strings.Contains(out, name) {
+				t.Errorf("%s: field %s was kept in %s", tt.name, name, out)
+			}
+		}
+		if len(warnings) != tt.warnings {
+			t.Errorf("%s: warnings %q; want %d", tt.name, warnings, tt.warnings)
+		}
+	}
+
+	_, warnings := minify(t, "function dump(t) for k in pairs(t) do printh(k) end end dump({score = 1})", opts)
+	want := "line 1: t is walked with pairs, and tables passed in as t may have renamed fields: score"
+	if len(warnings) != 1 || warnings[0] != want {
+		t.Errorf("warnings = %q; want %q", warnings, want)
+	}
+}
@@ -0,0 +1,40 @@
+package lua
+
+import "fmt"
+
+// numberArith applies a binary operator to two numbers
+func numberArith(op string, a, b Number) Number {
+	switch op {
+	case "+":
+		return a.Add(b)
+	case "-":
+		return a.Sub(b)
+	case "*":
+		return a.Mul(b)
+	case "/":
+		return a.Div(b)
+	case "\\":
+		return a.IntDiv(b)
+	case "%":
+		return a.Mod(b)
+	case "^":
+		return a.Pow(b)
+	case "&":
+		return a.And(b)
+	case "|":
+		return a.Or(b)
+	case "^^", "~":
+		return a.Xor(b)
+	case "<<":
+		return a.Shl(b.Int())
+	case ">>":
+		return a.Shr(b.Int())
+	case ">>>":
+		return a.Lshr(b.Int())
+	case "<<>":
+		return a.Rotl(b.Int())
+	case ">><":
+		return a.Rotr(b.Int())
+	}
+	panic(fmt.Sprintf("unknown operator %s", op))
+}
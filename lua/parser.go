@@ -0,0 +1,517 @@
+package lua
+
+import (
+	"fmt"
+)
+
+// Parse parses a chunk of PICO-8 Lua into a block
+func Parse(src string) (*Block, error) {
+	tokens, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTokens(tokens)
+}
+
+// ParseTokens parses an already lexed chunk
+func ParseTokens(tokens []Token) (block *Block, err error) {
+	p := &parser{tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			block, err = nil, perr
+		}
+	}()
+	block = p.block()
+	if p.peek().Kind != TokEOF {
+		p.fail("'<eof>' expected near '%s'", near(p.peek()))
+	}
+	return block, nil
+}
+
+type parser struct {
+	tokens    []Token
+	pos       int
+	lineDepth int // > 0 inside the body of a single line if or while
+}
+
+// binaryPriority is the PICO-8 operator precedence, loosest first
+var binaryPriority = map[string]int{
+	"or":  1,
+	"and": 2,
+	"<":   3, ">": 3, "<=": 3, ">=": 3, "~=": 3, "!=": 3, "==": 3,
+	"|":  4,
+	"^^": 5, "~": 5,
+	"&":  6,
+	"<<": 7, ">>": 7, ">>>": 7, "<<>": 7, ">><": 7,
+	"..": 8,
+	"+":  9, "-": 9,
+	"*": 10, "/": 10, "\\": 10, "%": 10,
+	"^": 12,
+}
+
+// unaryPriority sits between the arithmetic operators and ^
+const unaryPriority = 11
+
+// compoundOps maps op= assignments to their operator
+var compoundOps = map[string]string{
+	"+=": "+", "-=": "-", "*=": "*", "/=": "/", "\\=": "\\", "%=": "%", "^=": "^",
+	"..=": "..", "|=": "|", "&=": "&", "^^=": "^^", "<<=": "<<", ">>=": ">>",
+	">>>=": ">>>", "<<>=": "<<>", ">><=": ">><",
+}
+
+func (p *parser) peek() Token { return p.tokens[p.pos] }
+
+func (p *parser) advance() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) fail(format string, args ...any) {
+	panic(&Error{Line: p.peek().Line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// near is how errors quote a token; the end of the input reads as <eof>
+func near(tok Token) string {
+	if tok.Kind == TokEOF {
+		return "<eof>"
+	}
+	return tok.Text
+}
+
+// is reports whether the next token is the given keyword or operator
+func (p *parser) is(text string) bool {
+	tok := p.peek()
+	return (tok.Kind == TokKeyword || tok.Kind == TokOp) && tok.Text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) Token {
+	if !p.is(text) {
+		p.fail("'%s' expected near '%s'", text, near(p.peek()))
+	}
+	return p.advance()
+}
+
+func (p *parser) name() string {
+	tok := p.peek()
+	if tok.Kind != TokName {
+		p.fail("<name> expected near '%s'", near(tok))
+	}
+	p.advance()
+	return tok.Text
+}
+
+// blockEnd reports whether the next token closes a block
+func (p *parser) blockEnd() bool {
+	if p.peek().Kind == TokEOF {
+		return true
+	}
+	return p.is("end") || p.is("else") || p.is("elseif") || p.is("until")
+}
+
+func (p *parser) block() *Block {
+	b := &Block{Pos: Pos{p.peek().Line}}
+	for !p.blockEnd() {
+		if p.is("return") {
+			b.Stmts = append(b.Stmts, p.returnStmt())
+			break
+		}
+		if stmt := p.statement(); stmt != nil {
+			b.Stmts = append(b.Stmts, stmt)
+		}
+	}
+	b.EndLine = p.peek().Line
+	return b
+}
+
+// lineBlock parses the body of a single line if or while: statements up to the
+// end of the line
+func (p *parser) lineBlock(line int) *Block {
+	b := &Block{Pos: Pos{line}, EndLine: line}
+	p.lineDepth++
+	defer func() { p.lineDepth-- }()
+	for !p.blockEnd() && !p.peek().Newline {
+		if p.is("return") {
+			b.Stmts = append(b.Stmts, p.returnStmt())
+			break
+		}
+		if stmt := p.statement(); stmt != nil {
+			b.Stmts = append(b.Stmts, stmt)
+		}
+	}
+	return b
+}
+
+func (p *parser) returnStmt() Stmt {
+	tok := p.expect("return")
+	stmt := &ReturnStmt{Pos: Pos{tok.Line}}
+	if !p.blockEnd() && !p.is(";") && !(p.lineDepth > 0 && p.peek().Newline) {
+		stmt.Exprs = p.exprList()
+	}
+	p.accept(";")
+	return stmt
+}
+
+func (p *parser) statement() Stmt {
+	tok := p.peek()
+	line := Pos{tok.Line}
+	switch {
+	case p.accept(";"):
+		return nil
+	case p.is("?"):
+		// ?expr,... is shorthand for print(expr,...)
+		p.advance()
+		call := &CallExpr{Pos: line, Fn: &NameExpr{Pos: line, Name: "print"}, Args: p.exprList()}
+		return &CallStmt{Pos: line, Call: call, Shorthand: true}
+	case p.accept("::"):
+		name := p.name()
+		p.expect("::")
+		return &LabelStmt{Pos: line, Name: name}
+	case p.accept("break"):
+		return &BreakStmt{Pos: line}
+	case p.accept("goto"):
+		return &GotoStmt{Pos: line, Label: p.name()}
+	case p.accept("do"):
+		body := p.block()
+		p.expect("end")
+		return &DoStmt{Pos: line, Body: body}
+	case p.accept("while"):
+		cond := p.expr(0)
+		if !p.is("do") {
+			if _, ok := cond.(*ParenExpr); ok && !p.peek().Newline {
+				return &WhileStmt{Pos: line, Cond: cond, Body: p.lineBlock(tok.Line), Short: true}
+			}
+		}
+		p.expect("do")
+		body := p.block()
+		p.expect("end")
+		return &WhileStmt{Pos: line, Cond: cond, Body: body}
+	case p.accept("repeat"):
+		body := p.block()
+		p.expect("until")
+		return &RepeatStmt{Pos: line, Body: body, Cond: p.expr(0)}
+	case p.accept("if"):
+		return p.ifStmt(line)
+	case p.accept("for"):
+		return p.forStmt(line)
+	case p.accept("function"):
+		var target Expr = &NameExpr{Pos: line, Name: p.name()}
+		name := target.(*NameExpr).Name
+		method := false
+		for p.is(".") || p.is(":") {
+			method = p.advance().Text == ":"
+			key := p.name()
+			name += "." + key
+			target = &IndexExpr{Pos: line, Obj: target, Key: &StringExpr{Pos: line, Value: key}}
+			if method {
+				break
+			}
+		}
+		fn := p.funcBody(line, method)
+		fn.Name = name
+		return &FunctionStmt{Pos: line, Target: target, Method: method, Func: fn}
+	case p.accept("local"):
+		if p.accept("function") {
+			name := p.name()
+			fn := p.funcBody(line, false)
+			fn.Name = name
+			return &LocalFunctionStmt{Pos: line, Name: name, Func: fn}
+		}
+		stmt := &LocalStmt{Pos: line, Names: []string{p.name()}}
+		for p.accept(",") {
+			stmt.Names = append(stmt.Names, p.name())
+		}
+		if p.accept("=") {
+			stmt.Exprs = p.exprList()
+		}
+		return stmt
+	}
+	return p.exprStmt(line)
+}
+
+func (p *parser) ifStmt(line Pos) Stmt {
+	cond := p.expr(0)
+	if !p.is("then") {
+		// PICO-8's if (cond) stmt [else stmt] on one line
+		if _, ok := cond.(*ParenExpr); ok && !p.peek().Newline {
+			stmt := &IfStmt{Pos: line, Cond: cond, Then: p.lineBlock(line.Line), Short: true}
+			if p.is("else") && !p.peek().Newline {
+				p.advance()
+				stmt.Else = p.lineBlock(line.Line)
+			}
+			return stmt
+		}
+	}
+	p.expect("then")
+	stmt := &IfStmt{Pos: line, Cond: cond, Then: p.block()}
+	switch {
+	case p.is("elseif"):
+		elseLine := Pos{p.advance().Line}
+		stmt.Else = &Block{Pos: elseLine, Stmts: []Stmt{p.ifStmt(elseLine)}}
+		stmt.ElseIf = true
+		return stmt
+	case p.accept("else"):
+		stmt.Else = p.block()
+	}
+	p.expect("end")
+	return stmt
+}
+
+func (p *parser) forStmt(line Pos) Stmt {
+	first := p.name()
+	if p.accept("=") {
+		stmt := &NumericForStmt{Pos: line, Var: first, Start: p.expr(0)}
+		p.expect(",")
+		stmt.Limit = p.expr(0)
+		if p.accept(",") {
+			stmt.Step = p.expr(0)
+		}
+		p.expect("do")
+		stmt.Body = p.block()
+		p.expect("end")
+		return stmt
+	}
+	stmt := &GenericForStmt{Pos: line, Names: []string{first}}
+	for p.accept(",") {
+		stmt.Names = append(stmt.Names, p.name())
+	}
+	p.expect("in")
+	stmt.Exprs = p.exprList()
+	p.expect("do")
+	stmt.Body = p.block()
+	p.expect("end")
+	return stmt
+}
+
+func (p *parser) exprStmt(line Pos) Stmt {
+	target := p.suffixedExpr()
+	if op, ok := compoundOps[p.peek().Text]; ok && p.peek().Kind == TokOp {
+		p.advance()
+		p.checkAssignable(target)
+		return &OpAssignStmt{Pos: line, Op: op, Target: target, Value: p.expr(0)}
+	}
+	if p.is("=") || p.is(",") {
+		stmt := &AssignStmt{Pos: line, Targets: []Expr{target}}
+		p.checkAssignable(target)
+		for p.accept(",") {
+			t := p.suffixedExpr()
+			p.checkAssignable(t)
+			stmt.Targets = append(stmt.Targets, t)
+		}
+		p.expect("=")
+		stmt.Exprs = p.exprList()
+		return stmt
+	}
+	switch target.(type) {
+	case *CallExpr, *MethodCallExpr:
+		return &CallStmt{Pos: line, Call: target}
+	}
+	p.fail("syntax error near '%s'", near(p.peek()))
+	return nil
+}
+
+func (p *parser) checkAssignable(e Expr) {
+	switch e.(type) {
+	case *NameExpr, *IndexExpr:
+		return
+	}
+	p.fail("cannot assign to this expression")
+}
+
+func (p *parser) funcBody(line Pos, method bool) *FunctionExpr {
+	fn := &FunctionExpr{Pos: line}
+	if method {
+		fn.Params = append(fn.Params, "self")
+	}
+	p.expect("(")
+	if !p.is(")") {
+		for {
+			if p.accept("...") {
+				fn.IsVararg = true
+				break
+			}
+			fn.Params = append(fn.Params, p.name())
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	p.expect(")")
+	fn.Body = p.block()
+	p.expect("end")
+	return fn
+}
+
+func (p *parser) exprList() []Expr {
+	exprs := []Expr{p.expr(0)}
+	for p.accept(",") {
+		exprs = append(exprs, p.expr(0))
+	}
+	return exprs
+}
+
+// expr parses a binary expression whose operators bind tighter than limit
+func (p *parser) expr(limit int) Expr {
+	var left Expr
+	tok := p.peek()
+	if (tok.Kind == TokOp || tok.Kind == TokKeyword) && isUnaryOp(tok.Text) {
+		p.advance()
+		left = &UnaryExpr{Pos: Pos{tok.Line}, Op: tok.Text, Operand: p.expr(unaryPriority)}
+	} else {
+		left = p.simpleExpr()
+	}
+
+	for {
+		tok := p.peek()
+		if tok.Kind != TokOp && tok.Kind != TokKeyword {
+			return left
+		}
+		prio, ok := binaryPriority[tok.Text]
+		if !ok || prio <= limit {
+			return left
+		}
+		p.advance()
+		// .. and ^ are right associative
+		next := prio
+		if tok.Text == ".." || tok.Text == "^" {
+			next--
+		}
+		left = &BinaryExpr{Pos: Pos{tok.Line}, Op: tok.Text, Left: left, Right: p.expr(next)}
+	}
+}
+
+func isUnaryOp(op string) bool {
+	switch op {
+	case "-", "not", "#", "~", "@", "%", "$":
+		return true
+	}
+	return false
+}
+
+func (p *parser) simpleExpr() Expr {
+	tok := p.peek()
+	line := Pos{tok.Line}
+	switch {
+	case tok.Kind == TokNumber:
+		p.advance()
+		return &NumberExpr{Pos: line, Value: tok.Num, Text: tok.Text}
+	case tok.Kind == TokString:
+		p.advance()
+		return &StringExpr{Pos: line, Value: tok.Text, Text: tok.Raw}
+	case p.accept("nil"):
+		return &NilExpr{Pos: line}
+	case p.accept("true"):
+		return &TrueExpr{Pos: line}
+	case p.accept("false"):
+		return &FalseExpr{Pos: line}
+	case p.accept("..."):
+		return &VarargExpr{Pos: line}
+	case p.accept("function"):
+		return p.funcBody(line, false)
+	case p.is("{"):
+		return p.tableExpr()
+	}
+	return p.suffixedExpr()
+}
+
+func (p *parser) primaryExpr() Expr {
+	tok := p.peek()
+	line := Pos{tok.Line}
+	if tok.Kind == TokName {
+		p.advance()
+		return &NameExpr{Pos: line, Name: tok.Text}
+	}
+	if p.accept("(") {
+		inner := p.expr(0)
+		p.expect(")")
+		return &ParenExpr{Pos: line, Inner: inner}
+	}
+	p.fail("unexpected symbol near '%s'", near(tok))
+	return nil
+}
+
+func (p *parser) suffixedExpr() Expr {
+	e := p.primaryExpr()
+	for {
+		tok := p.peek()
+		line := Pos{tok.Line}
+		switch {
+		case p.is("."):
+			p.advance()
+			e = &IndexExpr{Pos: line, Obj: e, Key: &StringExpr{Pos: line, Value: p.name()}}
+		case p.is("["):
+			p.advance()
+			key := p.expr(0)
+			p.expect("]")
+			e = &IndexExpr{Pos: line, Obj: e, Key: key}
+		case p.is(":"):
+			p.advance()
+			method := p.name()
+			args, bare := p.callArgs()
+			e = &MethodCallExpr{Pos: line, Obj: e, Method: method, Args: args, Bare: bare}
+		case p.is("(") || p.is("{") || tok.Kind == TokString:
+			args, bare := p.callArgs()
+			e = &CallExpr{Pos: line, Fn: e, Args: args, Bare: bare}
+		default:
+			return e
+		}
+	}
+}
+
+// callArgs parses the arguments of a call; bare is set for f"str" and f{...}
+func (p *parser) callArgs() (args []Expr, bare bool) {
+	tok := p.peek()
+	switch {
+	case tok.Kind == TokString:
+		p.advance()
+		return []Expr{&StringExpr{Pos: Pos{tok.Line}, Value: tok.Text, Text: tok.Raw}}, true
+	case p.is("{"):
+		return []Expr{p.tableExpr()}, true
+	}
+	p.expect("(")
+	if p.accept(")") {
+		return nil, false
+	}
+	args = p.exprList()
+	p.expect(")")
+	return args, false
+}
+
+func (p *parser) tableExpr() Expr {
+	t := &TableExpr{Pos: Pos{p.expect("{").Line}}
+	for !p.is("}") {
+		switch {
+		case p.is("["):
+			p.advance()
+			key := p.expr(0)
+			p.expect("]")
+			p.expect("=")
+			t.Fields = append(t.Fields, TableField{Key: key, Value: p.expr(0)})
+		case p.peek().Kind == TokName && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Text == "=" && p.tokens[p.pos+1].Kind == TokOp:
+			tok := p.advance()
+			p.advance()
+			t.Fields = append(t.Fields, TableField{Key: &StringExpr{Pos: Pos{tok.Line}, Value: tok.Text}, Value: p.expr(0)})
+		default:
+			t.Fields = append(t.Fields, TableField{Value: p.expr(0)})
+		}
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	p.expect("}")
+	return t
+}
@@ -0,0 +1,127 @@
+package lua
+
+import (
+	"fmt"
+	"testing"
+)
+
+// parenthesize writes an expression with every operation in parentheses, so
+// that tests can see how the parser grouped it
+func parenthesize(e Expr) string {
+	switch e := e.(type) {
+	case *NameExpr:
+		return e.Name
+	case *NumberExpr:
+		return e.Text
+	case *BinaryExpr:
+		return fmt.Sprintf("(%s %s %s)", parenthesize(e.Left), e.Op, parenthesize(e.Right))
+	case *UnaryExpr:
+		return fmt.Sprintf("(%s%s)", e.Op, parenthesize(e.Operand))
+	case *ParenExpr:
+		return parenthesize(e.Inner)
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a + b * c", "(a + (b * c))"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a ^ b ^ c", "(a ^ (b ^ c))"},
+		{"-a ^ b", "(-(a ^ b))"},
+		{"not a == b", "((nota) == b)"},
+		{"a .. b .. c", "(a .. (b .. c))"},
+		{"a + b .. c", "((a + b) .. c)"},
+		{"a .. b << c", "((a .. b) << c)"},
+		{"a << b + c", "(a << (b + c))"},
+		{"a & b | c", "((a & b) | c)"},
+		{"a | b & c", "(a | (b & c))"},
+		{"a ^^ b & c", "(a ^^ (b & c))"},
+		{"a | b == c", "((a | b) == c)"},
+		{"a < b and c or d", "(((a < b) and c) or d)"},
+		{"a or b and c", "(a or (b and c))"},
+		{"a * b \\ c % d", "(((a * b) \\ c) % d)"},
+		{"a >>> b >>< c", "((a >>> b) >>< c)"},
+		{"#a + 1", "((#a) + 1)"},
+		{"@a + %b + $c", "(((@a) + (%b)) + ($c))"},
+		{"~a & b", "((~a) & b)"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"a != b", "(a != b)"},
+	}
+	for _, tt := range tests {
+		block, err := Parse("x = " + tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		got := parenthesize(block.Stmts[0].(*AssignStmt).Exprs[0])
+		if got != tt.want {
+			t.Errorf("%s parsed as %s; want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseShorthands(t *testing.T) {
+	tests := []struct {
+		src   string
+		check func(Stmt) bool
+	}{
+		{"if (a) b()", func(s Stmt) bool {
+			st, ok := s.(*IfStmt)
+			return ok && st.Short && len(st.Then.Stmts) == 1 && st.Else == nil
+		}},
+		{"if (a) b() else c()", func(s Stmt) bool {
+			st, ok := s.(*IfStmt)
+			return ok && st.Short && st.Else != nil
+		}},
+		{"while (a) a -= 1", func(s Stmt) bool {
+			st, ok := s.(*WhileStmt)
+			return ok && st.Short
+		}},
+		{"a += 1", func(s Stmt) bool {
+			st, ok := s.(*OpAssignStmt)
+			return ok && st.Op == "+"
+		}},
+		{"a ..= 'x'", func(s Stmt) bool {
+			st, ok := s.(*OpAssignStmt)
+			return ok && st.Op == ".."
+		}},
+		{"?a, 1", func(s Stmt) bool {
+			st, ok := s.(*CallStmt)
+			return ok && st.Shorthand && len(st.Call.(*CallExpr).Args) == 2
+		}},
+	}
+	for _, tt := range tests {
+		block, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		if len(block.Stmts) != 1 || !tt.check(block.Stmts[0]) {
+			t.Errorf("Parse(%q) = %#v", tt.src, block.Stmts)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x = ", "line 1: unexpected symbol near '<eof>'"},
+		{"if a then\nb()\n", "line 3: 'end' expected near '<eof>'"},
+		{"f(\n1,\n2", "line 3: ')' expected near '<eof>'"},
+		{"x = = 1", "line 1: unexpected symbol near '='"},
+		{"local function 1() end", "line 1: <name> expected near '1'"},
+		{"x = 1 end", "line 1: '<eof>' expected near 'end'"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q) error = %v; want %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// Arg returns argument i, or nil when there are fewer arguments
+func Arg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// NumberArg returns argument i as a number, or def when it is missing or not a number
+func NumberArg(args []Value, i int, def Number) Number {
+	if n, ok := ToNumber(Arg(args, i)); ok {
+		return n
+	}
+	return def
+}
+
+// IntArg returns the integer part of argument i, or def
+func IntArg(args []Value, i int, def int) int {
+	if n, ok := ToNumber(Arg(args, i)); ok {
+		return n.Int()
+	}
+	return def
+}
+
+// Num wraps a Go int as a Value
+func Num(i int) Value { return IntNumber(i) }
+
+// openBase installs the non-graphics part of the PICO-8 API
+func (in *Interp) openBase() {
+	math1 := func(name string, f func(Number) Number) {
+		in.Register(name, func(_ *Interp, args []Value) []Value {
+			return []Value{f(NumberArg(args, 0, 0))}
+		})
+	}
+	math2 := func(name, op string) {
+		in.Register(name, func(_ *Interp, args []Value) []Value {
+			return []Value{numberArith(op, NumberArg(args, 0, 0), NumberArg(args, 1, 0))}
+		})
+	}
+
+	math1("flr", Number.Flr)
+	math1("ceil", Number.Ceil)
+	math1("abs", Number.Abs)
+	math1("sgn", func(n Number) Number {
+		if n < 0 {
+			return IntNumber(-1)
+		}
+		return IntNumber(1)
+	})
+	math1("sqrt", func(n Number) Number {
+		if n <= 0 {
+			return 0
+		}
+		return FloatNumber(math.Sqrt(n.Float()))
+	})
+	// PICO-8 angles are in turns and sin is inverted to match screen space
+	math1("sin", func(n Number) Number { return FloatNumber(-math.Sin(n.Float() * 2 * math.Pi)) })
+	math1("cos", func(n Number) Number { return FloatNumber(math.Cos(n.Float() * 2 * math.Pi)) })
+	math1("bnot", Number.Not)
+	in.Register("atan2", func(_ *Interp, args []Value) []Value {
+		dx, dy := NumberArg(args, 0, 0).Float(), NumberArg(args, 1, 0).Float()
+		a := math.Atan2(-dy, dx) / (2 * math.Pi)
+		if a < 0 {
+			a++
+		}
+		return []Value{FloatNumber(a) & 0xffff}
+	})
+	in.Register("min", func(_ *Interp, args []Value) []Value {
+		return []Value{min(NumberArg(args, 0, 0), NumberArg(args, 1, 0))}
+	})
+	in.Register("max", func(_ *Interp, args []Value) []Value {
+		return []Value{max(NumberArg(args, 0, 0), NumberArg(args, 1, 0))}
+	})
+	in.Register("mid", func(_ *Interp, args []Value) []Value {
+		x, y, z := NumberArg(args, 0, 0), NumberArg(args, 1, 0), NumberArg(args, 2, 0)
+		return []Value{max(min(x, y), min(max(x, y), z))}
+	})
+	math2("band", "&")
+	math2("bor", "|")
+	math2("bxor", "^^")
+	math2("shl", "<<")
+	math2("shr", ">>")
+	math2("lshr", ">>>")
+	math2("rotl", "<<>")
+	math2("rotr", ">><")
+
+	in.Register("rnd", func(in *Interp, args []Value) []Value {
+		if t, ok := Arg(args, 0).(*Table); ok {
+			if t.Len() == 0 {
+				return nil
+			}
+			return []Value{t.Get(IntNumber(in.rng.Intn(t.Len()) + 1))}
+		}
+		limit := NumberArg(args, 0, IntNumber(1))
+		if limit <= 0 {
+			return []Value{Number(0)}
+		}
+		return []Value{Number(in.rng.Int63n(int64(limit)))}
+	})
+	in.Register("srand", func(in *Interp, args []Value) []Value {
+		in.rng = rand.New(rand.NewSource(int64(NumberArg(args, 0, 0))))
+		return nil
+	})
+
+	in.Register("tostr", func(_ *Interp, args []Value) []Value {
+		if n, ok := Arg(args, 0).(Number); ok && Truthy(Arg(args, 1)) {
+			return []Value{n.Hex()}
+		}
+		if len(args) == 0 {
+			return []Value{""}
+		}
+		return []Value{ToString(args[0])}
+	})
+	in.Register("tonum", func(_ *Interp, args []Value) []Value {
+		switch v := Arg(args, 0).(type) {
+		case Number:
+			return []Value{v}
+		case string:
+			if n, ok := ToNumber(v); ok {
+				return []Value{n}
+			}
+		case bool:
+			if v {
+				return []Value{IntNumber(1)}
+			}
+			return []Value{Number(0)}
+		}
+		return nil
+	})
+	in.Register("type", func(in *Interp, args []Value) []Value {
+		if len(args) == 0 {
+			in.Errorf("bad argument #1 to 'type' (value expected)")
+		}
+		return []Value{TypeName(args[0])}
+	})
+	in.Register("chr", func(_ *Interp, args []Value) []Value {
+		var out strings.Builder
+		for i := range args {
+			out.WriteByte(byte(IntArg(args, i, 0)))
+		}
+		return []Value{out.String()}
+	})
+	in.Register("ord", func(_ *Interp, args []Value) []Value {
+		s, _ := Arg(args, 0).(string)
+		i := IntArg(args, 1, 1)
+		n := IntArg(args, 2, 1)
+		var out []Value
+		for k := 0; k < n; k++ {
+			if i+k < 1 || i+k > len(s) {
+				out = append(out, nil)
+				continue
+			}
+			out = append(out, IntNumber(int(s[i+k-1])))
+		}
+		return out
+	})
+	in.Register("sub", func(_ *Interp, args []Value) []Value {
+		s, ok := concatString(Arg(args, 0))
+		if !ok {
+			return []Value{""}
+		}
+		i := IntArg(args, 1, 1)
+		j := IntArg(args, 2, len(s))
+		return []Value{substring(s, i, j)}
+	})
+	in.Register("split", builtinSplit)
+	in.Register("printh", func(in *Interp, args []Value) []Value {
+		fmt.Fprintln(in.Printh, ToString(Arg(args, 0)))
+		return nil
+	})
+	in.Register("assert", func(in *Interp, args []Value) []Value {
+		if !Truthy(Arg(args, 0)) {
+			msg := "assertion failed!"
+			if s, ok := Arg(args, 1).(string); ok {
+				msg = s
+			}
+			in.Errorf("%s", msg)
+		}
+		return args
+	})
+
+	in.openTables()
+	in.openCoroutines()
+}
+
+// substring implements sub() with Lua's negative index rules
+func substring(s string, i, j int) string {
+	n := len(s)
+	if i < 0 {
+		i = max(n+i+1, 1)
+	} else if i == 0 {
+		i = 1
+	}
+	if j < 0 {
+		j = n + j + 1
+	} else if j > n {
+		j = n
+	}
+	if i > j {
+		return ""
+	}
+	return s[i-1 : j]
+}
+
+// builtinSplit is split(str, [separator], [convert_numbers])
+func builtinSplit(_ *Interp, args []Value) []Value {
+	s, _ := concatString(Arg(args, 0))
+	convert := len(args) < 3 || Truthy(args[2])
+	var parts []string
+	switch sep := Arg(args, 1).(type) {
+	case Number:
+		size := max(sep.Int(), 1)
+		for i := 0; i < len(s); i += size {
+			parts = append(parts, s[i:min(i+size, len(s))])
+		}
+	default:
+		separator := ","
+		if str, ok := sep.(string); ok {
+			separator = str
+		}
+		if separator == "" {
+			for i := 0; i < len(s); i++ {
+				parts = append(parts, s[i:i+1])
+			}
+		} else {
+			parts = strings.Split(s, separator)
+		}
+	}
+	t := NewTable()
+	for _, part := range parts {
+		if n, ok := ToNumber(part); ok && convert && part != "" {
+			t.Append(n)
+		} else {
+			t.Append(part)
+		}
+	}
+	return []Value{t}
+}
+
+// openTables installs the table functions: add, del, all, pairs and friends
+func (in *Interp) openTables() {
+	table := func(in *Interp, args []Value, name string) *Table {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			in.Errorf("bad argument #1 to '%s' (table expected, got %s)", name, TypeName(Arg(args, 0)))
+		}
+		return t
+	}
+
+	in.Register("add", func(in *Interp, args []Value) []Value {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			return nil
+		}
+		v := Arg(args, 1)
+		if len(args) > 2 {
+			i := IntArg(args, 2, t.Len()+1)
+			i = max(1, min(i, t.Len()+1))
+			for k := t.Len(); k >= i; k-- {
+				t.Set(IntNumber(k+1), t.Get(IntNumber(k)))
+			}
+			t.Set(IntNumber(i), v)
+		} else {
+			t.Append(v)
+		}
+		return []Value{v}
+	})
+	in.Register("del", func(in *Interp, args []Value) []Value {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			return nil
+		}
+		v := Arg(args, 1)
+		for i := 1; i <= t.Len(); i++ {
+			if in.equal(t.Get(IntNumber(i)), v) {
+				return []Value{removeAt(t, i)}
+			}
+		}
+		return nil
+	})
+	in.Register("deli", func(in *Interp, args []Value) []Value {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			return nil
+		}
+		i := IntArg(args, 1, t.Len())
+		if i < 1 || i > t.Len() {
+			return nil
+		}
+		return []Value{removeAt(t, i)}
+	})
+	in.Register("count", func(in *Interp, args []Value) []Value {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			return []Value{Number(0)}
+		}
+		if len(args) < 2 {
+			return []Value{IntNumber(t.Len())}
+		}
+		n := 0
+		for i := 1; i <= t.Len(); i++ {
+			if in.equal(t.Get(IntNumber(i)), args[1]) {
+				n++
+			}
+		}
+		return []Value{IntNumber(n)}
+	})
+	in.Register("all", func(in *Interp, args []Value) []Value {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			return []Value{&GoFunction{Name: "all", Fn: func(*Interp, []Value) []Value { return nil }}}
+		}
+		return []Value{allIterator(t)}
+	})
+	in.Register("foreach", func(in *Interp, args []Value) []Value {
+		t, ok := Arg(args, 0).(*Table)
+		if !ok {
+			return nil
+		}
+		next := allIterator(t)
+		for {
+			v := first(next.Fn(in, nil))
+			if v == nil {
+				return nil
+			}
+			in.call(Arg(args, 1), []Value{v})
+		}
+	})
+	next := &GoFunction{Name: "next", Fn: func(in *Interp, args []Value) []Value {
+		k, v := table(in, args, "next").Next(Arg(args, 1))
+		if k == nil {
+			return []Value{nil}
+		}
+		return []Value{k, v}
+	}}
+	in.Globals.Set("next", next)
+	in.Register("pairs", func(in *Interp, args []Value) []Value {
+		return []Value{next, table(in, args, "pairs"), nil}
+	})
+	inext := &GoFunction{Name: "inext", Fn: func(in *Interp, args []Value) []Value {
+		i := IntArg(args, 1, 0) + 1
+		v := in.index(table(in, args, "ipairs"), IntNumber(i))
+		if v == nil {
+			return []Value{nil}
+		}
+		return []Value{IntNumber(i), v}
+	}}
+	in.Register("ipairs", func(in *Interp, args []Value) []Value {
+		return []Value{inext, table(in, args, "ipairs"), Number(0)}
+	})
+	in.Register("unpack", func(in *Interp, args []Value) []Value {
+		t := table(in, args, "unpack")
+		i, j := IntArg(args, 1, 1), IntArg(args, 2, t.Len())
+		var out []Value
+		for k := i; k <= j; k++ {
+			out = append(out, t.Get(IntNumber(k)))
+		}
+		return out
+	})
+	in.Register("pack", func(_ *Interp, args []Value) []Value {
+		t := NewTable()
+		for i, v := range args {
+			t.Set(IntNumber(i+1), v)
+		}
+		t.Set("n", IntNumber(len(args)))
+		return []Value{t}
+	})
+	in.Register("select", func(in *Interp, args []Value) []Value {
+		if s, ok := Arg(args, 0).(string); ok && s == "#" {
+			return []Value{IntNumber(len(args) - 1)}
+		}
+		n := IntArg(args, 0, 1)
+		if n < 0 {
+			n = len(args) + n
+		}
+		if n < 1 {
+			in.Errorf("bad argument #1 to 'select' (index out of range)")
+		}
+		if n >= len(args) {
+			return nil
+		}
+		return args[n:]
+	})
+	in.Register("setmetatable", func(in *Interp, args []Value) []Value {
+		t := table(in, args, "setmetatable")
+		meta, _ := Arg(args, 1).(*Table)
+		t.Meta = meta
+		return []Value{t}
+	})
+	in.Register("getmetatable", func(_ *Interp, args []Value) []Value {
+		if t, ok := Arg(args, 0).(*Table); ok && t.Meta != nil {
+			return []Value{t.Meta}
+		}
+		return []Value{nil}
+	})
+	in.Register("rawget", func(in *Interp, args []Value) []Value {
+		return []Value{table(in, args, "rawget").Get(Arg(args, 1))}
+	})
+	in.Register("rawset", func(in *Interp, args []Value) []Value {
+		t := table(in, args, "rawset")
+		t.Set(Arg(args, 1), Arg(args, 2))
+		return []Value{t}
+	})
+	in.Register("rawequal", func(_ *Interp, args []Value) []Value {
+		return []Value{Arg(args, 0) == Arg(args, 1)}
+	})
+	in.Register("rawlen", func(in *Interp, args []Value) []Value {
+		if s, ok := Arg(args, 0).(string); ok {
+			return []Value{IntNumber(len(s))}
+		}
+		return []Value{IntNumber(table(in, args, "rawlen").Len())}
+	})
+}
+
+// removeAt removes t[i], shifting the following entries down
+func removeAt(t *Table, i int) Value {
+	v := t.Get(IntNumber(i))
+	n := t.Len()
+	for k := i; k < n; k++ {
+		t.Set(IntNumber(k), t.Get(IntNumber(k+1)))
+	}
+	t.Set(IntNumber(n), nil)
+	return v
+}
+
+// allIterator walks the array part like all(): deleting the current element
+// with del() during the loop does not skip the next one
+func allIterator(t *Table) *GoFunction {
+	i := 0
+	var last Value
+	return &GoFunction{Name: "all", Fn: func(*Interp, []Value) []Value {
+		if i == 0 || t.Get(IntNumber(i)) == last {
+			i++
+		}
+		for i <= t.Len() {
+			if v := t.Get(IntNumber(i)); v != nil {
+				last = v
+				return []Value{v}
+			}
+			i++
+		}
+		return []Value{nil}
+	}}
+}
+
+// openCoroutines installs cocreate, coresume, costatus and yield
+func (in *Interp) openCoroutines() {
+	in.Register("cocreate", func(in *Interp, args []Value) []Value {
+		switch Arg(args, 0).(type) {
+		case *Closure, *GoFunction:
+		default:
+			in.Errorf("bad argument #1 to 'cocreate' (function expected)")
+		}
+		return []Value{NewCoroutine(args[0])}
+	})
+	in.Register("coresume", func(in *Interp, args []Value) []Value {
+		co, ok := Arg(args, 0).(*Coroutine)
+		if !ok {
+			in.Errorf("bad argument #1 to 'coresume' (coroutine expected)")
+		}
+		results, err := in.Resume(co, args[1:])
+		if err != nil {
+			return []Value{false, err.Error()}
+		}
+		return append([]Value{true}, results...)
+	})
+	in.Register("costatus", func(in *Interp, args []Value) []Value {
+		co, ok := Arg(args, 0).(*Coroutine)
+		if !ok {
+			in.Errorf("bad argument #1 to 'costatus' (coroutine expected)")
+		}
+		return []Value{co.Status()}
+	})
+	in.Register("yield", func(in *Interp, args []Value) []Value {
+		return in.Yield(args)
+	})
+}
@@ -0,0 +1,56 @@
+package lua
+
+import "testing"
+
+// list prints a sequence as "a,b,c," so table contents can be compared
+const list = `function list(t) local s = "" for i = 1, #t do s ..= tostr(t[i]) .. "," end return s end
+`
+
+func TestTableFunctions(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"add", list + "t = {} add(t, 1) printh(add(t, 2)) add(t, 0, 1) add(t, 9, 99) printh(list(t))", "2\n0,1,2,9,"},
+		{"add to nil", "printh(add(nil, 1))", "[nil]"},
+		{"del removes the first match", list + "t = {1, 2, 3, 2} printh(del(t, 2)) printh(list(t)) printh(del(t, 7))", "2\n1,3,2,\n[nil]"},
+		{"deli", list + "t = {1, 2, 3} printh(deli(t, 1)) printh(deli(t)) printh(list(t))", "1\n3\n2,"},
+		{"count", "t = {1, 2, 2, 3, 2} printh(count({1, 2, 3})) printh(count(t, 2))", "3\n3"},
+		{"all", "s = 0 for v in all({1, 2, 3}) do s += v end printh(s)", "6"},
+		{"deleting the current item in all", list + "t = {1, 2, 3, 4} for v in all(t) do if v % 2 == 0 then del(t, v) end end printh(list(t))", "1,3,"},
+		{"all over nil", "for v in all(nil) do printh(v) end printh(\"none\")", "none"},
+		{"foreach", "s = \"\" foreach({\"a\", \"b\"}, function(v) s ..= v end) printh(s)", "ab"},
+		{"pairs", "n = 0 for k, v in pairs({1, 2, x = 3}) do n += v end printh(n)", "6"},
+		{"unpack and pack", "printh(select(\"#\", unpack({1, 2, 3}))) t = pack(1, nil, 3) printh(t.n)", "3\n3"},
+	})
+}
+
+func TestSplit(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"default separator", list + "t = split(\"1,2,,x\") printh(list(t)) printh(type(t[1]) .. type(t[3]))", "1,2,,x,\nnumberstring"},
+		{"custom separator", list + "printh(list(split(\"a b c\", \" \")))", "a,b,c,"},
+		{"no conversion", "printh(type(split(\"1,2\", \",\", false)[1]))", "string"},
+		{"fixed width", list + "printh(list(split(\"abcde\", 2)))", "ab,cd,e,"},
+		{"empty separator", list + "printh(list(split(\"abc\", \"\")))", "a,b,c,"},
+	})
+}
+
+func TestStringFunctions(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"sub", "s = \"hello\" printh(sub(s, 2, 3)) printh(sub(s, -3)) printh(sub(s, 4, 2) == \"\") printh(sub(s, 0))", "el\nllo\ntrue\nhello"},
+		{"chr and ord", "printh(chr(104, 105)) printh(ord(\"abc\", 2)) printh(ord(\"abc\", 1, 3))", "hi\n98\n97"},
+		{"tostr", "printh(tostr(1.5)) printh(tostr(1.5, true)) printh(tostr(nil)) printh(tostr() == \"\")", "1.5\n0x0001.8000\n[nil]\ntrue"},
+		{"tonum", "printh(tonum(\"0x10\")) printh(tonum(\" -2.5 \")) printh(tonum(\"abc\")) printh(tonum(true))", "16\n-2.5\n[nil]\n1"},
+		{"type", "printh(type(1) .. type(\"\") .. type({}) .. type(printh) .. type(nil))", "numberstringtablefunctionnil"},
+	})
+}
+
+func TestMathFunctions(t *testing.T) {
+	checkRuns(t, []runTest{
+		{"flr and ceil", "printh(flr(-1.5)) printh(ceil(-1.5)) printh(flr(2.9)) printh(ceil(2.1))", "-2\n-1\n2\n3"},
+		{"min, max and mid", "printh(min(3, 1)) printh(max(3, 1)) printh(mid(5, 1, 3)) printh(mid(1, 3, 2))", "1\n3\n3\n2"},
+		{"abs and sgn", "printh(abs(-2)) printh(sgn(0)) printh(sgn(-3))", "2\n1\n-1"},
+		{"sin and cos use turns", "printh(sin(0.25)) printh(cos(0.5)) printh(sin(0))", "-1\n-1\n0"},
+		{"atan2", "printh(atan2(1, 0)) printh(atan2(0, -1))", "0\n0.25"},
+		{"sqrt", "printh(sqrt(16)) printh(sqrt(-1))", "4\n0"},
+		{"srand repeats rnd", "srand(7) a = rnd(100) srand(7) printh(a == rnd(100)) printh(rnd(1) < 1)", "true\ntrue"},
+		{"rnd of a table", "t = {5} printh(rnd(t))", "5"},
+	})
+}
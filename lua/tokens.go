@@ -0,0 +1,53 @@
+package lua
+
+// freeTokens don't count towards PICO-8's token limit: separators, closing
+// brackets (a bracket pair counts once), end and local
+var freeTokens = map[string]bool{
+	",": true, ".": true, ":": true, ";": true, "::": true,
+	")": true, "]": true, "}": true,
+	"end": true, "local": true,
+}
+
+// CountTokens counts tokens the way PICO-8's code editor does for the 8192
+// token limit. A minus or ~ directly in front of a number literal is part of
+// the number, so -1 is one token.
+func CountTokens(tokens []Token) int {
+	n := 0
+	for i := range tokens {
+		n += TokenCost(tokens, i)
+	}
+	return n
+}
+
+// TokenCost is 1 when tokens[i] counts towards the limit and 0 otherwise
+func TokenCost(tokens []Token, i int) int {
+	tok := tokens[i]
+	switch {
+	case tok.Kind == TokEOF:
+		return 0
+	case (tok.Kind == TokOp || tok.Kind == TokKeyword) && freeTokens[tok.Text]:
+		return 0
+	case tok.Kind == TokOp && (tok.Text == "-" || tok.Text == "~") &&
+		i+1 < len(tokens) && tokens[i+1].Kind == TokNumber && !endsOperand(tokens, i):
+		return 0
+	}
+	return 1
+}
+
+// endsOperand reports whether the token before tokens[i] ends an expression,
+// which makes the operator at i binary rather than unary
+func endsOperand(tokens []Token, i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := tokens[i-1]
+	switch prev.Kind {
+	case TokName, TokNumber, TokString:
+		return true
+	case TokKeyword:
+		return prev.Text == "nil" || prev.Text == "true" || prev.Text == "false"
+	case TokOp:
+		return prev.Text == ")" || prev.Text == "]" || prev.Text == "}" || prev.Text == "..."
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package lua
+
+import (
+	"fmt"
+
+	"github.com/drpaneas/parsepico/fixed"
+)
+
+// Value is any Lua value: nil, bool, Number, string, *Table, *Closure, *GoFunction
+// or *Coroutine
+type Value any
+
+// Number is a PICO-8 number: signed 16.16 fixed point
+type Number = fixed.Fixed
+
+// IntNumber converts an integer, wrapping like PICO-8 does outside -32768..32767
+func IntNumber(i int) Number { return fixed.FromInt(i) }
+
+// FloatNumber converts a float, rounding to the nearest 1/65536
+func FloatNumber(f float64) Number { return fixed.FromFloat(f) }
+
+// GoFunction is a builtin implemented in Go
+type GoFunction struct {
+	Name string
+	Fn   func(in *Interp, args []Value) []Value
+}
+
+// Closure is a Lua function together with the scope it was created in
+type Closure struct {
+	fn    *FunctionExpr
+	scope *scope
+}
+
+// Table is a Lua table. Keys 1..n live in an array part; everything else in a
+// hash part that remembers insertion order, so pairs() is deterministic.
+type Table struct {
+	arr  []Value
+	hash map[Value]Value
+	keys []Value       // hash keys in insertion order, including removed ones
+	pos  map[Value]int // index of each key in keys, kept after removal so Next can continue
+	Meta *Table
+}
+
+// NewTable makes an empty table
+func NewTable() *Table {
+	return &Table{hash: make(map[Value]Value), pos: make(map[Value]int)}
+}
+
+// arrayIndex returns the 0-based array slot for a key, or -1
+func arrayIndex(key Value) int {
+	if n, ok := key.(Number); ok && n&0xffff == 0 && n > 0 {
+		return n.Int() - 1
+	}
+	return -1
+}
+
+// Get reads a key without metamethods
+func (t *Table) Get(key Value) Value {
+	if i := arrayIndex(key); i >= 0 && i < len(t.arr) {
+		return t.arr[i]
+	}
+	return t.hash[key]
+}
+
+// Set writes a key without metamethods; setting nil removes it
+func (t *Table) Set(key Value, value Value) {
+	i := arrayIndex(key)
+	switch {
+	case i >= 0 && i < len(t.arr):
+		t.arr[i] = value
+		if value == nil && i == len(t.arr)-1 {
+			// Trim trailing holes so the length stays a border
+			for len(t.arr) > 0 && t.arr[len(t.arr)-1] == nil {
+				t.arr = t.arr[:len(t.arr)-1]
+			}
+		}
+		return
+	case i == len(t.arr) && value != nil:
+		t.arr = append(t.arr, value)
+		delete(t.hash, key)
+		// Pull following keys over from the hash part
+		for {
+			next := IntNumber(len(t.arr) + 1)
+			v, ok := t.hash[next]
+			if !ok {
+				break
+			}
+			t.arr = append(t.arr, v)
+			delete(t.hash, next)
+		}
+		return
+	}
+	if value == nil {
+		delete(t.hash, key)
+		return
+	}
+	if _, ok := t.hash[key]; !ok {
+		// Drop removed keys from the order once they dominate it
+		if len(t.keys) > 32 && len(t.keys) > 2*len(t.hash) {
+			live := t.keys[:0]
+			for j, k := range t.keys {
+				if _, ok := t.hash[k]; ok && t.pos[k] == j {
+					t.pos[k] = len(live)
+					live = append(live, k)
+				} else if t.pos[k] == j {
+					delete(t.pos, k)
+				}
+			}
+			t.keys = live
+		}
+		t.pos[key] = len(t.keys)
+		t.keys = append(t.keys, key)
+	}
+	t.hash[key] = value
+}
+
+// Len is the # operator: the size of the array part
+func (t *Table) Len() int { return len(t.arr) }
+
+// Next returns the key after key in iteration order (array part first), or nil
+func (t *Table) Next(key Value) (Value, Value) {
+	start := 0
+	if key != nil {
+		if i := arrayIndex(key); i >= 0 && i < len(t.arr) {
+			start = i + 1
+		} else if j, ok := t.pos[key]; ok {
+			start = len(t.arr) + j + 1
+		} else {
+			start = len(t.arr)
+		}
+	}
+	for i := start; i < len(t.arr); i++ {
+		if t.arr[i] != nil {
+			return IntNumber(i + 1), t.arr[i]
+		}
+	}
+	for j := max(start-len(t.arr), 0); j < len(t.keys); j++ {
+		k := t.keys[j]
+		if v, ok := t.hash[k]; ok && t.pos[k] == j {
+			return k, v
+		}
+	}
+	return nil, nil
+}
+
+// Append adds a value at #t+1
+func (t *Table) Append(v Value) { t.Set(IntNumber(len(t.arr)+1), v) }
+
+// TypeName is the result of type()
+func TypeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case Number:
+		return "number"
+	case string:
+		return "string"
+	case *Table:
+		return "table"
+	case *Closure, *GoFunction:
+		return "function"
+	case *Coroutine:
+		return "thread"
+	}
+	return "userdata"
+}
+
+// ToString formats a value like tostr()
+func ToString(v Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "[nil]"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case Number:
+		return v.String()
+	case string:
+		return v
+	case *Table:
+		return fmt.Sprintf("[table: %p]", v)
+	case *Closure, *GoFunction:
+		return fmt.Sprintf("[function: %p]", v)
+	case *Coroutine:
+		return fmt.Sprintf("[thread: %p]", v)
+	}
+	return "[unknown]"
+}
+
+// Truthy reports whether a value counts as true: everything but nil and false
+func Truthy(v Value) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// ToNumber converts numbers and numeric strings, as arithmetic and tonum() do
+func ToNumber(v Value) (Number, bool) {
+	switch v := v.(type) {
+	case Number:
+		return v, true
+	case string:
+		return fixed.Parse(v)
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package lua
+
+// forEachChild calls fn for each node directly below n, in source order. For
+// expressions replace swaps the child for another one; it is nil for blocks,
+// statements and function bodies of function statements.
+func forEachChild(n Node, fn func(child Node, replace func(Expr))) {
+	exprs := func(list []Expr) {
+		for i := range list {
+			fn(list[i], func(e Expr) { list[i] = e })
+		}
+	}
+	expr := func(slot *Expr) {
+		if *slot != nil {
+			fn(*slot, func(e Expr) { *slot = e })
+		}
+	}
+	block := func(b *Block) {
+		if b != nil {
+			fn(b, nil)
+		}
+	}
+
+	switch n := n.(type) {
+	case *Block:
+		for _, s := range n.Stmts {
+			fn(s, nil)
+		}
+	case *IndexExpr:
+		expr(&n.Obj)
+		expr(&n.Key)
+	case *CallExpr:
+		expr(&n.Fn)
+		exprs(n.Args)
+	case *MethodCallExpr:
+		expr(&n.Obj)
+		exprs(n.Args)
+	case *FunctionExpr:
+		block(n.Body)
+	case *BinaryExpr:
+		expr(&n.Left)
+		expr(&n.Right)
+	case *UnaryExpr:
+		expr(&n.Operand)
+	case *ParenExpr:
+		expr(&n.Inner)
+	case *TableExpr:
+		for i := range n.Fields {
+			expr(&n.Fields[i].Key)
+			expr(&n.Fields[i].Value)
+		}
+	case *LocalStmt:
+		exprs(n.Exprs)
+	case *AssignStmt:
+		exprs(n.Targets)
+		exprs(n.Exprs)
+	case *OpAssignStmt:
+		expr(&n.Target)
+		expr(&n.Value)
+	case *CallStmt:
+		expr(&n.Call)
+	case *DoStmt:
+		block(n.Body)
+	case *WhileStmt:
+		expr(&n.Cond)
+		block(n.Body)
+	case *RepeatStmt:
+		block(n.Body)
+		expr(&n.Cond)
+	case *IfStmt:
+		expr(&n.Cond)
+		block(n.Then)
+		block(n.Else)
+	case *NumericForStmt:
+		expr(&n.Start)
+		expr(&n.Limit)
+		expr(&n.Step)
+		block(n.Body)
+	case *GenericForStmt:
+		exprs(n.Exprs)
+		block(n.Body)
+	case *FunctionStmt:
+		expr(&n.Target)
+		fn(n.Func, nil)
+	case *LocalFunctionStmt:
+		fn(n.Func, nil)
+	case *ReturnStmt:
+		exprs(n.Exprs)
+	}
+}
+
+// Inspect calls fn for n and, as long as fn returns true, for everything below
+func Inspect(n Node, fn func(Node) bool) {
+	if !fn(n) {
+		return
+	}
+	forEachChild(n, func(child Node, _ func(Expr)) { Inspect(child, fn) })
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// LuaCall is a call to a named function found by scanning the __lua__ source
+type LuaCall struct {
+	Line int      // 1-based line within the __lua__ section
+	Args []string // raw, trimmed argument expressions
+}
+
+// findLuaCalls scans the code for calls like name(a,b,c) and splits their
+// top-level arguments. It is a lexical scan, not a parse: comments and
+// strings are skipped, but anything more dynamic is left to the caller.
+func findLuaCalls(code []string, name string) []LuaCall {
+	src := stripLuaComments(strings.Join(code, "\n"))
+
+	var calls []LuaCall
+	for i := 0; i < len(src); i++ {
+		if !strings.HasPrefix(src[i:], name) {
+			continue
+		}
+		if i > 0 && isLuaIdentChar(src[i-1]) {
+			continue
+		}
+		j := i + len(name)
+		for j < len(src) && (src[j] == ' ' || src[j] == '\t') {
+			j++
+		}
+		if j >= len(src) || src[j] != '(' {
+			continue
+		}
+		args, end, ok := splitLuaArgs(src, j)
+		if !ok {
+			continue
+		}
+		calls = append(calls, LuaCall{Line: strings.Count(src[:i], "\n") + 1, Args: args})
+		i = end
+	}
+	return calls
+}
+
+// splitLuaArgs splits the parenthesized argument list starting at src[open]
+func splitLuaArgs(src string, open int) (args []string, end int, ok bool) {
+	depth := 0
+	start := open + 1
+	for i := open; i < len(src); i++ {
+		switch src[i] {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+			if depth == 0 {
+				if arg := strings.TrimSpace(src[start:i]); arg != "" || len(args) > 0 {
+					args = append(args, arg)
+				}
+				return args, i, true
+			}
+		case ',':
+			if depth == 1 {
+				args = append(args, strings.TrimSpace(src[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return nil, len(src), false
+}
+
+// stripLuaComments blanks out comments and string contents while keeping line
+// breaks, so offsets still map to the original lines. It goes by the Lua lexer,
+// so long brackets of any level, // comments and -- inside strings are handled
+// like PICO-8 does; code the lexer rejects is scanned as it is.
+func stripLuaComments(src string) string {
+	tokens, comments, err := lua.LexComments(src)
+	if err != nil {
+		return src
+	}
+	out := []byte(src)
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+	for _, c := range comments {
+		blank(c.Pos, c.Pos+len(c.Text))
+	}
+	for _, tok := range tokens {
+		if tok.Kind == lua.TokString {
+			// Keep the delimiters so brackets still pair up
+			blank(tok.Pos+1, tok.Pos+len(tok.Raw)-1)
+		}
+	}
+	return string(out)
+}
+
+// isLuaIdentChar reports whether c can be part of a Lua identifier
+func isLuaIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parseLuaInt parses a decimal or 0x hex integer literal, as written in calls like spr(16,x,y,2,2)
+func parseLuaInt(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	base := 10
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s, base = s[2:], 16
+	}
+	n, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFindLuaCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // line: args of each call
+	}{
+		{"plain call", "spr(1, x, y)", "1: [1 x y]"},
+		{"nested calls", "spr(n(1, 2), t[i])", "1: [n(1, 2) t[i]]"},
+		{"other names", "myspr(1) spr_x(2) spr (3)", "1: [3]"},
+		{"line comment", "-- spr(1)\nspr(2)", "2: [2]"},
+		{"block comment", "--[[ spr(1)\n]] spr(2)", "2: [2]"},
+		{"leveled block comment", "--[==[\nspr(1) ]]\nspr(2)\n]==]\nspr(3)", "5: [3]"},
+		{"c style comment", "// spr(1)\nspr(2)", "2: [2]"},
+		{"dashes in a string", "s = \"--\" spr(1)", "1: [1]"},
+		{"dashes in a long string", "s = [[ -- ]] spr(1)", "1: [1]"},
+		{"call in a string", "s = 'spr(1)' t = [[\nspr(2)]] spr(3)", "2: [3]"},
+		{"string argument", "spr(1, \"a,b\")", "1: [1 \"   \"]"},
+	}
+	for _, tt := range tests {
+		var calls []string
+		for _, call := range findLuaCalls(strings.Split(tt.src, "\n"), "spr") {
+			calls = append(calls, fmt.Sprintf("%d: %v", call.Line, call.Args))
+		}
+		if got := strings.Join(calls, ", "); got != tt.want {
+			t.Errorf("%s: findLuaCalls(%q) = %s; want %s", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,17 @@ package main //nolint:revive
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // PICO-8 16-color palette
@@ -127,15 +130,103 @@ type TilemapJSON struct {
 }
 
 func main() {
+	// Subcommands get their own flag sets; anything else is the classic export
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "anim":
+			runAnim(os.Args[2:])
+			return
+		case "atlas":
+			runAtlas(os.Args[2:])
+			return
+		case "metasprites":
+			runMetasprites(os.Args[2:])
+			return
+		case "dedupe":
+			runDedupe(os.Args[2:])
+			return
+		case "usage":
+			runUsage(os.Args[2:])
+			return
+		case "rooms":
+			runRooms(os.Args[2:])
+			return
+		case "flags":
+			runFlags(os.Args[2:])
+			return
+		case "nav":
+			runNav(os.Args[2:])
+			return
+		case "path":
+			runPath(os.Args[2:])
+			return
+		case "view":
+			runView(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "textconv":
+			runTextconv(os.Args[2:])
+			return
+		case "merge":
+			runMerge(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "preview":
+			runPreview(os.Args[2:])
+			return
+		case "render":
+			runRender(os.Args[2:])
+			return
+		case "detect":
+			runDetect(os.Args[2:])
+			return
+		case "flatten":
+			runFlatten(os.Args[2:])
+			return
+		case "tokens":
+			runTokens(os.Args[2:])
+			return
+		case "ast":
+			runAST(os.Args[2:])
+			return
+		case "split-code":
+			runSplitCode(os.Args[2:])
+			return
+		case "join-code":
+			runJoinCode(os.Args[2:])
+			return
+		case "minify":
+			runMinify(os.Args[2:])
+			return
+		case "fmt":
+			runFmt(os.Args[2:])
+			return
+		}
+	}
+
 	// Flags: user can specify a cart path, and optional --3 or --4
 	var cartPath string
-	var useSection3, useSection4 bool
+	var useSection3, useSection4, autoSections bool
 	var cleanSlate bool
+	var layers int
+	var layersAny, layerPngs bool
+	var watch bool
+	var interval time.Duration
 
 	flag.StringVar(&cartPath, "cart", "", "Path to the PICO-8 cartridge file (.p8)")
 	flag.BoolVar(&useSection3, "3", false, "Include dual-purpose section 3 (sprites 128..191)")
 	flag.BoolVar(&useSection4, "4", false, "Include dual-purpose section 4 (sprites 192..255)")
+	flag.BoolVar(&autoSections, "auto", false, "Guess --3/--4 from the cart contents and report why")
 	flag.BoolVar(&cleanSlate, "clean", false, "Remove old sprites directory, map.png, spritesheet.png if they exist")
+	flag.IntVar(&layers, "layers", 0, "Only draw map tiles whose sprite flags match this bitmask, like map(...,layers)")
+	flag.BoolVar(&layersAny, "layers-any", false, "With --layers, draw tiles with any bit of the mask instead of all")
+	flag.BoolVar(&layerPngs, "layer-pngs", false, "Also write map_layer_0..7.png (one per flag bit) and a map_layers.png composite")
+	flag.BoolVar(&watch, "watch", false, "Keep running and re-export whenever the cart is saved")
+	flag.DurationVar(&interval, "interval", 500*time.Millisecond, "How often --watch polls the cart for changes")
 	flag.Parse()
 
 	if cartPath == "" {
@@ -145,20 +236,16 @@ func main() {
 	}
 
 	// Expand ~ and make the path absolute
-	if strings.HasPrefix(cartPath, "~/") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting user home directory: %v\n", err)
-			os.Exit(1)
-		}
-		cartPath = filepath.Join(homeDir, cartPath[2:])
-	}
-	var err error
-	cartPath, err = filepath.Abs(cartPath)
+	cartPath, err := resolveCartPath(cartPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error making path absolute: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error resolving cart path: %v\n", err)
 		os.Exit(1)
 	}
+	if autoSections {
+		guess := detectCartDualPurpose(cartPath)
+		useSection3, useSection4 = guess.UseSection3, guess.UseSection4
+		printGuess(os.Stderr, guess)
+	}
 
 	// Clean up old artifacts if requested
 	if cleanSlate {
@@ -174,136 +261,164 @@ func main() {
 		if err := os.Remove("spritesheet.json"); err == nil {
 			fmt.Println("Removed old spritesheet.json.")
 		}
+		layerPaths, _ := filepath.Glob("map_layer*.png")
+		for _, path := range layerPaths {
+			if err := os.Remove(path); err == nil {
+				fmt.Printf("Removed old %s.\n", path)
+			}
+		}
+	}
+
+	opts := exportOptions{
+		cartPath:    cartPath,
+		useSection3: useSection3,
+		useSection4: useSection4,
+		layers:      layers,
+		layersAny:   layersAny,
+		layerPngs:   layerPngs,
+	}
+	if err := exportCart(opts, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if !watch {
+			os.Exit(1)
+		}
 	}
+	if watch {
+		watchCart(opts, interval)
+	}
+}
+
+// exportOptions are the settings of the classic export
+type exportOptions struct {
+	cartPath                 string
+	useSection3, useSection4 bool
+	layers                   int
+	layersAny, layerPngs     bool
+}
+
+// exportCart writes the classic outputs. When changed is non-nil only the outputs
+// that depend on those sections are rewritten: gfx feeds everything, map only the
+// map outputs and gff the JSON (and layer renders, which filter on flags).
+func exportCart(opts exportOptions, changed sectionSet) error {
+	cartPath, useSection3, useSection4 := opts.cartPath, opts.useSection3, opts.useSection4
+	layers, layersAny, layerPngs := opts.layers, opts.layersAny, opts.layerPngs
+	usesFlags := layers != 0 || layerPngs
 
 	// Parse sections from the PICO-8 cart
 	gfxData := parseSection(cartPath, "__gfx__")
 	if len(gfxData) == 0 {
-		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
-		os.Exit(1)
+		return errors.New("no __gfx__ section found in cart")
 	}
 	mapData := parseSection(cartPath, "__map__")
 	hasMapData := len(mapData) > 0 // Check if map data exists
-	if !hasMapData {
+	if !hasMapData && changed == nil {
 		fmt.Println("No __map__ section found. Skipping map processing.")
 	}
 
 	// Parse flag data
 	flagData := parseFlagSection(cartPath)
 
-	// Potential dual-purpose sections
-	// Each sprite row is 8 pixels.
-	// - Section 3 covers sprite 128..191 => rows 8..11 in the 16x16 grid
-	// - Section 4 covers sprite 192..255 => rows 12..15
-	var dualPurposeSection1, dualPurposeSection2 []string
-	if useSection3 {
-		startRow := 8 * 8       // 64
-		endRow := startRow + 32 // 96
-		// Clamp if gfxData is too short
-		if endRow > len(gfxData) {
-			endRow = len(gfxData)
-		}
-		if startRow < len(gfxData) {
-			dualPurposeSection1 = gfxData[startRow:endRow]
-		}
-	}
-
-	if useSection4 {
-		startRow := 12 * 8      // 96
-		endRow := startRow + 32 // 128
-		if endRow > len(gfxData) {
-			endRow = len(gfxData)
-		}
-		if startRow < len(gfxData) {
-			dualPurposeSection2 = gfxData[startRow:endRow]
-		}
-	}
-
 	// Create full 16x16 sprite sheet
 	spriteSheet := reconstructImage(gfxData)
 
-	// Decide map height
-	mapHeight := 32
-	if useSection3 {
-		mapHeight = 48
-	}
-	if useSection4 {
-		mapHeight = 64
-	}
-
 	// Render map with optional dual-purpose sections only if map data exists
-	if hasMapData {
-		mapImage := renderMap(mapData, dualPurposeSection1, dualPurposeSection2, spriteSheet, 128, mapHeight)
+	if hasMapData && (changed.has("__gfx__", "__map__") || (usesFlags && changed.has("__gff__"))) {
+		mapImage := renderCartMap(mapData, gfxData, spriteSheet, useSection3, useSection4)
+		if usesFlags {
+			mapSheet, err := generateMapJSON(mapData, gfxData, useSection3, useSection4)
+			if err != nil {
+				return fmt.Errorf("generating map JSON: %w", err)
+			}
+			grid := mapGrid(mapSheet)
+			if layers != 0 {
+				mapImage = renderMapLayers(grid, spriteSheet, flagData, layers, layersAny)
+			}
+			if layerPngs {
+				if err := saveLayerMaps(grid, spriteSheet, flagData); err != nil {
+					fmt.Fprintf(os.Stderr, "Error saving layer maps: %v\n", err)
+				} else {
+					fmt.Println("Successfully generated map_layer_0..7.png and map_layers.png")
+				}
+			}
+		}
 		if err := saveAsPng(mapImage, "map.png"); err != nil {
 			fmt.Fprintf(os.Stderr, "Error saving map.png: %v\n", err)
 		}
 		fmt.Println("Successfully generated map.png")
 	}
 
-	// Save sprites (some or all) and sprite sub-sections
-	saveSprites(spriteSheet, useSection3, useSection4)
+	if changed.has("__gfx__") {
+		// Save sprites (some or all) and sprite sub-sections
+		saveSprites(spriteSheet, useSection3, useSection4)
 
-	// Then combine those sub-sections into a single sprite sheet
-	var numSections int
-	switch {
-	case !useSection3 && !useSection4:
-		numSections = 4 // All sections available
-	case !useSection3 || !useSection4:
-		numSections = 3 // Either Section 3 or Section 4 available
-	default:
-		numSections = 2 // Only the base section available
-	}
-	if err := combineSectionsIntoSpriteSheet(numSections); err != nil {
-		fmt.Println("Error combining sections:", err)
+		// Then combine those sub-sections into a single sprite sheet
+		var numSections int
+		switch {
+		case !useSection3 && !useSection4:
+			numSections = 4 // All sections available
+		case !useSection3 || !useSection4:
+			numSections = 3 // Either Section 3 or Section 4 available
+		default:
+			numSections = 2 // Only the base section available
+		}
+		if err := combineSectionsIntoSpriteSheet(numSections); err != nil {
+			fmt.Println("Error combining sections:", err)
+		}
 	}
 
-	// Generate and save spritesheet JSON
-	jsonData, err := generateSpriteSheetJSON(gfxData, flagData, useSection3, useSection4)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating spritesheet JSON: %v\n", err)
-		os.Exit(1)
-	}
+	if changed.has("__gfx__", "__gff__") {
+		// Generate and save spritesheet JSON
+		jsonData, err := generateSpriteSheetJSON(gfxData, flagData, useSection3, useSection4)
+		if err != nil {
+			return fmt.Errorf("generating spritesheet JSON: %w", err)
+		}
 
-	if err := saveSpritesheetJSON(jsonData, "spritesheet.json"); err != nil {
-		fmt.Fprintf(os.Stderr, "Error saving spritesheet.json: %v\n", err)
-		os.Exit(1)
+		if err := saveSpritesheetJSON(jsonData, "spritesheet.json"); err != nil {
+			return fmt.Errorf("saving spritesheet.json: %w", err)
+		}
+		fmt.Println("Successfully generated spritesheet.json")
 	}
-	fmt.Println("Successfully generated spritesheet.json")
 
-	// Create individual sprite PNGs
-	if err := createIndividualSpritePNGs("spritesheet.json"); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating individual sprite PNGs: %v\n", err)
-		os.Exit(1)
+	if changed.has("__gfx__") {
+		// Create individual sprite PNGs
+		if err := createIndividualSpritePNGs("spritesheet.json"); err != nil {
+			return fmt.Errorf("creating individual sprite PNGs: %w", err)
+		}
+		fmt.Println("Successfully created individual sprite PNGs")
 	}
-	fmt.Println("Successfully created individual sprite PNGs")
 
 	// Generate and save map JSON only if map data exists
-	if hasMapData {
+	if hasMapData && changed.has("__gfx__", "__map__") {
 		mapSheet, err := generateMapJSON(mapData, gfxData, useSection3, useSection4)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("generating map JSON: %w", err)
 		}
 
 		if err := saveMapJSON(mapSheet, "map.json"); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving map.json: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("saving map.json: %w", err)
 		}
 		fmt.Println("Successfully generated map.json")
 	}
+	return nil
+}
+
+// resolveCartPath expands a leading ~ and makes the cart path absolute
+func resolveCartPath(cartPath string) (string, error) {
+	if strings.HasPrefix(cartPath, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting user home directory: %w", err)
+		}
+		cartPath = filepath.Join(homeDir, cartPath[2:])
+	}
+	return filepath.Abs(cartPath)
 }
 
 // generateMapJSON creates the JSON representation of the map
 func generateMapJSON(mapData, gfxData []string, useSection3, useSection4 bool) (*MapSheet, error) {
-	// Calculate map dimensions
-	width := 128 // Default width
-	height := 32 // Default height
-	if useSection3 {
-		height = 48
-	}
-	if useSection4 {
-		height = 64
-	}
+	mem := newMemory(map[string][]string{"__gfx__": gfxData, "__map__": mapData})
+	width := 128
+	height := mapHeightFor(useSection3, useSection4)
 
 	mapSheet := &MapSheet{
 		Version:     "1.0",
@@ -314,129 +429,33 @@ func generateMapJSON(mapData, gfxData []string, useSection3, useSection4 bool) (
 		Cells:       make([]MapCell, 0),
 	}
 
-	// Process main map layer (base section)
-	for y := 0; y < 32; y++ {
-		if y < len(mapData) {
-			line := mapData[y]
-			for x := 0; x < width; x++ {
-				if x*2+1 < len(line) {
-					// Each tile is represented by 2 hex digits
-					spriteY := parseHexChar(rune(line[x*2]))
-					spriteX := parseHexChar(rune(line[x*2+1]))
-					// Convert sprite coordinates to sprite ID
-					spriteID := spriteY*16 + spriteX
-
-					// Skip cells with sprite ID 0
-					if spriteID != 0 {
-						cell := MapCell{
-							X:      x,
-							Y:      y,
-							Sprite: spriteID,
-						}
-						mapSheet.Cells = append(mapSheet.Cells, cell)
-					}
-				}
-			}
+	for y := 0; y < height; y++ {
+		if !mapRowIncluded(y, useSection3, useSection4) {
+			continue
 		}
-	}
-
-	// Process section 3 if enabled (maps to rows 32–47)
-	if useSection3 {
-		startRow := 8 * 8       // 64
-		endRow := startRow + 32 // 96
-		if endRow > len(gfxData) {
-			endRow = len(gfxData)
-		}
-		if startRow < len(gfxData) {
-			section3Data := gfxData[startRow:endRow]
-			for y := 0; y < len(section3Data); y++ {
-				line := section3Data[y]
-				yIsEven := (y % 2) == 0
-				// Iterate over half the width of the line (64 tiles per row)
-				for x := 0; x < len(line)/2; x++ {
-					// First hex digit is spriteX, second is spriteY
-					spriteX := parseHexChar(rune(line[x*2]))
-					spriteY := parseHexChar(rune(line[x*2+1]))
-					// Convert sprite coordinates to sprite ID (0-127)
-					spriteID := spriteY*16 + spriteX
-
-					if yIsEven {
-						// Left half of the map (rows 32-47)
-						// Skip cells with sprite ID 0
-						if spriteID != 0 {
-							cell := MapCell{
-								X:      x,
-								Y:      32 + (y / 2),
-								Sprite: spriteID,
-							}
-							mapSheet.Cells = append(mapSheet.Cells, cell)
-						}
-					} else {
-						// Right half of the map (rows 32-47)
-						// Skip cells with sprite ID 0
-						if spriteID != 0 {
-							cell := MapCell{
-								X:      64 + x,
-								Y:      32 + ((y - 1) / 2),
-								Sprite: spriteID,
-							}
-							mapSheet.Cells = append(mapSheet.Cells, cell)
-						}
-					}
-				}
+		for x := 0; x < width; x++ {
+			// Skip cells with sprite ID 0
+			if spriteID := int(mem.Mget(x, y)); spriteID != 0 {
+				mapSheet.Cells = append(mapSheet.Cells, MapCell{X: x, Y: y, Sprite: spriteID})
 			}
 		}
 	}
 
-	// Process section 4 if enabled (maps to rows 48–63)
-	if useSection4 {
-		startRow := 12 * 8      // 96
-		endRow := startRow + 32 // 128
-		if endRow > len(gfxData) {
-			endRow = len(gfxData)
-		}
-		if startRow < len(gfxData) {
-			section4Data := gfxData[startRow:endRow]
-			for y := 0; y < len(section4Data); y++ {
-				line := section4Data[y]
-				yIsEven := (y % 2) == 0
-				// Iterate over half the width of the line (64 tiles per row)
-				for x := 0; x < len(line)/2; x++ {
-					// First hex digit is spriteX, second is spriteY
-					spriteX := parseHexChar(rune(line[x*2]))
-					spriteY := parseHexChar(rune(line[x*2+1]))
-					// Convert sprite coordinates to sprite ID (0-127)
-					spriteID := spriteY*16 + spriteX
-
-					if yIsEven {
-						// Left half of the map (rows 48-63)
-						// Skip cells with sprite ID 0
-						if spriteID != 0 {
-							cell := MapCell{
-								X:      x,
-								Y:      48 + (y / 2),
-								Sprite: spriteID,
-							}
-							mapSheet.Cells = append(mapSheet.Cells, cell)
-						}
-					} else {
-						// Right half of the map (rows 48-63)
-						// Skip cells with sprite ID 0
-						if spriteID != 0 {
-							cell := MapCell{
-								X:      64 + x,
-								Y:      48 + ((y - 1) / 2),
-								Sprite: spriteID,
-							}
-							mapSheet.Cells = append(mapSheet.Cells, cell)
-						}
-					}
-				}
-			}
+	return mapSheet, nil
+}
+
+// mapGrid expands the sparse map cells into a dense [y][x] grid of sprite IDs
+func mapGrid(mapSheet *MapSheet) [][]int {
+	grid := make([][]int, mapSheet.Height)
+	for y := range grid {
+		grid[y] = make([]int, mapSheet.Width)
+	}
+	for _, cell := range mapSheet.Cells {
+		if cell.Y >= 0 && cell.Y < mapSheet.Height && cell.X >= 0 && cell.X < mapSheet.Width {
+			grid[cell.Y][cell.X] = cell.Sprite
 		}
 	}
-
-	return mapSheet, nil
+	return grid
 }
 
 // parseSection reads lines between a given marker (e.g. __gfx__) until next marker __*
@@ -492,14 +511,42 @@ func reconstructImage(gfxData []string) *image.RGBA {
 	return img
 }
 
-// renderMap draws the map data (and dual-purpose sections) onto a new RGBA
-func renderMap(
-	mapData []string,
-	dualPurposeSection1, dualPurposeSection2 []string,
-	spriteSheet *image.RGBA,
-	mapWidth, mapHeight int,
-) *image.RGBA {
+// mapRowIncluded reports whether a map row is exported with the given flags.
+// Rows 32..63 share memory with sprites 128..255:
+// - Section 3 (--3) covers sprites 128..191 => map rows 32..47
+// - Section 4 (--4) covers sprites 192..255 => map rows 48..63
+func mapRowIncluded(y int, useSection3, useSection4 bool) bool {
+	switch {
+	case y < 32:
+		return true
+	case y < 48:
+		return useSection3
+	}
+	return useSection4
+}
+
+// mapHeightFor returns the map height in tiles for the given dual-purpose flags
+func mapHeightFor(useSection3, useSection4 bool) int {
+	mapHeight := 32
+	if useSection3 {
+		mapHeight = 48
+	}
+	if useSection4 {
+		mapHeight = 64
+	}
+	return mapHeight
+}
+
+// renderCartMap renders the full 128-wide map including any dual-purpose rows
+func renderCartMap(mapData, gfxData []string, spriteSheet *image.RGBA, useSection3, useSection4 bool) *image.RGBA {
+	mem := newMemory(map[string][]string{"__gfx__": gfxData, "__map__": mapData})
+	return renderMap(mem, spriteSheet, useSection3, useSection4)
+}
+
+// renderMap draws the map cells stored in memory (and dual-purpose rows) onto a new RGBA
+func renderMap(mem *Memory, spriteSheet *image.RGBA, useSection3, useSection4 bool) *image.RGBA {
 	const tileSize = 8
+	mapWidth, mapHeight := 128, mapHeightFor(useSection3, useSection4)
 	mapImage := image.NewRGBA(image.Rect(0, 0, mapWidth*tileSize, mapHeight*tileSize))
 
 	// Fill background with black
@@ -509,63 +556,14 @@ func renderMap(
 		}
 	}
 
-	// Draw regular map data (each line is hex data for 128 tiles = 256 hex chars)
-	for y := 0; y < len(mapData); y++ {
-		line := mapData[y]
-		// Each tile is 2 hex digits => 1 tile
-		for x := 0; x < len(line)/2; x++ {
-			spriteY := parseHexChar(rune(line[x*2]))   // First hex digit is spriteY
-			spriteX := parseHexChar(rune(line[x*2+1])) // Second hex digit is spriteX
-
-			if spriteX != 0 || spriteY != 0 {
-				drawSprite(mapImage, spriteSheet, spriteX, spriteY, x, y)
-			}
-		}
-	}
-
-	// Now draw dual-purpose section 1 (section 3)
-	if dualPurposeSection1 != nil {
-		for y := 0; y < len(dualPurposeSection1); y++ {
-			line := dualPurposeSection1[y]
-			for x := 0; x < len(line)/2; x++ {
-				spriteX := parseHexChar(rune(line[x*2]))
-				spriteY := parseHexChar(rune(line[x*2+1]))
-
-				yIsEven := (y % 2) == 0
-				if yIsEven {
-					// same logic as your original "if yIsOdd" (slight rename for clarity)
-					if spriteX != 0 || spriteY != 0 {
-						drawSprite(mapImage, spriteSheet, spriteX, spriteY, x, 32+(y/2))
-					} else {
-						drawBlackTile(mapImage, x, 32+(y/2))
-					}
-				} else {
-					if spriteX != 0 || spriteY != 0 {
-						drawSprite(mapImage, spriteSheet, spriteX, spriteY, 64+x, 32+((y-1)/2))
-					}
-				}
-			}
+	for y := 0; y < mapHeight; y++ {
+		if !mapRowIncluded(y, useSection3, useSection4) {
+			continue
 		}
-	}
-
-	// Dual-purpose section 2 (section 4)
-	if dualPurposeSection2 != nil {
-		for y := 0; y < len(dualPurposeSection2); y++ {
-			line := dualPurposeSection2[y]
-			for x := 0; x < len(line)/2; x++ {
-				spriteX := parseHexChar(rune(line[x*2]))
-				spriteY := parseHexChar(rune(line[x*2+1]))
-
-				yIsEven := (y % 2) == 0
-				if yIsEven {
-					if spriteX != 0 || spriteY != 0 {
-						drawSprite(mapImage, spriteSheet, spriteX, spriteY, x, 48+(y/2))
-					}
-				} else {
-					if spriteX != 0 || spriteY != 0 {
-						drawSprite(mapImage, spriteSheet, spriteX, spriteY, 64+x, 48+((y-1)/2))
-					}
-				}
+		for x := 0; x < mapWidth; x++ {
+			// The high nibble is the sprite row, the low nibble the column
+			if spriteID := int(mem.Mget(x, y)); spriteID != 0 {
+				drawSprite(mapImage, spriteSheet, spriteID%16, spriteID/16, x, y)
 			}
 		}
 	}
@@ -588,19 +586,6 @@ func drawSprite(dst *image.RGBA, src *image.RGBA, spriteX, spriteY, dstTileX, ds
 	}
 }
 
-// drawBlackTile just fills an 8x8 region with black
-func drawBlackTile(dst *image.RGBA, tileX, tileY int) {
-	const tileSize = 8
-	dstX := tileX * tileSize
-	dstY := tileY * tileSize
-
-	for yy := 0; yy < tileSize; yy++ {
-		for xx := 0; xx < tileSize; xx++ {
-			dst.Set(dstX+xx, dstY+yy, pico8Palette[0])
-		}
-	}
-}
-
 // saveSprites writes individual sprite images plus sub-image sections
 func saveSprites(spriteSheet *image.RGBA, useSection3, useSection4 bool) {
 	const tileSize = 8
@@ -662,18 +647,39 @@ func saveSprites(spriteSheet *image.RGBA, useSection3, useSection4 bool) {
 	fmt.Printf("Saved %d sections into 'sprites' folder.\n", numSections)
 }
 
-// saveAsPng encodes the RGBA image to a PNG file
-func saveAsPng(img *image.RGBA, path string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+// saveAsPng encodes the image to a PNG file
+func saveAsPng(img image.Image, path string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
+
+// writeFileAtomic writes into a temporary file next to path and renames it into
+// place, so a reader sees either the old file or the new one but never a partial write
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	f, err := os.Create(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer f.Close() //nolint:errcheck
-
-	return png.Encode(f, img)
+	if err := write(f); err != nil {
+		f.Close()           //nolint:errcheck
+		os.Remove(f.Name()) //nolint:errcheck
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name()) //nolint:errcheck
+		return err
+	}
+	// CreateTemp makes the file private; match what os.Create would have produced
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name()) //nolint:errcheck
+		return err
+	}
+	return os.Rename(f.Name(), path)
 }
 
 // parseHexChar interprets a single hex digit (0..F)
@@ -930,7 +936,10 @@ func saveSpritesheetJSON(spriteSheet *SpriteSheet, path string) error {
 		return fmt.Errorf("error marshaling JSON: %w", err)
 	}
 
-	return os.WriteFile(path, data, 0644)
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
 }
 
 // createIndividualSpritePNGs creates PNG files for each sprite from the JSON data
@@ -987,5 +996,8 @@ func saveMapJSON(mapSheet *MapSheet, path string) error {
 		return fmt.Errorf("error marshaling map JSON: %w", err)
 	}
 
-	return os.WriteFile(path, data, 0644)
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// layerMatches mirrors the LAYERS argument of map(): a zero mask draws every tile,
+// otherwise the sprite flags must contain all of the mask's bits (or share one
+// with it when matchAny is set).
+func layerMatches(flags, layers int, matchAny bool) bool {
+	if layers == 0 {
+		return true
+	}
+	if matchAny {
+		return flags&layers != 0
+	}
+	return flags&layers == layers
+}
+
+// renderMapLayers draws the non-empty map cells whose sprite flags match the layer mask
+func renderMapLayers(grid [][]int, spriteSheet *image.RGBA, flagData []int, layers int, matchAny bool) *image.RGBA {
+	const tileSize = 8
+	height, width := len(grid), len(grid[0])
+	mapImage := image.NewRGBA(image.Rect(0, 0, width*tileSize, height*tileSize))
+	draw.Draw(mapImage, mapImage.Bounds(), image.NewUniform(pico8Palette[0]), image.Point{}, draw.Src)
+
+	for y, row := range grid {
+		for x, id := range row {
+			if id != 0 && layerMatches(flagData[id], layers, matchAny) {
+				drawSprite(mapImage, spriteSheet, id%16, id/16, x, y)
+			}
+		}
+	}
+	return mapImage
+}
+
+// saveLayerMaps writes map_layer_N.png for each flag bit and map_layers.png, a
+// composite with the eight layers laid out two per row in bit order
+func saveLayerMaps(grid [][]int, spriteSheet *image.RGBA, flagData []int) error {
+	var composite *image.RGBA
+	for bit := 0; bit < 8; bit++ {
+		layer := renderMapLayers(grid, spriteSheet, flagData, 1<<bit, false)
+		path := fmt.Sprintf("map_layer_%d.png", bit)
+		if err := saveAsPng(layer, path); err != nil {
+			return fmt.Errorf("failed to save %s: %w", path, err)
+		}
+
+		w, h := layer.Bounds().Dx(), layer.Bounds().Dy()
+		if composite == nil {
+			composite = image.NewRGBA(image.Rect(0, 0, w*2, h*4))
+		}
+		at := image.Pt((bit%2)*w, (bit/2)*h)
+		draw.Draw(composite, layer.Bounds().Add(at), layer, image.Point{}, draw.Src)
+	}
+
+	if err := saveAsPng(composite, "map_layers.png"); err != nil {
+		return fmt.Errorf("failed to save map_layers.png: %w", err)
+	}
+	return nil
+}
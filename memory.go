@@ -0,0 +1,224 @@
+package main
+
+// PICO-8 memory layout. The first 0x4300 bytes are the cart ROM, copied into
+// RAM at startup; the rest is working memory.
+const (
+	memGfx       = 0x0000 // sprites 0..127
+	memShared    = 0x1000 // sprites 128..255, or map rows 32..63
+	memMap       = 0x2000 // map rows 0..31
+	memFlags     = 0x3000 // sprite flags, one byte per sprite
+	memMusic     = 0x3100 // 64 patterns of 4 bytes
+	memSfx       = 0x3200 // 64 effects of 68 bytes
+	memROMEnd    = 0x4300 // general use memory starts here
+	memDrawPal   = 0x5f00 // draw palette; bit 4 marks the color transparent
+	memScreenPal = 0x5f10 // display palette; 128..143 are the secret colors
+	memClip      = 0x5f20 // clip rectangle: left, top, right, bottom (exclusive)
+	memPen       = 0x5f25 // current draw color
+	memCursor    = 0x5f26 // print cursor x, y
+	memCamera    = 0x5f28 // camera x, y as two signed 16-bit values
+	memScreen    = 0x6000 // 128x128 screen, two pixels per byte
+	memSize      = 0x8000
+)
+
+// Memory is the PICO-8 address space. Pixel data (sprites and screen) holds
+// two pixels per byte with the left pixel in the low nibble, and multi-byte
+// values are little endian.
+type Memory struct {
+	data [memSize]byte
+}
+
+// newMemory lays out cart sections the way PICO-8 loads them into ROM, keyed by
+// section marker ("__gfx__", "__gff__", "__map__", "__sfx__", "__music__").
+// Missing sections stay zero.
+func newMemory(sections map[string][]string) *Memory {
+	m := &Memory{}
+	hexByte := func(s string) byte {
+		hi, lo := parseHexChar(rune(s[0])), parseHexChar(rune(s[1]))
+		if hi < 0 || lo < 0 {
+			return 0
+		}
+		return byte(hi<<4 | lo)
+	}
+
+	// Graphics are stored as hex pixels, left to right
+	for y, line := range sections["__gfx__"] {
+		for x := 0; x < 128 && x < len(line) && y < 128; x++ {
+			if c := parseHexChar(rune(line[x])); c >= 0 {
+				m.Sset(x, y, byte(c))
+			}
+		}
+	}
+	// Flags and the map are plain hex bytes
+	for i, line := range sections["__gff__"] {
+		for j := 0; j+1 < len(line) && i*128+j/2 < 256; j += 2 {
+			m.data[memFlags+i*128+j/2] = hexByte(line[j:])
+		}
+	}
+	for y, line := range sections["__map__"] {
+		for x := 0; x < 128 && 2*x+1 < len(line) && y < 32; x++ {
+			m.data[memMap+y*128+x] = hexByte(line[2*x:])
+		}
+	}
+	// Music lines are "ff 01020304": loop/stop flags live in bit 7 of the
+	// first three channel bytes
+	for i, line := range sections["__music__"] {
+		if i >= 64 || len(line) < 11 {
+			continue
+		}
+		flags := hexByte(line)
+		for ch := 0; ch < 4; ch++ {
+			b := hexByte(line[3+2*ch:])
+			if ch < 3 && flags&(1<<ch) != 0 {
+				b |= 0x80
+			}
+			m.data[memMusic+i*4+ch] = b
+		}
+	}
+	// Each sfx line is an 8 char header then 32 notes of 5 chars. In memory the
+	// notes come first, 16 bits each, then editor mode, speed and loop points.
+	for i, line := range sections["__sfx__"] {
+		if i >= 64 || len(line) < 8 {
+			continue
+		}
+		base := memSfx + i*68
+		for n := 0; n < 32 && 8+n*5+5 <= len(line); n++ {
+			note := line[8+n*5:]
+			pitch := uint16(hexByte(note)) & 0x3f
+			waveform := uint16(max(parseHexChar(rune(note[2])), 0))
+			volume := uint16(max(parseHexChar(rune(note[3])), 0))
+			effect := uint16(max(parseHexChar(rune(note[4])), 0))
+			m.Poke2(base+n*2, pitch|(waveform&7)<<6|(volume&7)<<9|(effect&7)<<12|(waveform>>3)<<15)
+		}
+		for j := 0; j < 4; j++ {
+			m.data[base+64+j] = hexByte(line[2*j:])
+		}
+	}
+	return m
+}
+
+// Peek reads a byte; addresses outside memory read as 0
+func (m *Memory) Peek(addr int) byte {
+	if addr < 0 || addr >= memSize {
+		return 0
+	}
+	return m.data[addr]
+}
+
+// Poke writes a byte; addresses outside memory are ignored
+func (m *Memory) Poke(addr int, v byte) {
+	if addr >= 0 && addr < memSize {
+		m.data[addr] = v
+	}
+}
+
+// Peek2 reads a little endian 16-bit value
+func (m *Memory) Peek2(addr int) uint16 {
+	return uint16(m.Peek(addr)) | uint16(m.Peek(addr+1))<<8
+}
+
+// Poke2 writes a little endian 16-bit value
+func (m *Memory) Poke2(addr int, v uint16) {
+	m.Poke(addr, byte(v))
+	m.Poke(addr+1, byte(v>>8))
+}
+
+// Peek4 reads a little endian 32-bit value, which is a number's raw 16.16 bits
+func (m *Memory) Peek4(addr int) uint32 {
+	return uint32(m.Peek2(addr)) | uint32(m.Peek2(addr+2))<<16
+}
+
+// Poke4 writes a little endian 32-bit value
+func (m *Memory) Poke4(addr int, v uint32) {
+	m.Poke2(addr, uint16(v))
+	m.Poke2(addr+2, uint16(v>>16))
+}
+
+// Memcpy copies n bytes; overlapping ranges behave as if copied through a buffer
+func (m *Memory) Memcpy(dst, src, n int) {
+	if n <= 0 {
+		return
+	}
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = m.Peek(src + i)
+	}
+	for i, b := range buf {
+		m.Poke(dst+i, b)
+	}
+}
+
+// Memset fills n bytes with v
+func (m *Memory) Memset(dst int, v byte, n int) {
+	for i := 0; i < n; i++ {
+		m.Poke(dst+i, v)
+	}
+}
+
+// Sget reads a sprite sheet pixel
+func (m *Memory) Sget(x, y int) byte {
+	if x < 0 || x >= 128 || y < 0 || y >= 128 {
+		return 0
+	}
+	return nibble(m.data[memGfx+y*64+x/2], x)
+}
+
+// Sset writes a sprite sheet pixel
+func (m *Memory) Sset(x, y int, c byte) {
+	if x >= 0 && x < 128 && y >= 0 && y < 128 {
+		setNibble(&m.data[memGfx+y*64+x/2], x, c)
+	}
+}
+
+// Pixel reads a screen pixel
+func (m *Memory) Pixel(x, y int) byte {
+	if x < 0 || x >= 128 || y < 0 || y >= 128 {
+		return 0
+	}
+	return nibble(m.data[memScreen+y*64+x/2], x)
+}
+
+// SetPixel writes a screen pixel
+func (m *Memory) SetPixel(x, y int, c byte) {
+	if x >= 0 && x < 128 && y >= 0 && y < 128 {
+		setNibble(&m.data[memScreen+y*64+x/2], x, c)
+	}
+}
+
+// mapAddr is where map cell (x, y) lives. Rows 32..63 are the same bytes as
+// the bottom half of the sprite sheet.
+func mapAddr(x, y int) int {
+	if y < 32 {
+		return memMap + y*128 + x
+	}
+	return memShared + (y-32)*128 + x
+}
+
+// Mget reads a map cell; cells outside the 128x64 map read as 0
+func (m *Memory) Mget(x, y int) byte {
+	if x < 0 || x >= 128 || y < 0 || y >= 64 {
+		return 0
+	}
+	return m.data[mapAddr(x, y)]
+}
+
+// Mset writes a map cell
+func (m *Memory) Mset(x, y int, v byte) {
+	if x >= 0 && x < 128 && y >= 0 && y < 64 {
+		m.data[mapAddr(x, y)] = v
+	}
+}
+
+func nibble(b byte, x int) byte {
+	if x%2 == 0 {
+		return b & 0x0f
+	}
+	return b >> 4
+}
+
+func setNibble(b *byte, x int, c byte) {
+	if x%2 == 0 {
+		*b = *b&0xf0 | c&0x0f
+	} else {
+		*b = *b&0x0f | c<<4
+	}
+}
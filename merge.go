@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// mergeConflict is a unit of data both sides changed in different ways
+type mergeConflict struct {
+	Section string
+	Where   string
+}
+
+// runMerge implements the "merge" subcommand. It is meant as a git merge driver:
+//
+//	git config merge.pico8.driver "parsepico8 merge %O %A %B"
+//	echo "*.p8 merge=pico8" >> .gitattributes
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	outPath := fs.String("o", "", "Write the result here instead of over the ours file")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 merge [-o out.p8] base.p8 ours.p8 theirs.p8")
+		os.Exit(2)
+	}
+	var carts [3]*cartFile
+	for i := range carts {
+		cart, err := readCartFile(fs.Arg(i))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", fs.Arg(i), err)
+			os.Exit(2)
+		}
+		carts[i] = cart
+	}
+
+	merged, conflicts := mergeCarts(carts[0], carts[1], carts[2])
+
+	target := *outPath
+	if target == "" {
+		target = fs.Arg(1)
+	}
+	err := writeFileAtomic(target, func(w io.Writer) error {
+		_, err := io.WriteString(w, merged.String())
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", target, err)
+		os.Exit(2)
+	}
+
+	if len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "%d conflicts (ours was kept for data sections, Lua has conflict markers):\n", len(conflicts))
+		for _, c := range conflicts {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", c.Section, c.Where)
+		}
+		os.Exit(1)
+	}
+}
+
+// mergeCarts merges section by section, in the order the sections appear in ours
+// followed by sections that only theirs has
+func mergeCarts(base, ours, theirs *cartFile) (*cartFile, []mergeConflict) {
+	merged := &cartFile{Header: ours.Header}
+	var conflicts []mergeConflict
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, cart := range []*cartFile{ours, theirs} {
+		for _, s := range cart.Sections {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				names = append(names, s.Name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		b, inBase := base.section(name)
+		o, inOurs := ours.section(name)
+		t, inTheirs := theirs.section(name)
+		// A side that deleted an unchanged section wins
+		if inBase && ((!inOurs && equalLines(b, t)) || (!inTheirs && equalLines(b, o))) {
+			continue
+		}
+
+		var lines []string
+		var sectionConflicts []mergeConflict
+		if name == "__lua__" {
+			lines, sectionConflicts = mergeText(name, b, o, t)
+		} else {
+			lines, sectionConflicts = mergeData(name, b, o, t)
+		}
+		merged.Sections = append(merged.Sections, cartSection{Name: name, Lines: lines})
+		conflicts = append(conflicts, sectionConflicts...)
+	}
+	return merged, conflicts
+}
+
+// equalLines compares two line slices
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeText is a line based three-way merge that writes conflict markers
+func mergeText(name string, base, ours, theirs []string) ([]string, []mergeConflict) {
+	matchOurs := matchedLines(base, ours)
+	matchTheirs := matchedLines(base, theirs)
+
+	var out []string
+	var conflicts []mergeConflict
+	i, o, t := 0, 0, 0
+	for i < len(base) || o < len(ours) || t < len(theirs) {
+		// Lines kept by both sides are stable
+		if i < len(base) && matchOurs[i] == o && matchTheirs[i] == t {
+			out = append(out, base[i])
+			i, o, t = i+1, o+1, t+1
+			continue
+		}
+
+		// Otherwise find the next stable line and resolve the chunk before it
+		next := i
+		for next < len(base) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		oEnd, tEnd := len(ours), len(theirs)
+		if next < len(base) {
+			oEnd, tEnd = matchOurs[next], matchTheirs[next]
+		}
+		b, oc, tc := base[i:next], ours[o:oEnd], theirs[t:tEnd]
+
+		switch {
+		case equalLines(oc, b):
+			out = append(out, tc...)
+		case equalLines(tc, b), equalLines(oc, tc):
+			out = append(out, oc...)
+		default:
+			conflicts = append(conflicts, mergeConflict{Section: name, Where: fmt.Sprintf("conflict markers at line %d", len(out)+1)})
+			out = append(out, "<<<<<<< ours")
+			out = append(out, oc...)
+			out = append(out, "||||||| base")
+			out = append(out, b...)
+			out = append(out, "=======")
+			out = append(out, tc...)
+			out = append(out, ">>>>>>> theirs")
+		}
+		i, o, t = next, oEnd, tEnd
+	}
+	return out, conflicts
+}
+
+// matchedLines maps each base line to its line in other, or -1 if it was removed
+func matchedLines(base, other []string) []int {
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, e := range diffLines(base, other) {
+		if e.Op == ' ' {
+			match[e.A] = e.B
+		}
+	}
+	return match
+}
+
+// mergeData merges the hex data sections unit by unit: a pixel for gfx and label,
+// a cell for map, a sprite's flag byte for gff, a header byte or note for sfx,
+// and a whole pattern line for music and unknown sections
+func mergeData(name string, base, ours, theirs []string) ([]string, []mergeConflict) {
+	n := max(len(base), len(ours), len(theirs))
+	out := make([]string, 0, n)
+	var conflicts []mergeConflict
+	for y := 0; y < n; y++ {
+		b, o, t := lineAt(base, y), lineAt(ours, y), lineAt(theirs, y)
+		widths := dataUnitWidths(name, max(len(b), len(o), len(t)))
+		if widths == nil {
+			// Whole-line units; a missing line stays missing
+			line, ok := mergeUnit(b, o, t)
+			if !ok {
+				conflicts = append(conflicts, mergeConflict{Section: name, Where: describeDataUnit(name, y, 0)})
+			}
+			if y < len(ours) || y < len(theirs) {
+				out = append(out, line)
+			}
+			continue
+		}
+
+		width := 0
+		for _, w := range widths {
+			width += w
+		}
+		b, o, t = padHex(b, width), padHex(o, width), padHex(t, width)
+		var line strings.Builder
+		pos := 0
+		for unit, w := range widths {
+			merged, ok := mergeUnit(b[pos:pos+w], o[pos:pos+w], t[pos:pos+w])
+			if !ok {
+				conflicts = append(conflicts, mergeConflict{Section: name, Where: describeDataUnit(name, y, unit)})
+			}
+			line.WriteString(merged)
+			pos += w
+		}
+		out = append(out, line.String())
+	}
+	return out, conflicts
+}
+
+// mergeUnit resolves one unit; on a real conflict ours is kept
+func mergeUnit(base, ours, theirs string) (string, bool) {
+	switch {
+	case ours == theirs, theirs == base:
+		return ours, true
+	case ours == base:
+		return theirs, true
+	}
+	return ours, false
+}
+
+// dataUnitWidths returns the widths of the units a data line is split into, or nil for whole lines
+func dataUnitWidths(name string, length int) []int {
+	repeat := func(w, count int) []int {
+		widths := make([]int, count)
+		for i := range widths {
+			widths[i] = w
+		}
+		return widths
+	}
+	switch name {
+	case "__gfx__", "__label__":
+		return repeat(1, length)
+	case "__map__", "__gff__":
+		return repeat(2, (length+1)/2)
+	case "__sfx__":
+		return append(repeat(2, 4), repeat(5, 32)...)
+	}
+	return nil
+}
+
+// describeDataUnit names a conflicting unit for the report
+func describeDataUnit(name string, line, unit int) string {
+	switch name {
+	case "__gfx__", "__label__":
+		return fmt.Sprintf("pixel (%d,%d)", unit, line)
+	case "__map__":
+		return fmt.Sprintf("cell (%d,%d)", unit, line)
+	case "__gff__":
+		return fmt.Sprintf("sprite %d flags", line*128+unit)
+	case "__sfx__":
+		if unit < 4 {
+			return fmt.Sprintf("sfx %d %s", line, []string{"mode", "speed", "loop start", "loop end"}[unit])
+		}
+		return fmt.Sprintf("sfx %d note %d", line, unit-4)
+	case "__music__":
+		return fmt.Sprintf("pattern %d", line)
+	}
+	return fmt.Sprintf("line %d", line+1)
+}
+
+// lineAt returns line y or "" when the section is shorter
+func lineAt(lines []string, y int) string {
+	if y < len(lines) {
+		return lines[y]
+	}
+	return ""
+}
+
+// padHex extends a hex line with zeros, which PICO-8 treats the same as missing data
+func padHex(line string, width int) string {
+	if len(line) >= width {
+		return line
+	}
+	return line + strings.Repeat("0", width-len(line))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeText(t *testing.T) {
+	base := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		name          string
+		ours, theirs  []string
+		want          []string
+		wantConflicts int
+	}{
+		{"no changes", base, base, base, 0},
+		{"ours only", []string{"a", "B", "c", "d"}, base, []string{"a", "B", "c", "d"}, 0},
+		{"theirs only", base, []string{"a", "b", "c", "D"}, []string{"a", "b", "c", "D"}, 0},
+		{"both sides, different lines", []string{"A", "b", "c", "d"}, []string{"a", "b", "c", "D"}, []string{"A", "b", "c", "D"}, 0},
+		{"same change on both sides", []string{"a", "X", "c", "d"}, []string{"a", "X", "c", "d"}, []string{"a", "X", "c", "d"}, 0},
+		{"insert and delete", []string{"a", "a2", "b", "c", "d"}, []string{"a", "b", "d"}, []string{"a", "a2", "b", "d"}, 0},
+		{
+			"conflict",
+			[]string{"a", "ours", "c", "d"}, []string{"a", "theirs", "c", "d"},
+			[]string{"a", "<<<<<<< ours", "ours", "||||||| base", "b", "=======", "theirs", ">>>>>>> theirs", "c", "d"},
+			1,
+		},
+	}
+	for _, tt := range tests {
+		got, conflicts := mergeText("__lua__", base, tt.ours, tt.theirs)
+		if !slices.Equal(got, tt.want) || len(conflicts) != tt.wantConflicts {
+			t.Errorf("%s: mergeText = %q, %d conflicts; want %q, %d", tt.name, got, len(conflicts), tt.want, tt.wantConflicts)
+		}
+	}
+
+	_, conflicts := mergeText("__lua__", base, []string{"a", "ours", "c", "d"}, []string{"a", "theirs", "c", "d"})
+	if want := (mergeConflict{Section: "__lua__", Where: "conflict markers at line 2"}); len(conflicts) != 1 || conflicts[0] != want {
+		t.Errorf("conflicts = %v; want %v", conflicts, want)
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	notes := strings.Repeat("00000", 32)
+	note := "0c2f5"
+	tests := []struct {
+		name               string
+		section            string
+		base, ours, theirs []string
+		want               []string
+		wantConflicts      []string
+	}{
+		{"gfx pixels on both sides", "__gfx__", []string{"0000"}, []string{"1000"}, []string{"0002"}, []string{"1002"}, nil},
+		{"gfx same pixel", "__gfx__", []string{"0000", "0000"}, []string{"0000", "0100"}, []string{"0000", "0200"}, []string{"0000", "0100"}, []string{"pixel (1,1)"}},
+		{"gfx line added by theirs", "__gfx__", []string{"00"}, []string{"10"}, []string{"00", "77"}, []string{"10", "77"}, nil},
+		{"map cells", "__map__", []string{"0000"}, []string{"0100"}, []string{"0002"}, []string{"0102"}, nil},
+		{"map same cell", "__map__", []string{"0000"}, []string{"0100"}, []string{"0200"}, []string{"0100"}, []string{"cell (0,0)"}},
+		{"gff flags", "__gff__", []string{"0000"}, []string{"0000"}, []string{"0001"}, []string{"0001"}, nil},
+		{
+			"sfx header and note",
+			"__sfx__",
+			[]string{"00100000" + notes},
+			[]string{"00200000" + notes},
+			[]string{"00100000" + note + notes[5:]},
+			[]string{"00200000" + note + notes[5:]},
+			nil,
+		},
+		{
+			"sfx same note",
+			"__sfx__",
+			[]string{"00100000" + notes},
+			[]string{"00100000" + notes[:15] + note + notes[20:]},
+			[]string{"00100000" + notes[:15] + "01234" + notes[20:]},
+			[]string{"00100000" + notes[:15] + note + notes[20:]},
+			[]string{"sfx 0 note 3"},
+		},
+		{"music patterns", "__music__", []string{"00 01424344", "00 05424344"}, []string{"01 01424344", "00 05424344"}, []string{"00 01424344", "02 05424344"}, []string{"01 01424344", "02 05424344"}, nil},
+		{"music same pattern", "__music__", []string{"00 01424344"}, []string{"01 01424344"}, []string{"02 01424344"}, []string{"01 01424344"}, []string{"pattern 0"}},
+	}
+	for _, tt := range tests {
+		got, conflicts := mergeData(tt.section, tt.base, tt.ours, tt.theirs)
+		var where []string
+		for _, c := range conflicts {
+			where = append(where, c.Where)
+		}
+		if !slices.Equal(got, tt.want) || !slices.Equal(where, tt.wantConflicts) {
+			t.Errorf("%s: mergeData = %q, conflicts %q; want %q, %q", tt.name, got, where, tt.want, tt.wantConflicts)
+		}
+	}
+}
+
+// testCart builds a cart from name, lines, name, lines, ...
+func testCart(sections ...any) *cartFile {
+	cart := &cartFile{Header: []string{"pico-8 cartridge // http://www.pico-8.com", "version 41"}}
+	for i := 0; i < len(sections); i += 2 {
+		cart.Sections = append(cart.Sections, cartSection{Name: sections[i].(string), Lines: sections[i+1].([]string)})
+	}
+	return cart
+}
+
+func TestMergeCarts(t *testing.T) {
+	lua := []string{"x = 1", "y = 2"}
+	gfx := []string{"0000"}
+	tests := []struct {
+		name          string
+		base, ours    *cartFile
+		theirs        *cartFile
+		want          *cartFile
+		wantConflicts int
+	}{
+		{
+			"clean merge of both sides",
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", []string{"x = 3", "y = 2"}, "__gfx__", gfx),
+			testCart("__lua__", lua, "__gfx__", []string{"0070"}),
+			testCart("__lua__", []string{"x = 3", "y = 2"}, "__gfx__", []string{"0070"}),
+			0,
+		},
+		{
+			"section deleted by ours and unchanged by theirs",
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", lua),
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", lua),
+			0,
+		},
+		{
+			"section deleted by theirs and unchanged by ours",
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", lua),
+			testCart("__lua__", lua),
+			0,
+		},
+		{
+			"section deleted by one side and changed by the other",
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", lua),
+			testCart("__lua__", lua, "__gfx__", []string{"1000"}),
+			testCart("__lua__", lua, "__gfx__", []string{"1000"}),
+			0,
+		},
+		{
+			"section added by theirs",
+			testCart("__lua__", lua),
+			testCart("__lua__", lua),
+			testCart("__lua__", lua, "__music__", []string{"00 01424344"}),
+			testCart("__lua__", lua, "__music__", []string{"00 01424344"}),
+			0,
+		},
+		{
+			"conflicts in code and data",
+			testCart("__lua__", lua, "__gfx__", gfx),
+			testCart("__lua__", []string{"x = 3", "y = 2"}, "__gfx__", []string{"1000"}),
+			testCart("__lua__", []string{"x = 4", "y = 2"}, "__gfx__", []string{"2000"}),
+			testCart(
+				"__lua__", []string{"<<<<<<< ours", "x = 3", "||||||| base", "x = 1", "=======", "x = 4", ">>>>>>> theirs", "y = 2"},
+				"__gfx__", []string{"1000"},
+			),
+			2,
+		},
+	}
+	for _, tt := range tests {
+		got, conflicts := mergeCarts(tt.base, tt.ours, tt.theirs)
+		if got.String() != tt.want.String() || len(conflicts) != tt.wantConflicts {
+			t.Errorf("%s: mergeCarts = %q, %d conflicts; want %q, %d", tt.name, got.String(), len(conflicts), tt.want.String(), tt.wantConflicts)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+// MetaspriteSheet is the metasprites.json output
+type MetaspriteSheet struct {
+	Version     string       `json:"version"`
+	Description string       `json:"description"`
+	Metasprites []Metasprite `json:"metasprites"`
+}
+
+// Metasprite is a composite object made of several 8x8 tiles. The name,
+// sprite, w and h fields match MetaspriteDef so the file can be fed back
+// into the atlas command as --config.
+type Metasprite struct {
+	Name     string `json:"name"`
+	Sprite   int    `json:"sprite"` // top-left tile
+	W        int    `json:"w"`      // width in tiles
+	H        int    `json:"h"`      // height in tiles
+	X        int    `json:"x"`      // pixel bounds on the sprite sheet
+	Y        int    `json:"y"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Source   string `json:"source"`         // "region", "spr" or "sspr"
+	Line     int    `json:"line,omitempty"` // __lua__ line for spr/sspr calls
+	Filename string `json:"filename"`
+}
+
+// runMetasprites implements the "metasprites" subcommand
+func runMetasprites(args []string) {
+	fs := flag.NewFlagSet("metasprites", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	gap := fs.Int("gap", 0, "Number of empty pixels allowed between parts of one object")
+	noCode := fs.Bool("no-code", false, "Do not scan __lua__ for spr/sspr calls")
+	outDir := fs.String("out", "metasprites", "Output directory for the cropped PNGs")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	if len(gfxData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+
+	sheet := &MetaspriteSheet{
+		Version:     "1.0",
+		Description: "PICO-8 metasprite export",
+		Metasprites: detectMetaspriteRegions(gfxData, *gap, opts.useSection3, opts.useSection4),
+	}
+	if !*noCode {
+		code := parseSection(cartPath, "__lua__")
+		sheet.Metasprites = appendUnique(sheet.Metasprites, findCodeMetasprites(code, opts.useSection3, opts.useSection4))
+	}
+
+	spriteSheet := reconstructImage(gfxData)
+	for i := range sheet.Metasprites {
+		meta := &sheet.Metasprites[i]
+		meta.Filename = meta.Name + ".png"
+		crop := cropImage(spriteSheet, image.Rect(meta.X, meta.Y, meta.X+meta.Width, meta.Y+meta.Height))
+		path := filepath.Join(*outDir, meta.Filename)
+		if err := saveAsPng(crop, path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Saved %d metasprites into '%s' folder.\n", len(sheet.Metasprites), *outDir)
+
+	data, err := json.MarshalIndent(sheet, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling metasprite JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("metasprites.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving metasprites.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated metasprites.json")
+}
+
+// sheetPixels decodes __gfx__ into a 128x128 grid of color indices (invalid hex becomes 0)
+func sheetPixels(gfxData []string) [][]int {
+	const size = 16 * 8
+	pixels := make([][]int, size)
+	for y := range pixels {
+		pixels[y] = make([]int, size)
+		if y >= len(gfxData) {
+			continue
+		}
+		line := gfxData[y]
+		for x := 0; x < size && x < len(line); x++ {
+			if c := parseHexChar(rune(line[x])); c > 0 {
+				pixels[y][x] = c
+			}
+		}
+	}
+	return pixels
+}
+
+// detectMetaspriteRegions groups non-empty pixels that touch (within gap
+// pixels) into objects, snaps them to the tile grid and keeps the ones that
+// span more than one tile.
+func detectMetaspriteRegions(gfxData []string, gap int, useSection3, useSection4 bool) []Metasprite {
+	const size = 16 * 8
+	pixels := sheetPixels(gfxData)
+	opaque := func(x, y int) bool {
+		id := (y/8)*16 + x/8
+		return pixels[y][x] != 0 && spriteAvailable(id, useSection3, useSection4)
+	}
+
+	// Flood fill components, tracking their bounding boxes in tiles
+	var rects []image.Rectangle
+	seen := make([][]bool, size)
+	for y := range seen {
+		seen[y] = make([]bool, size)
+	}
+	reach := gap + 1
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if seen[y][x] || !opaque(x, y) {
+				continue
+			}
+			bounds := image.Rect(x/8, y/8, x/8+1, y/8+1)
+			stack := []image.Point{{x, y}}
+			seen[y][x] = true
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				bounds = bounds.Union(image.Rect(p.X/8, p.Y/8, p.X/8+1, p.Y/8+1))
+				for ny := max(p.Y-reach, 0); ny <= min(p.Y+reach, size-1); ny++ {
+					for nx := max(p.X-reach, 0); nx <= min(p.X+reach, size-1); nx++ {
+						if !seen[ny][nx] && opaque(nx, ny) {
+							seen[ny][nx] = true
+							stack = append(stack, image.Point{nx, ny})
+						}
+					}
+				}
+			}
+			rects = append(rects, bounds)
+		}
+	}
+
+	rects = mergeOverlappingRects(rects)
+
+	var metas []Metasprite
+	for _, r := range rects {
+		if r.Dx()*r.Dy() < 2 {
+			continue
+		}
+		sprite := r.Min.Y*16 + r.Min.X
+		metas = append(metas, Metasprite{
+			Name:   fmt.Sprintf("region_%03d_%dx%d", sprite, r.Dx(), r.Dy()),
+			Sprite: sprite,
+			W:      r.Dx(),
+			H:      r.Dy(),
+			X:      r.Min.X * 8,
+			Y:      r.Min.Y * 8,
+			Width:  r.Dx() * 8,
+			Height: r.Dy() * 8,
+			Source: "region",
+		})
+	}
+	return metas
+}
+
+// mergeOverlappingRects unions tile rectangles until none of them overlap
+func mergeOverlappingRects(rects []image.Rectangle) []image.Rectangle {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(rects) && !merged; i++ {
+			for j := i + 1; j < len(rects); j++ {
+				if rects[i].Overlaps(rects[j]) {
+					rects[i] = rects[i].Union(rects[j])
+					rects = append(rects[:j], rects[j+1:]...)
+					merged = true
+					break
+				}
+			}
+		}
+	}
+	return rects
+}
+
+// findCodeMetasprites collects multi-tile spr(n,x,y,w,h) and sspr(sx,sy,sw,sh,...)
+// calls whose sprite arguments are number literals
+func findCodeMetasprites(code []string, useSection3, useSection4 bool) []Metasprite {
+	var metas []Metasprite
+	fits := func(x, y, w, h int) bool {
+		if x < 0 || y < 0 || w < 1 || h < 1 || x+w > 128 || y+h > 128 {
+			return false
+		}
+		lastID := ((y+h-1)/8)*16 + (x+w-1)/8
+		return spriteAvailable(lastID, useSection3, useSection4)
+	}
+
+	for _, call := range findLuaCalls(code, "spr") {
+		if len(call.Args) < 5 {
+			continue
+		}
+		n, okN := parseLuaInt(call.Args[0])
+		w, okW := parseLuaInt(call.Args[3])
+		h, okH := parseLuaInt(call.Args[4])
+		if !okN || !okW || !okH || w*h < 2 || !fits((n%16)*8, (n/16)*8, w*8, h*8) {
+			continue
+		}
+		metas = append(metas, Metasprite{
+			Name:   fmt.Sprintf("spr_%03d_%dx%d", n, w, h),
+			Sprite: n,
+			W:      w,
+			H:      h,
+			X:      (n % 16) * 8,
+			Y:      (n / 16) * 8,
+			Width:  w * 8,
+			Height: h * 8,
+			Source: "spr",
+			Line:   call.Line,
+		})
+	}
+
+	for _, call := range findLuaCalls(code, "sspr") {
+		if len(call.Args) < 4 {
+			continue
+		}
+		var rect [4]int
+		valid := true
+		for i := range rect {
+			v, ok := parseLuaInt(call.Args[i])
+			rect[i] = v
+			valid = valid && ok
+		}
+		x, y, w, h := rect[0], rect[1], rect[2], rect[3]
+		if !valid || !fits(x, y, w, h) || (w <= 8 && h <= 8) {
+			continue
+		}
+		metas = append(metas, Metasprite{
+			Name:   fmt.Sprintf("sspr_%d_%d_%dx%d", x, y, w, h),
+			Sprite: (y/8)*16 + x/8,
+			W:      (x+w+7)/8 - x/8,
+			H:      (y+h+7)/8 - y/8,
+			X:      x,
+			Y:      y,
+			Width:  w,
+			Height: h,
+			Source: "sspr",
+			Line:   call.Line,
+		})
+	}
+	return metas
+}
+
+// appendUnique adds metasprites whose pixel bounds are not already present
+func appendUnique(metas, extra []Metasprite) []Metasprite {
+	for _, e := range extra {
+		duplicate := false
+		for _, m := range metas {
+			if m.X == e.X && m.Y == e.Y && m.Width == e.Width && m.Height == e.Height {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			metas = append(metas, e)
+		}
+	}
+	return metas
+}
+
+// cropImage copies a rectangle of src into a new image at the origin
+func cropImage(src *image.RGBA, r image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			dst.Set(x, y, src.At(r.Min.X+x, r.Min.Y+y))
+		}
+	}
+	return dst
+}
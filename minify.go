@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// callbacks are the globals PICO-8 itself calls by name
+var callbacks = []string{"_init", "_update", "_update60", "_draw"}
+
+// codeSize is what PICO-8 measures of a cart's code
+type codeSize struct {
+	Tokens, Chars, Compressed int
+}
+
+// measureCode lexes code and measures it against PICO-8's limits
+func measureCode(code string) (codeSize, error) {
+	tokens, err := lua.Lex(code)
+	if err != nil {
+		return codeSize{}, err
+	}
+	return codeSize{
+		Tokens:     lua.CountTokens(tokens),
+		Chars:      codeChars(code),
+		Compressed: len(pxaCompress(p8sciiBytes(code))),
+	}, nil
+}
+
+// apiNames lists the globals the runtime defines, so that a cart redefining
+// one of them keeps the name
+func apiNames() []string {
+	m := newMachine(nil)
+	var names []string
+	for k, _ := m.in.Globals.Next(nil); k != nil; k, _ = m.in.Globals.Next(k) {
+		if name, ok := k.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// runMinify implements the "minify" subcommand
+func runMinify(args []string) {
+	fs := flag.NewFlagSet("minify", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	outPath := fs.String("out", "", "Where to write the minified cart (default <cart>.min.p8)")
+	globals := fs.Bool("globals", false, "Also rename globals the cart defines")
+	fields := fs.Bool("fields", false, "Also rename table fields")
+	var preserve stringList
+	fs.Var(&preserve, "preserve", "Global or field names to keep, comma separated (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 minify --cart <file.p8> [--out <file.p8>] [--globals] [--fields] [--preserve a,b]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Shrinks the code to fewer tokens and characters and writes it into a copy of the cart.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "--globals and --fields can break code that builds names at runtime: t[k] with")
+		fmt.Fprintln(os.Stderr, "k=\"sp\"..\"eed\" or pairs() printing keys still sees the old names. Fields the")
+		fmt.Fprintln(os.Stderr, "code visibly reaches that way keep their names, the rest get a warning; add")
+		fmt.Fprintln(os.Stderr, "anything else to --preserve.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	path := requireCart(fs, &cartOptions{path: *cartPath})
+	program := loadProgram(path)
+
+	source := program.Source()
+	before, err := measureCode(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", locateError(program, err))
+		os.Exit(1)
+	}
+	block, err := lua.Parse(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", locateError(program, err))
+		os.Exit(1)
+	}
+
+	opts := lua.MinifyOptions{RenameGlobals: *globals, RenameFields: *fields, Preserve: make(map[string]bool)}
+	for _, name := range append(callbacks, apiNames()...) {
+		opts.Preserve[name] = true
+	}
+	for _, list := range preserve {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.Preserve[name] = true
+			}
+		}
+	}
+	code, warnings := lua.Minify(block, opts)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	// A minified program that doesn't parse is a bug here, not in the cart
+	after, err := measureCode(code)
+	if err == nil {
+		_, err = lua.Parse(code)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: minified code is invalid: %v\n", err)
+		os.Exit(1)
+	}
+
+	cart, err := readCartFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	cart.setSection("__lua__", strings.Split(code, "\n"))
+	target := *outPath
+	if target == "" {
+		target = strings.TrimSuffix(path, filepath.Ext(path)) + ".min.p8"
+	}
+	if err := os.WriteFile(target, []byte(cart.String()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", target, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%-12s %8s %8s %8s\n", "", "before", "after", "limit")
+	row := func(name string, before, after, limit int) {
+		fmt.Printf("%-12s %8d %8d %8d  (%+.0f%%)\n", name, before, after, limit, 100*float64(after-before)/float64(max(before, 1)))
+	}
+	row("tokens", before.Tokens, after.Tokens, tokenLimit)
+	row("chars", before.Chars, after.Chars, charLimit)
+	row("compressed", before.Compressed, after.Compressed, compressedLimit)
+	fmt.Printf("Wrote %s\n", target)
+}
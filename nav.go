@@ -0,0 +1,395 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NavGraph is the nav.json output: walkable tiles and the moves between them
+type NavGraph struct {
+	Version     string    `json:"version"`
+	Description string    `json:"description"`
+	Mode        string    `json:"mode"` // "4", "8" or "platformer"
+	SolidFlag   int       `json:"solidFlag"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Nodes       []NavNode `json:"nodes"`
+	Edges       []NavEdge `json:"edges"`
+
+	index map[[2]int]int // tile -> node ID
+	out   [][]int        // node ID -> indices into Edges
+}
+
+// NavNode is a tile an agent can occupy
+type NavNode struct {
+	ID int `json:"id"`
+	X  int `json:"x"`
+	Y  int `json:"y"`
+}
+
+// NavEdge is a directed move between two nodes
+type NavEdge struct {
+	From int     `json:"from"`
+	To   int     `json:"to"`
+	Cost float64 `json:"cost"`
+	Kind string  `json:"kind"` // walk, diagonal, fall or jump
+}
+
+// navOptions configures how the graph is built
+type navOptions struct {
+	solidFlag  int
+	connect    int
+	platformer bool
+	jumpHeight int
+	jumpWidth  int
+}
+
+// addNavFlags registers the graph options shared by nav and path
+func addNavFlags(fs *flag.FlagSet) *navOptions {
+	opts := &navOptions{}
+	fs.IntVar(&opts.solidFlag, "solid", 0, "Sprite flag bit that marks a tile as solid")
+	fs.IntVar(&opts.connect, "connect", 4, "Neighborhood for top-down graphs: 4 or 8")
+	fs.BoolVar(&opts.platformer, "platformer", false, "Build a side-view graph of standable tiles with walk, fall and jump edges")
+	fs.IntVar(&opts.jumpHeight, "jump-height", 2, "Maximum jump height in tiles (platformer)")
+	fs.IntVar(&opts.jumpWidth, "jump-width", 3, "Maximum jump distance in tiles (platformer)")
+	return opts
+}
+
+// loadNavGraph parses the cart and builds its navigation graph, exiting on error
+func loadNavGraph(fs *flag.FlagSet, cart *cartOptions, nav *navOptions) *NavGraph {
+	cartPath := requireCart(fs, cart)
+	if nav.connect != 4 && nav.connect != 8 {
+		fmt.Fprintln(os.Stderr, "Error: --connect must be 4 or 8")
+		os.Exit(1)
+	}
+	if nav.solidFlag < 0 || nav.solidFlag > 7 {
+		fmt.Fprintln(os.Stderr, "Error: --solid must be a flag bit between 0 and 7")
+		os.Exit(1)
+	}
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	mapData := parseSection(cartPath, "__map__")
+	if len(mapData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __map__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	mapSheet, err := generateMapJSON(mapData, gfxData, cart.useSection3, cart.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
+		os.Exit(1)
+	}
+	solid := flagMask(mapGrid(mapSheet), parseFlagSection(cartPath), 1<<nav.solidFlag)
+	return buildNavGraph(solid, nav)
+}
+
+// runNav implements the "nav" subcommand
+func runNav(args []string) {
+	fs := flag.NewFlagSet("nav", flag.ExitOnError)
+	cart := addCartFlags(fs)
+	nav := addNavFlags(fs)
+	_ = fs.Parse(args)
+
+	graph := loadNavGraph(fs, cart, nav)
+
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling nav JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("nav.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving nav.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated nav.json")
+
+	if err := os.WriteFile("nav.dot", []byte(navGraphDOT(graph)), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving nav.dot: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated nav.dot")
+	fmt.Printf("%d nodes, %d edges\n", len(graph.Nodes), len(graph.Edges))
+}
+
+// runPath implements the "path" subcommand
+func runPath(args []string) {
+	fs := flag.NewFlagSet("path", flag.ExitOnError)
+	cart := addCartFlags(fs)
+	nav := addNavFlags(fs)
+	fromSpec := fs.String("from", "", "Start tile as x,y")
+	toSpec := fs.String("to", "", "Goal tile as x,y")
+	_ = fs.Parse(args)
+
+	from, errFrom := parseTile(*fromSpec)
+	to, errTo := parseTile(*toSpec)
+	if errFrom != nil || errTo != nil {
+		fmt.Fprintln(os.Stderr, "Error: --from and --to must be tile coordinates like 3,14")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	graph := loadNavGraph(fs, cart, nav)
+	path, cost, err := graph.shortestPath(from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No path: %v\n", err)
+		os.Exit(1)
+	}
+
+	steps := make([]string, len(path))
+	for i, node := range path {
+		steps[i] = fmt.Sprintf("(%d,%d)", node.X, node.Y)
+	}
+	fmt.Println(strings.Join(steps, " -> "))
+	fmt.Printf("%d steps, cost %.2f\n", len(path)-1, cost)
+}
+
+// parseTile parses "x,y" tile coordinates
+func parseTile(spec string) ([2]int, error) {
+	xs, ys, ok := strings.Cut(spec, ",")
+	if !ok {
+		return [2]int{}, fmt.Errorf("expected x,y, got %q", spec)
+	}
+	x, errX := strconv.Atoi(strings.TrimSpace(xs))
+	y, errY := strconv.Atoi(strings.TrimSpace(ys))
+	if errX != nil || errY != nil {
+		return [2]int{}, fmt.Errorf("invalid tile %q", spec)
+	}
+	return [2]int{x, y}, nil
+}
+
+// buildNavGraph turns a solid mask into a top-down or platformer graph
+func buildNavGraph(solid [][]bool, opts *navOptions) *NavGraph {
+	height, width := len(solid), len(solid[0])
+	graph := &NavGraph{
+		Version:     "1.0",
+		Description: "PICO-8 map navigation graph",
+		Mode:        strconv.Itoa(opts.connect),
+		SolidFlag:   opts.solidFlag,
+		Width:       width,
+		Height:      height,
+		Nodes:       make([]NavNode, 0),
+		Edges:       make([]NavEdge, 0),
+		index:       make(map[[2]int]int),
+	}
+	if opts.platformer {
+		graph.Mode = "platformer"
+	}
+
+	// Tiles outside the map count as solid
+	open := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < width && y < height && !solid[y][x]
+	}
+	standable := func(x, y int) bool {
+		return open(x, y) && y+1 < height && solid[y+1][x]
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if open(x, y) && (!opts.platformer || standable(x, y)) {
+				graph.index[[2]int{x, y}] = len(graph.Nodes)
+				graph.Nodes = append(graph.Nodes, NavNode{ID: len(graph.Nodes), X: x, Y: y})
+			}
+		}
+	}
+
+	for _, node := range graph.Nodes {
+		if opts.platformer {
+			graph.addPlatformerEdges(node, open, standable, opts)
+		} else {
+			graph.addGridEdges(node, open, opts.connect)
+		}
+	}
+	return graph
+}
+
+// addEdge links two tiles that are both nodes
+func (g *NavGraph) addEdge(from NavNode, toX, toY int, cost float64, kind string) {
+	to, ok := g.index[[2]int{toX, toY}]
+	if !ok {
+		return
+	}
+	g.Edges = append(g.Edges, NavEdge{From: from.ID, To: to, Cost: cost, Kind: kind})
+}
+
+// addGridEdges connects a node to its open neighbors; diagonals may not cut corners
+func (g *NavGraph) addGridEdges(node NavNode, open func(x, y int) bool, connect int) {
+	x, y := node.X, node.Y
+	for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		if open(x+d[0], y+d[1]) {
+			g.addEdge(node, x+d[0], y+d[1], 1, "walk")
+		}
+	}
+	if connect != 8 {
+		return
+	}
+	for _, d := range [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}} {
+		if open(x+d[0], y+d[1]) && open(x+d[0], y) && open(x, y+d[1]) {
+			g.addEdge(node, x+d[0], y+d[1], math.Sqrt2, "diagonal")
+		}
+	}
+}
+
+// addPlatformerEdges adds walking to a neighboring ledge, falling off one, and
+// jumping. A jump is approximated as rising straight up to one tile above the
+// higher end, moving across, then falling onto the target, and it is only
+// allowed when that whole path is open and the climb from the start up to the
+// higher end fits in the jump height; the extra tile is headroom for the arc.
+// So --jump-height 1 steps up onto a ledge one tile higher.
+func (g *NavGraph) addPlatformerEdges(node NavNode, open, standable func(x, y int) bool, opts *navOptions) {
+	x, y := node.X, node.Y
+	reachable := make(map[[2]int]bool)
+
+	for _, dx := range []int{-1, 1} {
+		nx := x + dx
+		switch {
+		case standable(nx, y):
+			g.addEdge(node, nx, y, 1, "walk")
+			reachable[[2]int{nx, y}] = true
+		case open(nx, y):
+			// Step off the ledge and let gravity take over
+			ny := y
+			for open(nx, ny) && !standable(nx, ny) {
+				ny++
+			}
+			if standable(nx, ny) {
+				g.addEdge(node, nx, ny, float64(1+ny-y), "fall")
+				reachable[[2]int{nx, ny}] = true
+			}
+		}
+	}
+
+	for tx := x - opts.jumpWidth; tx <= x+opts.jumpWidth; tx++ {
+		for ty := y - opts.jumpHeight; ty < g.Height; ty++ {
+			if (tx == x && ty >= y) || !standable(tx, ty) || reachable[[2]int{tx, ty}] {
+				continue
+			}
+			apex := min(y, ty) - 1
+			if y-min(y, ty) > opts.jumpHeight || !jumpClear(open, x, y, tx, ty, apex) {
+				continue
+			}
+			dx := tx - x
+			if dx < 0 {
+				dx = -dx
+			}
+			g.addEdge(node, tx, ty, float64(dx+(y-apex)+(ty-apex)), "jump")
+		}
+	}
+}
+
+// jumpClear checks the rise, traverse and fall path of a jump for solid tiles
+func jumpClear(open func(x, y int) bool, x, y, tx, ty, apex int) bool {
+	for yy := apex; yy <= y; yy++ {
+		if !open(x, yy) {
+			return false
+		}
+	}
+	step := 1
+	if tx < x {
+		step = -1
+	}
+	for xx := x; xx != tx; xx += step {
+		if !open(xx, apex) {
+			return false
+		}
+	}
+	for yy := apex; yy <= ty; yy++ {
+		if !open(tx, yy) {
+			return false
+		}
+	}
+	return true
+}
+
+// shortestPath runs Dijkstra between two tiles
+func (g *NavGraph) shortestPath(from, to [2]int) ([]NavNode, float64, error) {
+	start, ok := g.index[from]
+	if !ok {
+		return nil, 0, fmt.Errorf("start tile (%d,%d) is not walkable", from[0], from[1])
+	}
+	goal, ok := g.index[to]
+	if !ok {
+		return nil, 0, fmt.Errorf("goal tile (%d,%d) is not walkable", to[0], to[1])
+	}
+
+	if g.out == nil {
+		g.out = make([][]int, len(g.Nodes))
+		for i, edge := range g.Edges {
+			g.out[edge.From] = append(g.out[edge.From], i)
+		}
+	}
+
+	dist := make([]float64, len(g.Nodes))
+	prev := make([]int, len(g.Nodes))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+		prev[i] = -1
+	}
+	dist[start] = 0
+	queue := &navQueue{{node: start}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(navItem)
+		if item.node == goal {
+			break
+		}
+		if item.dist > dist[item.node] {
+			continue
+		}
+		for _, ei := range g.out[item.node] {
+			edge := g.Edges[ei]
+			if d := dist[item.node] + edge.Cost; d < dist[edge.To] {
+				dist[edge.To] = d
+				prev[edge.To] = item.node
+				heap.Push(queue, navItem{node: edge.To, dist: d})
+			}
+		}
+	}
+
+	if math.IsInf(dist[goal], 1) {
+		return nil, 0, fmt.Errorf("(%d,%d) cannot be reached from (%d,%d)", to[0], to[1], from[0], from[1])
+	}
+	var path []NavNode
+	for n := goal; n != -1; n = prev[n] {
+		path = append([]NavNode{g.Nodes[n]}, path...)
+	}
+	return path, dist[goal], nil
+}
+
+// navItem is a queued node with its tentative distance
+type navItem struct {
+	node int
+	dist float64
+}
+
+// navQueue is a min-heap of navItems
+type navQueue []navItem
+
+func (q navQueue) Len() int           { return len(q) }
+func (q navQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q navQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *navQueue) Push(x any)        { *q = append(*q, x.(navItem)) }
+func (q *navQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// navGraphDOT renders the graph for Graphviz; positions are pinned to the tile grid for neato
+func navGraphDOT(g *NavGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph nav {\n")
+	b.WriteString("  node [shape=point];\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  n%d [label=\"%d,%d\" pos=\"%d,%d!\"];\n", node.ID, node.X, node.Y, node.X, -node.Y)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  n%d -> n%d [label=%q];\n", edge.From, edge.To, edge.Kind)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
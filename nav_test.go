@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// solidMask turns rows of '#' (solid) and '.' (open) into a solid mask
+func solidMask(rows ...string) [][]bool {
+	solid := make([][]bool, len(rows))
+	for y, row := range rows {
+		solid[y] = make([]bool, len(row))
+		for x, c := range row {
+			solid[y][x] = c == '#'
+		}
+	}
+	return solid
+}
+
+// jumpEdges lists a graph's jump edges as "x,y->x,y", sorted
+func jumpEdges(g *NavGraph) []string {
+	var jumps []string
+	for _, edge := range g.Edges {
+		if edge.Kind == "jump" {
+			from, to := g.Nodes[edge.From], g.Nodes[edge.To]
+			jumps = append(jumps, fmt.Sprintf("%d,%d->%d,%d", from.X, from.Y, to.X, to.Y))
+		}
+	}
+	slices.Sort(jumps)
+	return jumps
+}
+
+func TestPlatformerJumps(t *testing.T) {
+	step := solidMask(
+		".....",
+		".....",
+		"...##",
+		"#####",
+	)
+	ledge := solidMask(
+		"...",
+		"...",
+		".##",
+		".##",
+		"###",
+	)
+	ceiling := solidMask(
+		"#####",
+		".....",
+		"...##",
+		"#####",
+	)
+	gap := solidMask(
+		".....",
+		".....",
+		"##.##",
+	)
+	tests := []struct {
+		name       string
+		solid      [][]bool
+		jumpHeight int
+		jumpWidth  int
+		want       []string
+	}{
+		{"step up one tile with height 0", step, 0, 1, nil},
+		{"step up one tile with height 1", step, 1, 1, []string{"2,2->3,1"}},
+		{"two-tile ledge with height 1", ledge, 1, 1, nil},
+		{"two-tile ledge with height 2", ledge, 2, 1, []string{"0,3->1,1"}},
+		{"no headroom under a ceiling", ceiling, 1, 1, nil},
+		{"gap on the same level", gap, 0, 2, []string{"1,1->3,1", "3,1->1,1"}},
+		{"gap too wide", gap, 0, 1, nil},
+	}
+	for _, tt := range tests {
+		g := buildNavGraph(tt.solid, &navOptions{connect: 4, platformer: true, jumpHeight: tt.jumpHeight, jumpWidth: tt.jumpWidth})
+		if got := jumpEdges(g); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: jumps %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+)
+
+// runPreview implements the "preview" subcommand
+func runPreview(args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	sprite := fs.Int("sprite", -1, "Show a single sprite instead of the sheet")
+	showMap := fs.Bool("map", false, "Show a region of the map instead of the sheet")
+	x := fs.Int("x", 0, "With --map, left edge of the region in tiles")
+	y := fs.Int("y", 0, "With --map, top edge of the region in tiles")
+	w := fs.Int("w", 16, "With --map, width of the region in tiles")
+	h := fs.Int("h", 16, "With --map, height of the region in tiles")
+	mode := fs.String("mode", "auto", "Output: auto, truecolor, 256, sixel or kitty")
+	scale := fs.Int("scale", 0, "Integer scale factor (default 1 for text output, 4 for sixel and kitty)")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	gfxData := parseSection(cartPath, "__gfx__")
+	if len(gfxData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	spriteSheet := reconstructImage(gfxData)
+
+	img := spriteSheet
+	switch {
+	case *showMap:
+		mapData := parseSection(cartPath, "__map__")
+		if len(mapData) == 0 {
+			fmt.Fprintln(os.Stderr, "No __map__ section found in cart. Exiting.")
+			os.Exit(1)
+		}
+		mapImage := renderCartMap(mapData, gfxData, spriteSheet, opts.useSection3, opts.useSection4)
+		region := image.Rect(*x*8, *y*8, (*x+*w)*8, (*y+*h)*8).Intersect(mapImage.Bounds())
+		if region.Empty() {
+			fmt.Fprintln(os.Stderr, "Error: the region is outside the map")
+			os.Exit(1)
+		}
+		img = cropImage(mapImage, region)
+	case *sprite >= 0:
+		if *sprite > 255 {
+			fmt.Fprintln(os.Stderr, "Error: --sprite must be 0..255")
+			os.Exit(1)
+		}
+		img = cropImage(spriteSheet, image.Rect((*sprite%16)*8, (*sprite/16)*8, (*sprite%16)*8+8, (*sprite/16)*8+8))
+	}
+
+	if *mode == "auto" {
+		*mode = detectTerminalGraphics()
+	}
+	if *scale < 1 {
+		*scale = 1
+		if *mode == "sixel" || *mode == "kitty" {
+			*scale = 4
+		}
+	}
+	img = scaleImage(img, *scale)
+
+	switch *mode {
+	case "truecolor", "256":
+		fmt.Print(halfBlockText(img, *mode == "truecolor"))
+	case "sixel":
+		fmt.Print(sixelImage(img))
+	case "kitty":
+		out, err := kittyImage(img)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding image: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(out)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --mode %q\n", *mode)
+		os.Exit(1)
+	}
+}
+
+// detectTerminalGraphics picks an output mode from the environment. Sixel support
+// cannot be read from the environment reliably, so it is only used when asked for.
+func detectTerminalGraphics() string {
+	term := os.Getenv("TERM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(term, "kitty"):
+		return "kitty"
+	case os.Getenv("COLORTERM") == "truecolor" || os.Getenv("COLORTERM") == "24bit":
+		return "truecolor"
+	}
+	return "256"
+}
+
+// halfBlockText draws two pixel rows per line with "▀": the foreground is the
+// upper pixel and the background the lower one
+func halfBlockText(img *image.RGBA, trueColor bool) string {
+	b := img.Bounds()
+	var out strings.Builder
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			top := img.RGBAAt(x, y)
+			bottom := top
+			if y+1 < b.Max.Y {
+				bottom = img.RGBAAt(x, y+1)
+			}
+			if trueColor {
+				fmt.Fprintf(&out, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+			} else {
+				fmt.Fprintf(&out, "\x1b[38;5;%dm\x1b[48;5;%dm▀", xterm256(top), xterm256(bottom))
+			}
+		}
+		out.WriteString("\x1b[0m\n")
+	}
+	return out.String()
+}
+
+// xterm256 approximates a color with the nearest entry of the xterm 6x6x6 color
+// cube or grayscale ramp
+func xterm256(c color.RGBA) int {
+	levels := []int{0, 95, 135, 175, 215, 255}
+	nearestLevel := func(v uint8) int {
+		best := 0
+		for i, level := range levels {
+			if abs(int(v)-level) < abs(int(v)-levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	distance := func(r, g, b int) int {
+		dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+		return dr*dr + dg*dg + db*db
+	}
+
+	r, g, b := nearestLevel(c.R), nearestLevel(c.G), nearestLevel(c.B)
+	best := 16 + 36*r + 6*g + b
+	bestDistance := distance(levels[r], levels[g], levels[b])
+	for i := 0; i < 24; i++ {
+		gray := 8 + 10*i
+		if d := distance(gray, gray, gray); d < bestDistance {
+			best, bestDistance = 232+i, d
+		}
+	}
+	return best
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// sixelImage encodes the image with the PICO-8 palette as a DEC sixel sequence
+func sixelImage(img *image.RGBA) string {
+	b := img.Bounds()
+	index := make(map[color.RGBA]int, len(pico8Palette))
+	var out strings.Builder
+	out.WriteString("\x1bPq")
+	fmt.Fprintf(&out, "\"1;1;%d;%d", b.Dx(), b.Dy())
+	for i, c := range pico8Palette {
+		index[c] = i
+		fmt.Fprintf(&out, "#%d;2;%d;%d;%d", i, int(c.R)*100/255, int(c.G)*100/255, int(c.B)*100/255)
+	}
+
+	// Each sixel row covers six pixel rows; every color gets its own pass over it
+	for y0 := b.Min.Y; y0 < b.Max.Y; y0 += 6 {
+		for i := range pico8Palette {
+			var band strings.Builder
+			used := false
+			for x := b.Min.X; x < b.Max.X; x++ {
+				bits := 0
+				for dy := 0; dy < 6 && y0+dy < b.Max.Y; dy++ {
+					if index[img.RGBAAt(x, y0+dy)] == i {
+						bits |= 1 << dy
+					}
+				}
+				used = used || bits != 0
+				band.WriteByte(byte(63 + bits))
+			}
+			if used {
+				fmt.Fprintf(&out, "#%d%s$", i, band.String())
+			}
+		}
+		out.WriteString("-")
+	}
+	out.WriteString("\x1b\\\n")
+	return out.String()
+}
+
+// kittyImage sends the image as a PNG with the kitty graphics protocol, in the
+// 4096 byte chunks the protocol requires
+func kittyImage(img *image.RGBA) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var out strings.Builder
+	for first := true; len(data) > 0; first = false {
+		chunk := data[:min(4096, len(data))]
+		data = data[len(chunk):]
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&out, "\x1b_Gf=100,a=T,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(&out, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	out.WriteString("\n")
+	return out.String(), nil
+}
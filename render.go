@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// buttonNames maps the words an input script may use to button numbers
+var buttonNames = map[string]int{"left": 0, "right": 1, "up": 2, "down": 3, "o": 4, "z": 4, "x": 5}
+
+// runRender implements the "render" subcommand: it runs the cart's Lua code
+// headlessly and saves the frames it draws
+func runRender(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	cartPath := fs.String("cart", "", "Path to the PICO-8 cartridge file (.p8)")
+	frames := fs.Int("frames", 60, "Number of frames to render")
+	inputPath := fs.String("input", "", "Button script: lines of \"<frame>[-<frame>] <buttons...>\"")
+	outDir := fs.String("out", "", "Directory for frame_NNN.png files")
+	gifPath := fs.String("gif", "", "Write the frames as an animated GIF")
+	scale := fs.Int("scale", 1, "Upscale factor for the output")
+	steps := fs.Int("steps", 1000000, "Step budget per frame (statements, loop iterations and calls) before the cart is considered stuck (0 = no limit)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: parsepico8 render --cart <file.p8> [--frames 60] [--input <script>] [--out <dir>] [--gif <file.gif>]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Runs _init/_update/_draw without a display and saves the frames it draws.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	cart := requireCart(fs, &cartOptions{path: *cartPath})
+
+	if *outDir == "" && *gifPath == "" {
+		*outDir = "frames"
+	}
+	if *scale < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --scale must be at least 1")
+		os.Exit(1)
+	}
+
+	var input map[int]byte
+	if *inputPath != "" {
+		var err error
+		if input, err = loadInputScript(*inputPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input script: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	sections := make(map[string][]string)
+	for _, name := range []string{"__gfx__", "__gff__", "__map__", "__sfx__", "__music__"} {
+		sections[name] = parseSection(cart, name)
+	}
+	m := newMachine(sections)
+	m.in.MaxSteps = *steps
+
+	program := loadProgram(cart)
+	images, err := m.run(program.Source(), *frames, input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error running cart: %v\n", locateError(program, err))
+		if len(images) == 0 {
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Saving the %d frames rendered before the error\n", len(images))
+	}
+
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+			os.Exit(1)
+		}
+		for i, img := range images {
+			path := filepath.Join(*outDir, fmt.Sprintf("frame_%03d.png", i+1))
+			if err := saveAsPng(scalePaletted(img, *scale), path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", path, err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Saved %d frames to %s\n", len(images), *outDir)
+	}
+	if *gifPath != "" {
+		if err := saveRenderGIF(images, *scale, m.fps, *gifPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving GIF: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %d frames to %s\n", len(images), *gifPath)
+	}
+}
+
+// run executes the cart and captures up to n frames. Carts with _draw get the
+// usual _init, then _update (or _update60) and _draw once per frame; carts that
+// run their own loop get a frame captured at every flip().
+func (m *machine) run(src string, n int, input map[int]byte) ([]*image.Paletted, error) {
+	chunk, err := m.in.Load(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*image.Paletted
+	setInput := func() {
+		m.frame++
+		m.prevHeld, m.held = m.held, input[m.frame]
+		m.in.ResetSteps()
+	}
+
+	m.mainLoop = lua.NewCoroutine(chunk)
+	setInput()
+	if _, err := m.in.Resume(m.mainLoop, nil); err != nil {
+		return nil, err
+	}
+	for m.mainLoop.Status() != "dead" && len(images) < n {
+		images = append(images, m.frameImage())
+		setInput()
+		if _, err := m.in.Resume(m.mainLoop, nil); err != nil {
+			return images, err
+		}
+	}
+	if len(images) > 0 {
+		return images, nil
+	}
+
+	g := m.in.Globals
+	update := g.Get("_update")
+	if u := g.Get("_update60"); u != nil {
+		update, m.fps = u, 60
+	}
+	draw := g.Get("_draw")
+	if init := g.Get("_init"); init != nil {
+		if _, err := m.in.Call(init); err != nil {
+			return nil, err
+		}
+	}
+	if update == nil && draw == nil {
+		// A cart without a game loop draws once while loading
+		return []*image.Paletted{m.frameImage()}, nil
+	}
+	for len(images) < n {
+		if len(images) > 0 {
+			setInput()
+		}
+		for _, fn := range []lua.Value{update, draw} {
+			if fn == nil {
+				continue
+			}
+			if _, err := m.in.Call(fn); err != nil {
+				return images, err
+			}
+		}
+		images = append(images, m.frameImage())
+	}
+	return images, nil
+}
+
+// loadInputScript reads which buttons are held on which frames. Each line is a
+// frame number or an inclusive range followed by buttons, by name (left, right,
+// up, down, o, x) or number; frames are counted from 1 and # starts a comment.
+func loadInputScript(path string) (map[int]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "error closing file %s: %v\n", path, cerr)
+		}
+	}()
+
+	held := make(map[int]byte)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(fields[0], "-")
+		if !isRange {
+			hi = lo
+		}
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("line %d: invalid frame range %q", lineNo, fields[0])
+		}
+		var mask byte
+		for _, name := range fields[1:] {
+			b, ok := buttonNames[strings.ToLower(name)]
+			if !ok {
+				n, err := strconv.Atoi(name)
+				if err != nil || n < 0 || n > 5 {
+					return nil, fmt.Errorf("line %d: unknown button %q", lineNo, name)
+				}
+				b = n
+			}
+			mask |= 1 << b
+		}
+		for frame := start; frame <= end; frame++ {
+			held[frame] |= mask
+		}
+	}
+	return held, scanner.Err()
+}
+
+// saveRenderGIF writes rendered frames as a looping GIF at the cart's frame rate
+func saveRenderGIF(images []*image.Paletted, scale, fps int, path string) error {
+	delay := 3 // GIF delays are in 1/100s, so 30fps is as close as 3
+	if fps == 60 {
+		delay = 2
+	}
+	out := &gif.GIF{}
+	for _, img := range images {
+		out.Image = append(out.Image, scalePaletted(img, scale))
+		out.Delay = append(out.Delay, delay)
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return gif.EncodeAll(w, out)
+	})
+}
+
+// scalePaletted enlarges a frame with nearest-neighbor sampling
+func scalePaletted(img *image.Paletted, scale int) *image.Paletted {
+	if scale == 1 {
+		return img
+	}
+	b := img.Bounds()
+	out := image.NewPaletted(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale), img.Palette)
+	for y := 0; y < b.Dy()*scale; y++ {
+		for x := 0; x < b.Dx()*scale; x++ {
+			out.SetColorIndex(x, y, img.ColorIndexAt(x/scale, y/scale))
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// renderSrc runs a cart's code for up to n frames with a small step budget
+func renderSrc(src string, n int) (int, error) {
+	m := newMachine(map[string][]string{})
+	m.in.MaxSteps = 100000
+	images, err := m.run(src, n, nil)
+	return len(images), err
+}
+
+func TestRenderFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int
+	}{
+		{"game loop", "function _update() end function _draw() cls(1) end", 5},
+		{"draw only", "function _draw() cls(1) end", 5},
+		{"no loop", "cls(1) rectfill(0, 0, 10, 10, 8)", 1},
+		{"own loop with flip", "for i = 1, 3 do cls(i) flip() end", 3},
+		{"own loop running longer", "while true do cls(1) flip() end", 5},
+	}
+	for _, tt := range tests {
+		got, err := renderSrc(tt.src, 5)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: %d frames, %v; want %d frames", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenderStuckCarts(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		frames int // rendered before the error
+		want   string
+	}{
+		{"empty loop while loading", "while true do end", 0, "too many instructions"},
+		{"waiting for a button in _update", "n = 0 function _update() n += 1 if n == 3 then repeat until btnp(4) end end function _draw() end", 2, "too many instructions"},
+		{"busy loop in _draw", "function _draw() for i = 1, 32767 do for j = 1, 32767 do end end end", 0, "too many instructions"},
+		{"infinite recursion", "function f() return f() + 1 end function _draw() f() end", 0, "stack overflow"},
+		{"own loop stuck after two frames", "flip() flip() while true do end", 2, "too many instructions"},
+	}
+	for _, tt := range tests {
+		got, err := renderSrc(tt.src, 10)
+		if err == nil || !strings.Contains(err.Error(), tt.want) || got != tt.frames {
+			t.Errorf("%s: %d frames, %v; want %d frames and %q", tt.name, got, err, tt.frames, tt.want)
+		}
+	}
+}
+
+func TestRenderSteadyStateFitsBudget(t *testing.T) {
+	// The budget is per frame, so a long but bounded run never hits it
+	src := "function _update() for i = 1, 1000 do end end function _draw() cls() end"
+	if got, err := renderSrc(src, 200); err != nil || got != 200 {
+		t.Errorf("%d frames, %v; want 200 frames", got, err)
+	}
+}
+
+func TestRenderErrorsNameFileAndLine(t *testing.T) {
+	dir := t.TempDir()
+	cart := "pico-8 cartridge // http://www.pico-8.com\nversion 41\n__lua__\n-- main\n#include player.lua\nfunction _draw() update_player() end\n"
+	player := "-- player\n\nfunction update_player()\n x = nil + 1\nend\n"
+	if err := os.WriteFile(filepath.Join(dir, "game.p8"), []byte(cart), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "player.lua"), []byte(player), 0644); err != nil {
+		t.Fatal(err)
+	}
+	program, err := resolveProgram(filepath.Join(dir, "game.p8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMachine(map[string][]string{})
+	_, err = m.run(program.Source(), 1, nil)
+	want := "player.lua:4: attempt to perform arithmetic on a nil value"
+	if err == nil || locateError(program, err).Error() != want {
+		t.Errorf("error = %v; want %q", locateError(program, err), want)
+	}
+}
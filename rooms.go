@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+// RoomSheet is the rooms.json output
+type RoomSheet struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Mode        string `json:"mode"` // "grid" or "flood"
+	RoomWidth   int    `json:"roomWidth,omitempty"`
+	RoomHeight  int    `json:"roomHeight,omitempty"`
+	Rooms       []Room `json:"rooms"`
+}
+
+// Room is one screen or region of the map. In grid mode X and Y are the room's
+// column and row; in flood mode they are the tile coordinates of its top-left corner.
+type Room struct {
+	X        int      `json:"x"`
+	Y        int      `json:"y"`
+	Bounds   TileRect `json:"bounds"`
+	Tiles    [][]int  `json:"tiles"` // [y][x] sprite IDs inside the bounds
+	Filename string   `json:"filename"`
+}
+
+// TileRect is a rectangle measured in map tiles
+type TileRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// runRooms implements the "rooms" subcommand
+func runRooms(args []string) {
+	fs := flag.NewFlagSet("rooms", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	size := fs.String("size", "16x16", "Room size in tiles for grid mode, as WxH")
+	flood := fs.Bool("flood", false, "Split into regions of tiles separated by empty tiles instead of a fixed grid")
+	outDir := fs.String("out", "rooms", "Output directory for the room PNGs")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	roomW, roomH, err := parseSize(*size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing --size: %v\n", err)
+		os.Exit(1)
+	}
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	mapData := parseSection(cartPath, "__map__")
+	if len(mapData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __map__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	mapSheet, err := generateMapJSON(mapData, gfxData, opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
+		os.Exit(1)
+	}
+	grid := mapGrid(mapSheet)
+
+	sheet := &RoomSheet{
+		Version:     "1.0",
+		Description: "PICO-8 map rooms export",
+	}
+	if *flood {
+		sheet.Mode = "flood"
+		sheet.Rooms = floodFillRooms(grid)
+	} else {
+		sheet.Mode = "grid"
+		sheet.RoomWidth, sheet.RoomHeight = roomW, roomH
+		sheet.Rooms = gridRooms(grid, roomW, roomH)
+	}
+
+	mapImage := renderCartMap(mapData, gfxData, reconstructImage(gfxData), opts.useSection3, opts.useSection4)
+	for i := range sheet.Rooms {
+		room := &sheet.Rooms[i]
+		room.Filename = fmt.Sprintf("room_%d_%d.png", room.X, room.Y)
+		b := room.Bounds
+		crop := cropImage(mapImage, image.Rect(b.X*8, b.Y*8, (b.X+b.W)*8, (b.Y+b.H)*8))
+		path := filepath.Join(*outDir, room.Filename)
+		if err := saveAsPng(crop, path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Saved %d rooms into '%s' folder.\n", len(sheet.Rooms), *outDir)
+
+	data, err := json.MarshalIndent(sheet, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling rooms JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("rooms.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving rooms.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated rooms.json")
+}
+
+// gridRooms cuts the map into fixed-size rooms, skipping the fully empty ones
+func gridRooms(grid [][]int, roomW, roomH int) []Room {
+	rooms := make([]Room, 0)
+	height, width := len(grid), len(grid[0])
+	for ry := 0; ry*roomH < height; ry++ {
+		for rx := 0; rx*roomW < width; rx++ {
+			bounds := TileRect{X: rx * roomW, Y: ry * roomH, W: min(roomW, width-rx*roomW), H: min(roomH, height-ry*roomH)}
+			tiles := tilesIn(grid, bounds)
+			if tilesEmpty(tiles) {
+				continue
+			}
+			rooms = append(rooms, Room{X: rx, Y: ry, Bounds: bounds, Tiles: tiles})
+		}
+	}
+	return rooms
+}
+
+// floodFillRooms finds groups of 4-connected non-empty tiles and returns their bounding boxes
+func floodFillRooms(grid [][]int) []Room {
+	height, width := len(grid), len(grid[0])
+	seen := make([][]bool, height)
+	for y := range seen {
+		seen[y] = make([]bool, width)
+	}
+
+	rooms := make([]Room, 0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if seen[y][x] || grid[y][x] == 0 {
+				continue
+			}
+			bounds := image.Rect(x, y, x+1, y+1)
+			stack := []image.Point{{x, y}}
+			seen[y][x] = true
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				bounds = bounds.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+				for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					n := p.Add(d)
+					if n.X < 0 || n.Y < 0 || n.X >= width || n.Y >= height {
+						continue
+					}
+					if !seen[n.Y][n.X] && grid[n.Y][n.X] != 0 {
+						seen[n.Y][n.X] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+			rect := TileRect{X: bounds.Min.X, Y: bounds.Min.Y, W: bounds.Dx(), H: bounds.Dy()}
+			rooms = append(rooms, Room{X: rect.X, Y: rect.Y, Bounds: rect, Tiles: tilesIn(grid, rect)})
+		}
+	}
+	return rooms
+}
+
+// tilesIn copies the sprite IDs inside a rectangle of the grid
+func tilesIn(grid [][]int, r TileRect) [][]int {
+	tiles := make([][]int, r.H)
+	for y := range tiles {
+		tiles[y] = make([]int, r.W)
+		copy(tiles[y], grid[r.Y+y][r.X:r.X+r.W])
+	}
+	return tiles
+}
+
+// tilesEmpty reports whether every tile is sprite 0
+func tilesEmpty(tiles [][]int) bool {
+	for _, row := range tiles {
+		for _, id := range row {
+			if id != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
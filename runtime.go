@@ -0,0 +1,309 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"unicode/utf8"
+
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// pico8SecretPalette holds the extra colors 128..143 that pal(c, 128+i, 1) selects
+var pico8SecretPalette = []color.RGBA{
+	{41, 24, 20, 255}, {17, 29, 53, 255}, {66, 33, 54, 255}, {18, 83, 89, 255},
+	{116, 47, 41, 255}, {73, 51, 59, 255}, {162, 136, 121, 255}, {243, 239, 125, 255},
+	{190, 18, 80, 255}, {255, 108, 36, 255}, {168, 231, 46, 255}, {0, 181, 67, 255},
+	{6, 90, 181, 255}, {117, 70, 101, 255}, {255, 110, 89, 255}, {255, 157, 129, 255},
+}
+
+// screenPalette is the display palette for rendered frames: the 16 colors, then
+// the 16 secret ones
+func screenPalette() color.Palette {
+	palette := make(color.Palette, 0, 32)
+	for _, c := range pico8Palette {
+		palette = append(palette, c)
+	}
+	for _, c := range pico8SecretPalette {
+		palette = append(palette, c)
+	}
+	return palette
+}
+
+// machine is the headless PICO-8: the cart loaded into memory plus the bits of
+// state that don't live there
+type machine struct {
+	in       *lua.Interp
+	mainLoop *lua.Coroutine // the coroutine running a cart's own loop, which flip() yields
+	mem      *Memory
+	rom      *Memory // the cart as loaded, for reload()
+
+	lineX     int
+	lineY     int
+	lineValid bool
+
+	frame    int
+	fps      int
+	held     byte // buttons held this frame, bit i for btn(i)
+	prevHeld byte
+}
+
+// newMachine loads the cart into memory and installs the API
+func newMachine(sections map[string][]string) *machine {
+	m := &machine{in: lua.New(), fps: 30, mem: newMemory(sections), rom: newMemory(sections)}
+	m.resetDrawState()
+	m.registerAPI()
+	return m
+}
+
+// resetDrawState restores palettes, camera, clip and cursor to their power-on values
+func (m *machine) resetDrawState() {
+	m.resetPalette()
+	m.mem.Poke(memPen, 6)
+	m.setCamera(0, 0)
+	m.setClip(image.Rect(0, 0, 128, 128))
+	m.setCursor(0, 0)
+}
+
+// resetPalette is pal(): identity palettes with only color 0 transparent
+func (m *machine) resetPalette() {
+	for c := 0; c < 16; c++ {
+		m.mem.Poke(memDrawPal+c, byte(c))
+		m.mem.Poke(memScreenPal+c, byte(c))
+	}
+	m.setTransparent(0, true)
+}
+
+func (m *machine) pen() byte { return m.mem.Peek(memPen) & 15 }
+
+func (m *machine) transparent(c byte) bool { return m.mem.Peek(memDrawPal+int(c&15))&0x10 != 0 }
+
+func (m *machine) setTransparent(c byte, t bool) {
+	addr := memDrawPal + int(c&15)
+	if t {
+		m.mem.Poke(addr, m.mem.Peek(addr)|0x10)
+	} else {
+		m.mem.Poke(addr, m.mem.Peek(addr)&^0x10)
+	}
+}
+
+func (m *machine) camera() (int, int) {
+	return int(int16(m.mem.Peek2(memCamera))), int(int16(m.mem.Peek2(memCamera + 2)))
+}
+
+func (m *machine) setCamera(x, y int) {
+	m.mem.Poke2(memCamera, uint16(x))
+	m.mem.Poke2(memCamera+2, uint16(y))
+}
+
+func (m *machine) clip() image.Rectangle {
+	return image.Rect(int(m.mem.Peek(memClip)), int(m.mem.Peek(memClip+1)),
+		int(m.mem.Peek(memClip+2)), int(m.mem.Peek(memClip+3)))
+}
+
+func (m *machine) setClip(r image.Rectangle) {
+	r = r.Intersect(image.Rect(0, 0, 128, 128))
+	m.mem.Poke(memClip, byte(r.Min.X))
+	m.mem.Poke(memClip+1, byte(r.Min.Y))
+	m.mem.Poke(memClip+2, byte(r.Max.X))
+	m.mem.Poke(memClip+3, byte(r.Max.Y))
+}
+
+func (m *machine) cursor() (int, int) {
+	return int(m.mem.Peek(memCursor)), int(m.mem.Peek(memCursor + 1))
+}
+
+func (m *machine) setCursor(x, y int) {
+	m.mem.Poke(memCursor, byte(x))
+	m.mem.Poke(memCursor+1, byte(y))
+}
+
+// drawBounds is the clip rectangle in drawing coordinates, before the camera
+// moves them. Loops over pixels stay inside it, so huge shapes cost no more
+// than the screen.
+func (m *machine) drawBounds() image.Rectangle {
+	camX, camY := m.camera()
+	return m.clip().Add(image.Pt(camX, camY))
+}
+
+// plot draws one pixel through the camera, clip rectangle and draw palette
+func (m *machine) plot(x, y int, c byte) {
+	camX, camY := m.camera()
+	x, y = x-camX, y-camY
+	if image.Pt(x, y).In(m.clip()) {
+		m.mem.SetPixel(x, y, m.mem.Peek(memDrawPal+int(c&15))&15)
+	}
+}
+
+// blit draws a scaled, optionally flipped region of the sprite sheet
+func (m *machine) blit(sx, sy, sw, sh, dx, dy, dw, dh int, flipX, flipY bool) {
+	if dw <= 0 || dh <= 0 {
+		return
+	}
+	b := m.drawBounds()
+	for y := max(0, b.Min.Y-dy); y < min(dh, b.Max.Y-dy); y++ {
+		for x := max(0, b.Min.X-dx); x < min(dw, b.Max.X-dx); x++ {
+			px, py := x*sw/dw, y*sh/dh
+			if flipX {
+				px = sw - 1 - px
+			}
+			if flipY {
+				py = sh - 1 - py
+			}
+			px, py = sx+px, sy+py
+			if px < 0 || px >= 128 || py < 0 || py >= 128 {
+				continue
+			}
+			if c := m.mem.Sget(px, py); !m.transparent(c) {
+				m.plot(dx+x, dy+y, c)
+			}
+		}
+	}
+}
+
+func (m *machine) rectFill(x0, y0, x1, y1 int, c byte) {
+	b := m.drawBounds()
+	x0, x1 = max(min(x0, x1), b.Min.X), min(max(x0, x1), b.Max.X-1)
+	y0, y1 = max(min(y0, y1), b.Min.Y), min(max(y0, y1), b.Max.Y-1)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			m.plot(x, y, c)
+		}
+	}
+}
+
+func (m *machine) line(x0, y0, x1, y1 int, c byte) {
+	m.lineX, m.lineY, m.lineValid = x1, y1, true
+	b := m.drawBounds()
+	if max(x0, x1) < b.Min.X || min(x0, x1) >= b.Max.X || max(y0, y1) < b.Min.Y || min(y0, y1) >= b.Max.Y {
+		return // nothing of it is visible
+	}
+	// Otherwise every step is walked, but coordinates are 16 bit, so that is
+	// at most about 65536 of them
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		m.plot(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			break
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// circle draws a circle outline or disc with the midpoint algorithm
+func (m *machine) circle(cx, cy, r int, c byte, fill bool) {
+	if r < 0 {
+		return
+	}
+	x, y, d := r, 0, 1-r
+	for x >= y {
+		if fill {
+			m.rectFill(cx-x, cy+y, cx+x, cy+y, c)
+			m.rectFill(cx-x, cy-y, cx+x, cy-y, c)
+			m.rectFill(cx-y, cy+x, cx+y, cy+x, c)
+			m.rectFill(cx-y, cy-x, cx+y, cy-x, c)
+		} else {
+			for _, p := range [][2]int{{x, y}, {y, x}, {-y, x}, {-x, y}, {-x, -y}, {-y, -x}, {y, -x}, {x, -y}} {
+				m.plot(cx+p[0], cy+p[1], c)
+			}
+		}
+		y++
+		if d < 0 {
+			d += 2*y + 1
+		} else {
+			x--
+			d += 2*(y-x) + 1
+		}
+	}
+}
+
+// oval draws the ellipse inscribed in a rectangle
+func (m *machine) oval(x0, y0, x1, y1 int, c byte, fill bool) {
+	x0, x1 = min(x0, x1), max(x0, x1)
+	y0, y1 = min(y0, y1), max(y0, y1)
+	cx, cy := float64(x0+x1)/2, float64(y0+y1)/2
+	rx, ry := float64(x1-x0)/2+0.5, float64(y1-y0)/2+0.5
+	inside := func(x, y int) bool {
+		dx, dy := (float64(x)-cx)/rx, (float64(y)-cy)/ry
+		return dx*dx+dy*dy <= 1
+	}
+	b := m.drawBounds()
+	for y := max(y0, b.Min.Y); y <= min(y1, b.Max.Y-1); y++ {
+		for x := max(x0, b.Min.X); x <= min(x1, b.Max.X-1); x++ {
+			if !inside(x, y) {
+				continue
+			}
+			if fill || !inside(x-1, y) || !inside(x+1, y) || !inside(x, y-1) || !inside(x, y+1) {
+				m.plot(x, y, c)
+			}
+		}
+	}
+}
+
+// print draws text with the 3x5 font and returns the x after the last character
+func (m *machine) print(s string, x, y int, c byte) int {
+	startX := x
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == '\n':
+			x, y = startX, y+6
+			i++
+			continue
+		case ch >= 0x80:
+			// Wide glyphs such as ⬅️ are stored as UTF-8; draw them as an outline box
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			for i < len(s) && s[i] == 0xef { // skip variation selectors
+				_, size = utf8.DecodeRuneInString(s[i:])
+				i += size
+			}
+			m.rectFill(x, y, x+6, y, c)
+			m.rectFill(x, y+4, x+6, y+4, c)
+			m.rectFill(x, y, x, y+4, c)
+			m.rectFill(x+6, y, x+6, y+4, c)
+			x += 8
+			continue
+		}
+		for row, bits := range glyphRows(ch) {
+			for col := range bits {
+				if bits[col] == '#' {
+					m.plot(x+col, y+row, c)
+				}
+			}
+		}
+		x += 4
+		i++
+	}
+	return x
+}
+
+// frameImage converts the screen through the display palette
+func (m *machine) frameImage() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 128, 128), screenPalette())
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			idx := m.mem.Peek(memScreenPal + int(m.mem.Pixel(x, y)))
+			if idx >= 128 {
+				idx = idx - 128 + 16
+			}
+			img.SetColorIndex(x, y, idx&31)
+		}
+	}
+	return img
+}
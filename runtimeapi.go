@@ -0,0 +1,337 @@
+package main
+
+import (
+	"image"
+
+	"github.com/drpaneas/parsepico/fixed"
+	"github.com/drpaneas/parsepico/lua"
+)
+
+// buttonGlyphs are the names PICO-8 predefines for the button numbers. Carts
+// may type them with or without the emoji variation selector.
+var buttonGlyphs = []string{"⬅", "➡", "⬆", "⬇", "🅾", "❎"}
+
+type luaArgs = []lua.Value
+
+// registerAPI installs the graphics, memory and input parts of the PICO-8 API
+func (m *machine) registerAPI() {
+	in := m.in
+	num := func(args luaArgs, i int) int { return lua.IntArg(args, i, 0) }
+	pen := func(args luaArgs, i int) byte {
+		if n, ok := lua.ToNumber(lua.Arg(args, i)); ok {
+			m.mem.Poke(memPen, byte(n.Int()&15))
+		}
+		return m.pen()
+	}
+	none := func(*lua.Interp, luaArgs) luaArgs { return nil }
+
+	for i, name := range buttonGlyphs {
+		in.Globals.Set(name, lua.Num(i))
+		in.Globals.Set(name+"\ufe0f", lua.Num(i))
+	}
+
+	// Drawing
+	in.Register("cls", func(_ *lua.Interp, args luaArgs) luaArgs {
+		c := byte(num(args, 0) & 15)
+		m.mem.Memset(memScreen, c|c<<4, 0x2000)
+		m.setClip(image.Rect(0, 0, 128, 128))
+		m.setCursor(0, 0)
+		return nil
+	})
+	in.Register("pset", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.plot(num(args, 0), num(args, 1), pen(args, 2))
+		return nil
+	})
+	in.Register("pget", func(_ *lua.Interp, args luaArgs) luaArgs {
+		return luaArgs{lua.Num(int(m.mem.Pixel(num(args, 0), num(args, 1))))}
+	})
+	in.Register("color", func(_ *lua.Interp, args luaArgs) luaArgs {
+		prev := m.pen()
+		m.mem.Poke(memPen, byte(lua.IntArg(args, 0, 6)&15))
+		return luaArgs{lua.Num(int(prev))}
+	})
+	in.Register("rectfill", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.rectFill(num(args, 0), num(args, 1), num(args, 2), num(args, 3), pen(args, 4))
+		return nil
+	})
+	in.Register("rect", func(_ *lua.Interp, args luaArgs) luaArgs {
+		x0, y0, x1, y1, c := num(args, 0), num(args, 1), num(args, 2), num(args, 3), pen(args, 4)
+		m.rectFill(x0, y0, x1, y0, c)
+		m.rectFill(x0, y1, x1, y1, c)
+		m.rectFill(x0, y0, x0, y1, c)
+		m.rectFill(x1, y0, x1, y1, c)
+		return nil
+	})
+	in.Register("circfill", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.circle(num(args, 0), num(args, 1), lua.IntArg(args, 2, 4), pen(args, 3), true)
+		return nil
+	})
+	in.Register("circ", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.circle(num(args, 0), num(args, 1), lua.IntArg(args, 2, 4), pen(args, 3), false)
+		return nil
+	})
+	in.Register("ovalfill", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.oval(num(args, 0), num(args, 1), num(args, 2), num(args, 3), pen(args, 4), true)
+		return nil
+	})
+	in.Register("oval", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.oval(num(args, 0), num(args, 1), num(args, 2), num(args, 3), pen(args, 4), false)
+		return nil
+	})
+	in.Register("line", func(_ *lua.Interp, args luaArgs) luaArgs {
+		switch {
+		case len(args) == 0:
+			m.lineValid = false
+		case len(args) <= 3:
+			// line(x1, y1, [col]) continues from the end of the previous line
+			x1, y1, c := num(args, 0), num(args, 1), pen(args, 2)
+			if m.lineValid {
+				m.line(m.lineX, m.lineY, x1, y1, c)
+			}
+			m.lineX, m.lineY, m.lineValid = x1, y1, true
+		default:
+			m.line(num(args, 0), num(args, 1), num(args, 2), num(args, 3), pen(args, 4))
+		}
+		return nil
+	})
+	in.Register("spr", func(_ *lua.Interp, args luaArgs) luaArgs {
+		n := num(args, 0) & 255
+		w := lua.NumberArg(args, 3, lua.IntNumber(1)).Float()
+		h := lua.NumberArg(args, 4, lua.IntNumber(1)).Float()
+		sw, sh := int(w*8), int(h*8)
+		m.blit(n%16*8, n/16*8, sw, sh, num(args, 1), num(args, 2), sw, sh,
+			lua.Truthy(lua.Arg(args, 5)), lua.Truthy(lua.Arg(args, 6)))
+		return nil
+	})
+	in.Register("sspr", func(_ *lua.Interp, args luaArgs) luaArgs {
+		sw, sh := num(args, 2), num(args, 3)
+		m.blit(num(args, 0), num(args, 1), sw, sh, num(args, 4), num(args, 5),
+			lua.IntArg(args, 6, sw), lua.IntArg(args, 7, sh),
+			lua.Truthy(lua.Arg(args, 8)), lua.Truthy(lua.Arg(args, 9)))
+		return nil
+	})
+	in.Register("map", func(_ *lua.Interp, args luaArgs) luaArgs {
+		cx, cy, sx, sy := num(args, 0), num(args, 1), num(args, 2), num(args, 3)
+		cw, ch := lua.IntArg(args, 4, 128), lua.IntArg(args, 5, 64)
+		layers := byte(num(args, 6))
+		// Cells outside the 128x64 map are empty
+		for ty := max(0, -cy); ty < min(ch, 64-cy); ty++ {
+			for tx := max(0, -cx); tx < min(cw, 128-cx); tx++ {
+				n := m.mem.Mget(cx+tx, cy+ty)
+				if n == 0 || (layers != 0 && m.mem.Peek(memFlags+int(n))&layers != layers) {
+					continue
+				}
+				m.blit(int(n)%16*8, int(n)/16*8, 8, 8, sx+tx*8, sy+ty*8, 8, 8, false, false)
+			}
+		}
+		return nil
+	})
+	in.Globals.Set("mapdraw", in.Globals.Get("map"))
+	in.Register("mget", func(_ *lua.Interp, args luaArgs) luaArgs {
+		return luaArgs{lua.Num(int(m.mem.Mget(num(args, 0), num(args, 1))))}
+	})
+	in.Register("mset", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.mem.Mset(num(args, 0), num(args, 1), byte(num(args, 2)))
+		return nil
+	})
+	in.Register("sget", func(_ *lua.Interp, args luaArgs) luaArgs {
+		return luaArgs{lua.Num(int(m.mem.Sget(num(args, 0), num(args, 1))))}
+	})
+	in.Register("sset", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.mem.Sset(num(args, 0), num(args, 1), pen(args, 2))
+		return nil
+	})
+	in.Register("fget", func(_ *lua.Interp, args luaArgs) luaArgs {
+		f := m.mem.Peek(memFlags + num(args, 0)&255)
+		if len(args) < 2 {
+			return luaArgs{lua.Num(int(f))}
+		}
+		return luaArgs{f&(1<<(num(args, 1)&7)) != 0}
+	})
+	in.Register("fset", func(_ *lua.Interp, args luaArgs) luaArgs {
+		addr := memFlags + num(args, 0)&255
+		if len(args) < 3 {
+			m.mem.Poke(addr, byte(num(args, 1)))
+			return nil
+		}
+		bit := byte(1 << (num(args, 1) & 7))
+		if lua.Truthy(args[2]) {
+			m.mem.Poke(addr, m.mem.Peek(addr)|bit)
+		} else {
+			m.mem.Poke(addr, m.mem.Peek(addr)&^bit)
+		}
+		return nil
+	})
+	in.Register("print", func(_ *lua.Interp, args luaArgs) luaArgs {
+		s := lua.ToString(lua.Arg(args, 0))
+		if len(args) <= 2 {
+			// print(str, [col]) prints at the cursor and moves it down a line
+			x, y := m.cursor()
+			end := m.print(s, x, y, pen(args, 1))
+			m.setCursor(x, y+6)
+			return luaArgs{lua.Num(end)}
+		}
+		x, y := num(args, 1), num(args, 2)
+		m.setCursor(x, y+6)
+		return luaArgs{lua.Num(m.print(s, x, y, pen(args, 3)))}
+	})
+	in.Register("cursor", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.setCursor(num(args, 0), num(args, 1))
+		pen(args, 2)
+		return nil
+	})
+	in.Register("pal", func(_ *lua.Interp, args luaArgs) luaArgs {
+		if len(args) == 0 {
+			m.resetPalette()
+			return nil
+		}
+		set := func(c0, c1, p int) {
+			switch p {
+			case 0:
+				// Keep the transparency bit
+				addr := memDrawPal + c0&15
+				m.mem.Poke(addr, m.mem.Peek(addr)&0x10|byte(c1&15))
+			case 1:
+				m.mem.Poke(memScreenPal+c0&15, byte(c1&0x8f))
+			}
+		}
+		if t, ok := args[0].(*lua.Table); ok {
+			p := num(args, 1)
+			for k, v := t.Next(nil); k != nil; k, v = t.Next(k) {
+				c0, _ := lua.ToNumber(k)
+				c1, _ := lua.ToNumber(v)
+				set(c0.Int(), c1.Int(), p)
+			}
+			return nil
+		}
+		set(num(args, 0), num(args, 1), num(args, 2))
+		return nil
+	})
+	in.Register("palt", func(_ *lua.Interp, args luaArgs) luaArgs {
+		switch len(args) {
+		case 0:
+			for c := byte(0); c < 16; c++ {
+				m.setTransparent(c, c == 0)
+			}
+		case 1:
+			// A single number is a bitfield with color 0 in bit 15
+			bits := num(args, 0)
+			for c := byte(0); c < 16; c++ {
+				m.setTransparent(c, bits&(1<<(15-c)) != 0)
+			}
+		default:
+			m.setTransparent(byte(num(args, 0)), lua.Truthy(args[1]))
+		}
+		return nil
+	})
+	in.Register("camera", func(_ *lua.Interp, args luaArgs) luaArgs {
+		prevX, prevY := m.camera()
+		m.setCamera(num(args, 0), num(args, 1))
+		return luaArgs{lua.Num(prevX), lua.Num(prevY)}
+	})
+	in.Register("clip", func(_ *lua.Interp, args luaArgs) luaArgs {
+		if len(args) == 0 {
+			m.setClip(image.Rect(0, 0, 128, 128))
+			return nil
+		}
+		x, y := num(args, 0), num(args, 1)
+		r := image.Rect(x, y, x+num(args, 2), y+num(args, 3))
+		if lua.Truthy(lua.Arg(args, 4)) {
+			r = r.Intersect(m.clip())
+		}
+		m.setClip(r)
+		return nil
+	})
+	in.Register("fillp", none)
+	in.Register("flip", func(in *lua.Interp, _ luaArgs) luaArgs {
+		if in.Current() != nil && in.Current() == m.mainLoop {
+			in.Yield(nil)
+		}
+		return nil
+	})
+
+	// Memory
+	in.Register("peek", func(_ *lua.Interp, args luaArgs) luaArgs {
+		addr, n := num(args, 0), lua.IntArg(args, 1, 1)
+		var out luaArgs
+		for i := 0; i < n; i++ {
+			out = append(out, lua.Num(int(m.mem.Peek(addr+i))))
+		}
+		return out
+	})
+	in.Register("poke", func(_ *lua.Interp, args luaArgs) luaArgs {
+		addr := num(args, 0)
+		for i := 1; i < len(args); i++ {
+			m.mem.Poke(addr+i-1, byte(num(args, i)))
+		}
+		return nil
+	})
+	in.Register("peek2", func(_ *lua.Interp, args luaArgs) luaArgs {
+		return luaArgs{lua.Num(int(int16(m.mem.Peek2(num(args, 0)))))}
+	})
+	in.Register("poke2", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.mem.Poke2(num(args, 0), uint16(num(args, 1)))
+		return nil
+	})
+	in.Register("peek4", func(_ *lua.Interp, args luaArgs) luaArgs {
+		return luaArgs{fixed.FromBits(m.mem.Peek4(num(args, 0)))}
+	})
+	in.Register("poke4", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.mem.Poke4(num(args, 0), lua.NumberArg(args, 1, 0).Bits())
+		return nil
+	})
+	in.Register("memcpy", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.mem.Memcpy(num(args, 0), num(args, 1), num(args, 2))
+		return nil
+	})
+	in.Register("memset", func(_ *lua.Interp, args luaArgs) luaArgs {
+		m.mem.Memset(num(args, 0), byte(num(args, 1)), num(args, 2))
+		return nil
+	})
+	in.Register("reload", func(_ *lua.Interp, args luaArgs) luaArgs {
+		dst, src, n := num(args, 0), num(args, 1), lua.IntArg(args, 2, memROMEnd)
+		for i := 0; i < n; i++ {
+			if src+i >= 0 && src+i < memROMEnd {
+				m.mem.Poke(dst+i, m.rom.Peek(src+i))
+			}
+		}
+		return nil
+	})
+	in.Register("cstore", none)
+
+	// Input and system
+	in.Register("btn", func(_ *lua.Interp, args luaArgs) luaArgs {
+		if len(args) == 0 {
+			return luaArgs{lua.Num(int(m.held))}
+		}
+		if num(args, 1) != 0 {
+			return luaArgs{false}
+		}
+		return luaArgs{m.held&(1<<(num(args, 0)&7)) != 0}
+	})
+	in.Register("btnp", func(_ *lua.Interp, args luaArgs) luaArgs {
+		if len(args) == 0 {
+			return luaArgs{lua.Num(int(m.held &^ m.prevHeld))}
+		}
+		if num(args, 1) != 0 {
+			return luaArgs{false}
+		}
+		bit := byte(1 << (num(args, 0) & 7))
+		return luaArgs{m.held&bit != 0 && m.prevHeld&bit == 0}
+	})
+	in.Register("time", func(_ *lua.Interp, _ luaArgs) luaArgs {
+		return luaArgs{lua.FloatNumber(float64(m.frame) / float64(m.fps))}
+	})
+	in.Globals.Set("t", in.Globals.Get("time"))
+	in.Register("stat", func(_ *lua.Interp, args luaArgs) luaArgs {
+		switch num(args, 0) {
+		case 7, 8:
+			return luaArgs{lua.Num(m.fps)}
+		}
+		return luaArgs{lua.Num(0)}
+	})
+	for _, name := range []string{"sfx", "music", "menuitem", "extcmd", "cartdata", "dset"} {
+		in.Register(name, none)
+	}
+	in.Register("dget", func(_ *lua.Interp, _ luaArgs) luaArgs { return luaArgs{lua.Num(0)} })
+}
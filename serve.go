@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//go:embed web/index.html
+var webFiles embed.FS
+
+// servedCart is a cart parsed once and kept in memory for the HTTP API
+type servedCart struct {
+	gfxData     []string
+	flagData    []int
+	code        []string
+	spriteSheet *image.RGBA
+	mapImage    *image.RGBA // nil when the cart has no map
+	sheetJSON   *SpriteSheet
+	mapSheet    *MapSheet
+	sfx         []Sfx
+	music       []MusicPattern
+}
+
+// runServe implements the "serve" subcommand
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	cart, err := loadServedCart(cartPath, opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading cart: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Serving %s on http://%s/\n", cartPath, *addr)
+	if err := http.ListenAndServe(*addr, cart.routes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadServedCart parses every section the API exposes
+func loadServedCart(cartPath string, useSection3, useSection4 bool) (*servedCart, error) {
+	cart := &servedCart{
+		gfxData:  parseSection(cartPath, "__gfx__"),
+		flagData: parseFlagSection(cartPath),
+		code:     parseSection(cartPath, "__lua__"),
+		sfx:      parseSfxSection(parseSection(cartPath, "__sfx__")),
+		music:    parseMusicSection(parseSection(cartPath, "__music__")),
+	}
+	if len(cart.gfxData) == 0 {
+		return nil, fmt.Errorf("no __gfx__ section found")
+	}
+	cart.spriteSheet = reconstructImage(cart.gfxData)
+
+	var err error
+	cart.sheetJSON, err = generateSpriteSheetJSON(cart.gfxData, cart.flagData, useSection3, useSection4)
+	if err != nil {
+		return nil, err
+	}
+	if mapData := parseSection(cartPath, "__map__"); len(mapData) > 0 {
+		cart.mapSheet, err = generateMapJSON(mapData, cart.gfxData, useSection3, useSection4)
+		if err != nil {
+			return nil, err
+		}
+		cart.mapImage = renderCartMap(mapData, cart.gfxData, cart.spriteSheet, useSection3, useSection4)
+	}
+	return cart, nil
+}
+
+// routes wires up the page and the /cart API
+func (c *servedCart) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := webFiles.ReadFile("web/index.html")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(page)
+	})
+	mux.HandleFunc("GET /cart/sprites", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.sheetJSON)
+	})
+	mux.HandleFunc("GET /cart/spritesheet.png", func(w http.ResponseWriter, r *http.Request) {
+		writePNG(w, scaleImage(c.spriteSheet, queryInt(r, "scale", 1, 1, 16)))
+	})
+	mux.HandleFunc("GET /cart/sprite/{file}", c.handleSprite)
+	mux.HandleFunc("GET /cart/flags", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.flagData)
+	})
+	mux.HandleFunc("GET /cart/map", func(w http.ResponseWriter, r *http.Request) {
+		if c.mapSheet == nil {
+			http.Error(w, "cart has no map", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, c.mapSheet)
+	})
+	mux.HandleFunc("GET /cart/map.png", c.handleMapPNG)
+	mux.HandleFunc("GET /cart/sfx", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.sfx)
+	})
+	mux.HandleFunc("GET /cart/sfx/{file}", c.handleSfxWAV)
+	mux.HandleFunc("GET /cart/music", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.music)
+	})
+	mux.HandleFunc("GET /cart/code", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(strings.Join(c.code, "\n") + "\n"))
+	})
+	return mux
+}
+
+// handleSprite serves /cart/sprite/{id}.png (with ?scale=) and /cart/sprite/{id}.json
+func (c *servedCart) handleSprite(w http.ResponseWriter, r *http.Request) {
+	name, ext, _ := strings.Cut(r.PathValue("file"), ".")
+	id, err := strconv.Atoi(name)
+	if err != nil || id < 0 || id > 255 {
+		http.Error(w, "sprite id must be 0..255", http.StatusBadRequest)
+		return
+	}
+
+	switch ext {
+	case "png":
+		rect := image.Rect((id%16)*8, (id/16)*8, (id%16)*8+8, (id/16)*8+8)
+		writePNG(w, scaleImage(cropImage(c.spriteSheet, rect), queryInt(r, "scale", 1, 1, 64)))
+	case "json":
+		// Blank sprites are left out of the sheet JSON, so describe them here
+		for _, sprite := range c.sheetJSON.Sprites {
+			if sprite.ID == id {
+				writeJSON(w, sprite)
+				return
+			}
+		}
+		writeJSON(w, Sprite{
+			ID:       id,
+			X:        (id % 16) * 8,
+			Y:        (id / 16) * 8,
+			Width:    8,
+			Height:   8,
+			Pixels:   spritePixels(c.sheetJSON, id),
+			Flags:    SpriteFlags{Bitfield: c.flagData[id], Individual: getFlagArray(c.flagData[id])},
+			Filename: fmt.Sprintf("sprite_%03d.png", id),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleMapPNG serves a region of the map given in tiles: ?x=&y=&w=&h=&scale=
+func (c *servedCart) handleMapPNG(w http.ResponseWriter, r *http.Request) {
+	if c.mapImage == nil {
+		http.Error(w, "cart has no map", http.StatusNotFound)
+		return
+	}
+	tilesW, tilesH := c.mapImage.Bounds().Dx()/8, c.mapImage.Bounds().Dy()/8
+	x := queryInt(r, "x", 0, 0, tilesW-1)
+	y := queryInt(r, "y", 0, 0, tilesH-1)
+	width := queryInt(r, "w", tilesW-x, 1, tilesW-x)
+	height := queryInt(r, "h", tilesH-y, 1, tilesH-y)
+	scale := queryInt(r, "scale", 1, 1, 8)
+
+	region := cropImage(c.mapImage, image.Rect(x*8, y*8, (x+width)*8, (y+height)*8))
+	writePNG(w, scaleImage(region, scale))
+}
+
+// handleSfxWAV serves /cart/sfx/{n}.wav
+func (c *servedCart) handleSfxWAV(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".wav")
+	n, err := strconv.Atoi(name)
+	if !ok || err != nil || n < 0 || n >= len(c.sfx) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "audio/wav")
+	_, _ = w.Write(encodeWAV(synthesizeSfx(c.sfx, n), sfxSampleRate))
+}
+
+// queryInt reads an integer query parameter, clamped to [lo, hi]
+func queryInt(r *http.Request, name string, fallback, lo, hi int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		value = fallback
+	}
+	return max(lo, min(hi, value))
+}
+
+// writeJSON sends v as indented JSON
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// writePNG sends img as a PNG
+func writePNG(w http.ResponseWriter, img image.Image) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sfx is one of the 64 sound effects from the __sfx__ section
+type Sfx struct {
+	Mode      int      `json:"mode"`      // editor mode: 0 pitch, 1 tracker
+	Speed     int      `json:"speed"`     // ticks per note
+	LoopStart int      `json:"loopStart"` // first note of the loop
+	LoopEnd   int      `json:"loopEnd"`   // note after the loop; 0 means no loop
+	Notes     [32]Note `json:"notes"`     // the 32 notes of the effect
+}
+
+// Note is a single step of an Sfx
+type Note struct {
+	Pitch    int `json:"pitch"`    // 0..63, C-0 upwards
+	Waveform int `json:"waveform"` // 0..7 builtin waveforms, 8..15 custom instrument (sfx 0..7)
+	Volume   int `json:"volume"`   // 0..7, 0 is silent
+	Effect   int `json:"effect"`   // 0..7
+}
+
+// MusicPattern is one entry of the __music__ section
+type MusicPattern struct {
+	Flags    int    `json:"flags"`    // bit 0 loop start, bit 1 loop end, bit 2 stop
+	Channels [4]int `json:"channels"` // sfx IDs, or -1 when the channel is off
+}
+
+// parseSfxSection decodes each 168 hex char line: an 8 char header (mode,
+// speed, loop start, loop end) followed by 32 notes of 5 chars each
+// (2 pitch, 1 waveform, 1 volume, 1 effect).
+func parseSfxSection(lines []string) []Sfx {
+	var effects []Sfx
+	for _, line := range lines {
+		if len(line) < 8 {
+			continue
+		}
+		sfx := Sfx{
+			Mode:      parseHexByte(line[0:2]),
+			Speed:     parseHexByte(line[2:4]),
+			LoopStart: parseHexByte(line[4:6]),
+			LoopEnd:   parseHexByte(line[6:8]),
+		}
+		for i := 0; i < 32 && 8+i*5+5 <= len(line); i++ {
+			n := line[8+i*5 : 8+i*5+5]
+			sfx.Notes[i] = Note{
+				Pitch:    parseHexByte(n[0:2]),
+				Waveform: parseHexChar(rune(n[2])),
+				Volume:   parseHexChar(rune(n[3])),
+				Effect:   parseHexChar(rune(n[4])),
+			}
+		}
+		effects = append(effects, sfx)
+	}
+	return effects
+}
+
+// parseMusicSection decodes lines like "01 0a424344": a flag byte and four channel bytes,
+// where a set 0x40 bit marks a disabled channel
+func parseMusicSection(lines []string) []MusicPattern {
+	var patterns []MusicPattern
+	for _, line := range lines {
+		flags, channels, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || len(flags) != 2 || len(channels) != 8 {
+			continue
+		}
+		pattern := MusicPattern{Flags: parseHexByte(flags)}
+		for i := range pattern.Channels {
+			value := parseHexByte(channels[i*2 : i*2+2])
+			if value&0x40 != 0 {
+				value = -1
+			}
+			pattern.Channels[i] = value
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// parseHexByte interprets two hex digits
+func parseHexByte(s string) int {
+	return parseHexChar(rune(s[0]))*16 + parseHexChar(rune(s[1]))
+}
+
+// noteNames are the twelve semitones as shown by the PICO-8 tracker
+var noteNames = []string{"C-", "C#", "D-", "D#", "E-", "F-", "F#", "G-", "G#", "A-", "A#", "B-"}
+
+// String formats a note the way the tracker shows it, e.g. "C#2 w3 v5 e0", or "..." when empty
+func (n Note) String() string {
+	if n == (Note{}) {
+		return "..."
+	}
+	if n.Pitch < 0 {
+		return "???"
+	}
+	return fmt.Sprintf("%s%d w%d v%d e%d", noteNames[n.Pitch%12], n.Pitch/12, n.Waveform, n.Volume, n.Effect)
+}
+
+// String formats the pattern as its four channels plus loop/stop markers
+func (p MusicPattern) String() string {
+	parts := make([]string, 0, 7)
+	for _, ch := range p.Channels {
+		if ch < 0 {
+			parts = append(parts, "--")
+		} else {
+			parts = append(parts, fmt.Sprintf("%02d", ch))
+		}
+	}
+	for bit, name := range []string{"loop-start", "loop-end", "stop"} {
+		if p.Flags&(1<<bit) != 0 {
+			parts = append(parts, "["+name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
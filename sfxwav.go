@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// PICO-8 mixes audio at 22050 Hz and each sfx speed unit lasts 183 samples
+const (
+	sfxSampleRate     = 22050
+	sfxSamplesPerTick = 183
+)
+
+// noteFrequency converts a PICO-8 pitch to Hz; pitch 33 (A-2) is 440 Hz
+func noteFrequency(pitch float64) float64 {
+	return 440 * math.Pow(2, (pitch-33)/12)
+}
+
+// sfxWaveform samples one of the eight builtin waveforms at phase t in [0,1)
+func sfxWaveform(waveform int, t float64, noise *uint32) float64 {
+	switch waveform {
+	case 0: // triangle
+		return 1 - 4*math.Abs(t-0.5)
+	case 1: // tilted saw: slow rise, fast fall
+		if t < 0.875 {
+			return t/0.875*2 - 1
+		}
+		return 1 - (t-0.875)/0.125*2
+	case 2: // saw
+		return 2*t - 1
+	case 3: // square
+		if t < 0.5 {
+			return 1
+		}
+		return -1
+	case 4: // pulse
+		if t < 0.3125 {
+			return 1
+		}
+		return -1
+	case 5: // organ: two stacked triangles
+		return (1-4*math.Abs(t-0.5))*0.6 + (1-4*math.Abs(math.Mod(t*2, 1)-0.5))*0.4
+	case 6: // noise, a xorshift register stepped by the caller's phase
+		*noise ^= *noise << 13
+		*noise ^= *noise >> 17
+		*noise ^= *noise << 5
+		return float64(int32(*noise)) / math.MaxInt32
+	default: // phaser: two slightly detuned triangles
+		return (1-4*math.Abs(t-0.5))*0.5 + (1-4*math.Abs(math.Mod(t*1.0097, 1)-0.5))*0.5
+	}
+}
+
+// synthesizeSfx renders an sfx to mono samples in [-1,1]. It is an approximation
+// of the PICO-8 synth: custom instruments play with their first note's waveform,
+// the effect is played once and trailing silent notes are dropped.
+func synthesizeSfx(effects []Sfx, n int) []float64 {
+	if n < 0 || n >= len(effects) {
+		return nil
+	}
+	sfx := effects[n]
+	speed := max(sfx.Speed, 1)
+	last := -1
+	for i, note := range sfx.Notes {
+		if note.Volume > 0 {
+			last = i
+		}
+	}
+
+	noteLen := speed * sfxSamplesPerTick
+	samples := make([]float64, 0, (last+1)*noteLen)
+	phase := 0.0
+	noise := uint32(0x2545f491)
+	prevPitch := 0
+	for i := 0; i <= last; i++ {
+		note := sfx.Notes[i]
+		waveform := note.Waveform
+		if waveform >= 8 && waveform-8 < len(effects) {
+			waveform = effects[waveform-8].Notes[0].Waveform % 8
+		}
+		for s := 0; s < noteLen; s++ {
+			progress := float64(s) / float64(noteLen)
+			pitch := float64(note.Pitch)
+			volume := float64(note.Volume) / 7
+			switch note.Effect {
+			case 1: // slide from the previous note
+				pitch = float64(prevPitch) + (pitch-float64(prevPitch))*progress
+			case 2: // vibrato
+				pitch += 0.5 * math.Sin(2*math.Pi*float64(s)/float64(sfxSampleRate)*7)
+			case 3: // drop
+				pitch *= 1 - progress
+			case 4: // fade in
+				volume *= progress
+			case 5: // fade out
+				volume *= 1 - progress
+			case 6, 7: // arpeggio over the group of four notes, fast or slow
+				group := i &^ 3
+				rate := 4
+				if note.Effect == 7 {
+					rate = 8
+				}
+				step := (s / (sfxSamplesPerTick * rate / 4)) % 4
+				pitch = float64(sfx.Notes[group+step].Pitch)
+			}
+			phase = math.Mod(phase+noteFrequency(pitch)/sfxSampleRate, 1)
+			samples = append(samples, sfxWaveform(waveform, phase, &noise)*volume*0.5)
+		}
+		prevPitch = note.Pitch
+	}
+	return samples
+}
+
+// encodeWAV wraps mono samples in a 16-bit PCM WAV file
+func encodeWAV(samples []float64, sampleRate int) []byte {
+	var buf bytes.Buffer
+	dataSize := len(samples) * 2
+	write := func(v any) { _ = binary.Write(&buf, binary.LittleEndian, v) }
+
+	buf.WriteString("RIFF")
+	write(uint32(36 + dataSize))
+	buf.WriteString("WAVEfmt ")
+	write(uint32(16))             // fmt chunk size
+	write(uint16(1))              // PCM
+	write(uint16(1))              // mono
+	write(uint32(sampleRate))     // sample rate
+	write(uint32(sampleRate * 2)) // byte rate
+	write(uint16(2))              // block align
+	write(uint16(16))             // bits per sample
+	buf.WriteString("data")
+	write(uint32(dataSize))
+	for _, s := range samples {
+		write(int16(max(-1, min(1, s)) * math.MaxInt16))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lineEdit is one line of a line diff: Op is ' ' (kept), '-' (removed) or '+' (added)
+type lineEdit struct {
+	Op   byte
+	Text string
+	A, B int // 0-based line numbers in the old and new text (-1 when absent)
+}
+
+// diffLines computes a shortest edit script between two texts with Myers' algorithm
+func diffLines(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	// trace[d] keeps v for k in [-d-1, d+1] as it was before step d
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackEdits(a, b, trace, d)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrackEdits walks the Myers trace backwards to recover the edit script
+func backtrackEdits(a, b []string, trace [][]int, depth int) []lineEdit {
+	x, y := len(a), len(b)
+	var edits []lineEdit
+	for d := depth; d > 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, lineEdit{Op: ' ', Text: a[x], A: x, B: y})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, lineEdit{Op: '+', Text: b[y], A: -1, B: y})
+		} else {
+			x--
+			edits = append(edits, lineEdit{Op: '-', Text: a[x], A: x, B: -1})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, lineEdit{Op: ' ', Text: a[x], A: x, B: y})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// unifiedDiff formats a line diff as unified diff hunks with the given context
+func unifiedDiff(a, b []string, context int) string {
+	edits := diffLines(a, b)
+	var out strings.Builder
+
+	for i := 0; i < len(edits); {
+		if edits[i].Op == ' ' {
+			i++
+			continue
+		}
+		// Grow the hunk until a run of more than 2*context unchanged lines
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+
+		aStart, bStart, aLen, bLen := -1, -1, 0, 0
+		for _, e := range edits[start:end] {
+			if e.A >= 0 {
+				if aStart < 0 {
+					aStart = e.A
+				}
+				aLen++
+			}
+			if e.B >= 0 {
+				if bStart < 0 {
+					bStart = e.B
+				}
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen, edits, start, true), hunkRange(bStart, bLen, edits, start, false))
+		for _, e := range edits[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", e.Op, e.Text)
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the start,length part of a hunk header; an empty side points at the
+// line before the hunk, as diff -u does
+func hunkRange(first, length int, edits []lineEdit, start int, old bool) string {
+	if length == 0 {
+		line := 0
+		for _, e := range edits[:start] {
+			if (old && e.A >= 0) || (!old && e.B >= 0) {
+				line++
+			}
+		}
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", first+1, length)
+}
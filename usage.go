@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+)
+
+// UsageReport is the usage.json output
+type UsageReport struct {
+	Version     string        `json:"version"`
+	Description string        `json:"description"`
+	Sprites     []SpriteUsage `json:"sprites"`
+	Summary     UsageSummary  `json:"summary"`
+}
+
+// SpriteUsage tells where a single sprite is referenced
+type SpriteUsage struct {
+	ID        int    `json:"id"`
+	Drawn     bool   `json:"drawn"`     // has at least one non-zero pixel
+	MapCount  int    `json:"mapCount"`  // number of map cells placing it
+	CodeLines []int  `json:"codeLines"` // __lua__ lines referencing it by literal
+	Status    string `json:"status"`    // placed, code-only, unused or blank
+}
+
+// UsageSummary counts sprites per status
+type UsageSummary struct {
+	Placed   int `json:"placed"`
+	CodeOnly int `json:"codeOnly"`
+	Unused   int `json:"unused"` // drawn but never placed or referenced
+	Blank    int `json:"blank"`
+}
+
+// luaSpriteArgs lists the functions that take a literal sprite number and the argument holding it
+var luaSpriteArgs = []struct {
+	name string
+	arg  int
+}{
+	{"spr", 0},
+	{"fget", 0},
+	{"fset", 0},
+	{"mset", 2},
+}
+
+// runUsage implements the "usage" subcommand
+func runUsage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	scale := fs.Int("scale", 4, "Integer scale factor for usage.png")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	if *scale < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --scale must be at least 1")
+		os.Exit(1)
+	}
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	if len(gfxData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __gfx__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	sheet, err := generateSpriteSheetJSON(gfxData, parseFlagSection(cartPath), opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating spritesheet JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cells []MapCell
+	if mapData := parseSection(cartPath, "__map__"); len(mapData) > 0 {
+		mapSheet, err := generateMapJSON(mapData, gfxData, opts.useSection3, opts.useSection4)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
+			os.Exit(1)
+		}
+		cells = mapSheet.Cells
+	}
+
+	report := generateUsageReport(sheet, cells, parseSection(cartPath, "__lua__"))
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling usage JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("usage.json", data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving usage.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated usage.json")
+
+	heatmap := renderUsageHeatmap(reconstructImage(gfxData), report, *scale)
+	if err := saveAsPng(heatmap, "usage.png"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving usage.png: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully generated usage.png")
+
+	for _, usage := range report.Sprites {
+		switch {
+		case usage.Status == "unused":
+			fmt.Printf("sprite %3d is drawn but never placed or referenced\n", usage.ID)
+		case usage.Drawn && usage.MapCount == 0:
+			fmt.Printf("sprite %3d is drawn but never placed (code lines %v)\n", usage.ID, usage.CodeLines)
+		}
+	}
+	fmt.Printf("%d placed, %d code-only, %d unused, %d blank\n",
+		report.Summary.Placed, report.Summary.CodeOnly, report.Summary.Unused, report.Summary.Blank)
+}
+
+// generateUsageReport counts map placements and literal code references for
+// every sprite that holds graphics with the current --3/--4 flags
+func generateUsageReport(sheet *SpriteSheet, cells []MapCell, code []string) *UsageReport {
+	useSection3 := sheet.Metadata.AvailableSprites.Sections.Section3
+	useSection4 := sheet.Metadata.AvailableSprites.Sections.Section4
+
+	mapCounts := make(map[int]int)
+	for _, cell := range cells {
+		mapCounts[cell.Sprite]++
+	}
+
+	codeLines := make(map[int][]int)
+	for _, fn := range luaSpriteArgs {
+		for _, call := range findLuaCalls(code, fn.name) {
+			if fn.arg >= len(call.Args) {
+				continue
+			}
+			if id, ok := parseLuaInt(call.Args[fn.arg]); ok {
+				codeLines[id] = append(codeLines[id], call.Line)
+			}
+		}
+	}
+
+	drawn := make(map[int]bool)
+	for _, sprite := range sheet.Sprites {
+		drawn[sprite.ID] = sprite.Used
+	}
+
+	report := &UsageReport{
+		Version:     "1.0",
+		Description: "PICO-8 sprite usage report",
+		Sprites:     make([]SpriteUsage, 0, 256),
+	}
+	for id := 0; id < 256; id++ {
+		if !spriteAvailable(id, useSection3, useSection4) {
+			continue
+		}
+		usage := SpriteUsage{
+			ID:        id,
+			Drawn:     drawn[id],
+			MapCount:  mapCounts[id],
+			CodeLines: codeLines[id],
+		}
+		if usage.CodeLines == nil {
+			usage.CodeLines = make([]int, 0)
+		}
+
+		switch {
+		case usage.MapCount > 0:
+			usage.Status = "placed"
+			report.Summary.Placed++
+		case len(usage.CodeLines) > 0:
+			usage.Status = "code-only"
+			report.Summary.CodeOnly++
+		case usage.Drawn:
+			usage.Status = "unused"
+			report.Summary.Unused++
+		default:
+			usage.Status = "blank"
+			report.Summary.Blank++
+		}
+		report.Sprites = append(report.Sprites, usage)
+	}
+	return report
+}
+
+// renderUsageHeatmap shades each tile of the sprite sheet by its usage: placed
+// sprites are tinted from blue (rare) to red (most used) on a log scale, code-only
+// sprites are tinted green and unused sprites are dimmed.
+func renderUsageHeatmap(spriteSheet *image.RGBA, report *UsageReport, scale int) *image.RGBA {
+	const tileSize = 8
+	maxCount := 0
+	for _, usage := range report.Sprites {
+		maxCount = max(maxCount, usage.MapCount)
+	}
+
+	tints := make(map[int]color.RGBA)
+	for _, usage := range report.Sprites {
+		switch usage.Status {
+		case "placed":
+			heat := math.Log1p(float64(usage.MapCount)) / math.Log1p(float64(maxCount))
+			tints[usage.ID] = color.RGBA{uint8(255 * heat), 0, uint8(255 * (1 - heat)), 128}
+		case "code-only":
+			tints[usage.ID] = color.RGBA{0, 255, 0, 96}
+		default:
+			tints[usage.ID] = color.RGBA{0, 0, 0, 192}
+		}
+	}
+
+	size := spriteSheet.Bounds().Dx()
+	out := image.NewRGBA(image.Rect(0, 0, size*scale, size*scale))
+	for y := 0; y < size*scale; y++ {
+		for x := 0; x < size*scale; x++ {
+			sx, sy := x/scale, y/scale
+			base := spriteSheet.RGBAAt(sx, sy)
+			tint, ok := tints[(sy/tileSize)*16+sx/tileSize]
+			if !ok {
+				// Dual-purpose tiles hold map data, not graphics
+				tint = color.RGBA{0, 0, 0, 255}
+			}
+			out.SetRGBA(x, y, blendRGBA(base, tint))
+		}
+	}
+	return out
+}
+
+// blendRGBA draws tint with its alpha over an opaque base color
+func blendRGBA(base, tint color.RGBA) color.RGBA {
+	a := float64(tint.A) / 255
+	mix := func(b, t uint8) uint8 {
+		return uint8(float64(b)*(1-a) + float64(t)*a)
+	}
+	return color.RGBA{mix(base.R, tint.R), mix(base.G, tint.G), mix(base.B, tint.B), 255}
+}
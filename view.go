@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+)
+
+// runView implements the "view" subcommand
+func runView(args []string) {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	opts := addCartFlags(fs)
+	tile := fs.String("tile", "", "Camera position in tiles as x,y")
+	pixel := fs.String("pixel", "", "Camera position in pixels as x,y, like camera(x,y)")
+	room := fs.Int("room", -1, "Camera on the Nth 16x16 screen, counted left to right, top to bottom")
+	layers := fs.Int("layers", 0, "Only draw tiles whose sprite flags match this bitmask")
+	layersAny := fs.Bool("layers-any", false, "With --layers, draw tiles with any bit of the mask instead of all")
+	contact := fs.Bool("contact", false, "Tile every non-empty 16x16 screen into one contact sheet")
+	columns := fs.Int("columns", 8, "Screens per row in the contact sheet")
+	scale := fs.Int("scale", 1, "Integer scale factor for the output")
+	outPath := fs.String("out", "", "Output PNG (default view.png, or contact.png with --contact)")
+	_ = fs.Parse(args)
+
+	cartPath := requireCart(fs, opts)
+	if *scale < 1 || *columns < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --scale and --columns must be at least 1")
+		os.Exit(1)
+	}
+
+	gfxData := parseSection(cartPath, "__gfx__")
+	mapData := parseSection(cartPath, "__map__")
+	if len(mapData) == 0 {
+		fmt.Fprintln(os.Stderr, "No __map__ section found in cart. Exiting.")
+		os.Exit(1)
+	}
+	mapSheet, err := generateMapJSON(mapData, gfxData, opts.useSection3, opts.useSection4)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating map JSON: %v\n", err)
+		os.Exit(1)
+	}
+	grid := mapGrid(mapSheet)
+	mapImage := renderMapLayers(grid, reconstructImage(gfxData), parseFlagSection(cartPath), *layers, *layersAny)
+
+	var out *image.RGBA
+	if *contact {
+		out = renderContactSheet(mapImage, grid, *columns)
+		if out.Bounds().Empty() {
+			fmt.Fprintln(os.Stderr, "The map has no non-empty screens. Exiting.")
+			os.Exit(1)
+		}
+		if *outPath == "" {
+			*outPath = "contact.png"
+		}
+	} else {
+		camX, camY, err := cameraPosition(*tile, *pixel, *room, len(grid[0]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fs.Usage()
+			os.Exit(1)
+		}
+		// Anything outside the map stays black, as after cls()
+		out = image.NewRGBA(image.Rect(0, 0, 128, 128))
+		draw.Draw(out, out.Bounds(), image.NewUniform(pico8Palette[0]), image.Point{}, draw.Src)
+		draw.Draw(out, out.Bounds(), mapImage, image.Pt(camX, camY), draw.Src)
+		if *outPath == "" {
+			*outPath = "view.png"
+		}
+	}
+
+	if err := saveAsPng(scaleImage(out, *scale), *outPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully generated %s\n", *outPath)
+}
+
+// cameraPosition resolves exactly one of --tile, --pixel or --room to a pixel offset
+func cameraPosition(tile, pixel string, room, mapWidth int) (x, y int, err error) {
+	given := 0
+	if tile != "" {
+		given++
+		t, err := parseTile(tile)
+		if err != nil {
+			return 0, 0, err
+		}
+		x, y = t[0]*8, t[1]*8
+	}
+	if pixel != "" {
+		given++
+		p, err := parseTile(pixel)
+		if err != nil {
+			return 0, 0, err
+		}
+		x, y = p[0], p[1]
+	}
+	if room >= 0 {
+		given++
+		perRow := mapWidth / 16
+		x, y = (room%perRow)*128, (room/perRow)*128
+	}
+	if given != 1 {
+		return 0, 0, fmt.Errorf("give exactly one of --tile, --pixel or --room")
+	}
+	return x, y, nil
+}
+
+// renderContactSheet lays out every non-empty 16x16 screen left to right with a 1 pixel gap
+func renderContactSheet(mapImage *image.RGBA, grid [][]int, columns int) *image.RGBA {
+	const screen = 128
+	const gap = 1
+	rooms := gridRooms(grid, 16, 16)
+	rows := (len(rooms) + columns - 1) / columns
+	cols := min(columns, len(rooms))
+
+	sheet := image.NewRGBA(image.Rect(0, 0, max(cols*(screen+gap)-gap, 0), max(rows*(screen+gap)-gap, 0)))
+	for i, room := range rooms {
+		at := image.Pt((i%columns)*(screen+gap), (i/columns)*(screen+gap))
+		src := image.Pt(room.Bounds.X*8, room.Bounds.Y*8)
+		draw.Draw(sheet, image.Rect(0, 0, room.Bounds.W*8, room.Bounds.H*8).Add(at), mapImage, src, draw.Src)
+	}
+	return sheet
+}
+
+// scaleImage enlarges an image by an integer factor using nearest neighbor
+func scaleImage(img *image.RGBA, scale int) *image.RGBA {
+	if scale == 1 {
+		return img
+	}
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale))
+	for y := 0; y < b.Dy()*scale; y++ {
+		for x := 0; x < b.Dx()*scale; x++ {
+			out.SetRGBA(x, y, img.RGBAAt(b.Min.X+x/scale, b.Min.Y+y/scale))
+		}
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sectionSet names the cart sections that changed; nil stands for all of them
+type sectionSet map[string]bool
+
+// has reports whether any of the named sections changed
+func (s sectionSet) has(names ...string) bool {
+	if s == nil {
+		return true
+	}
+	for _, name := range names {
+		if s[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// watchCart polls the cart and re-exports whatever depends on the sections that
+// changed. A save is only acted on once the file has stopped changing for one
+// interval, so a cart caught halfway through being written is not exported.
+func watchCart(opts exportOptions, interval time.Duration) {
+	hashes, err := sectionHashes(opts.cartPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading cart: %v\n", err)
+		os.Exit(1)
+	}
+	exported, _ := os.Stat(opts.cartPath)
+	seen := exported
+	fmt.Printf("Watching %s for changes (Ctrl+C to stop)\n", opts.cartPath)
+
+	for {
+		time.Sleep(interval)
+		info, err := os.Stat(opts.cartPath)
+		if err != nil {
+			// Editors sometimes replace the file; wait for it to come back
+			continue
+		}
+		if !sameFileState(info, seen) {
+			seen = info
+			continue
+		}
+		if sameFileState(info, exported) {
+			continue
+		}
+		exported = info
+
+		current, err := sectionHashes(opts.cartPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading cart: %v\n", err)
+			continue
+		}
+		changed := make(sectionSet)
+		for name, sum := range current {
+			if hashes[name] != sum {
+				changed[name] = true
+			}
+		}
+		for name := range hashes {
+			if _, ok := current[name]; !ok {
+				changed[name] = true
+			}
+		}
+		hashes = current
+		if len(changed) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(changed))
+		for name := range changed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("[%s] changed: %s\n", time.Now().Format("15:04:05"), strings.Join(names, " "))
+		if !changed.has("__gfx__", "__map__", "__gff__") {
+			fmt.Println("Nothing to re-export.")
+			continue
+		}
+		if err := exportCart(opts, changed); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// sameFileState compares the size and modification time of two stats
+func sameFileState(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// sectionHashes fingerprints each section of the cart
+func sectionHashes(cartPath string) (map[string][32]byte, error) {
+	cart, err := readCartFile(cartPath)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string][32]byte, len(cart.Sections))
+	for _, s := range cart.Sections {
+		hashes[s.Name] = sha256.Sum256([]byte(strings.Join(s.Lines, "\n")))
+	}
+	return hashes, nil
+}